@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// cliOptions holds the parsed command line.
+type cliOptions struct {
+	command     string   // Subcommand to run; "link" when none is given
+	commandArgs []string // Positional arguments that follow the subcommand
+	help        bool
+	version     bool
+	force       bool
+	backup      bool
+	verbose     bool
+	dryRun      bool
+	yes         bool
+	relative    bool
+	fold        bool
+	root        string // Overrides DOTFILES_ROOT when set
+	home        string // Overrides DOTFILES_HOME when set
+	ignoreFile  string // Overrides DOTFILES_IGNORE_FILE when set
+	mode        string // How sources are deployed; empty means symlink
+	identity    string // Overrides DOTFILES_AGE_IDENTITY when set
+	host        string // Overrides DOTFILES_HOST and the machine's hostname when set
+	profile     string // Overrides DOTFILES_PROFILE when set
+	from        string // Old repository root for relocate
+	to          string // New repository root for relocate
+}
+
+// commandSpec describes a subcommand and the number of positional arguments it takes.
+type commandSpec struct {
+	name     string
+	args     int
+	usage    string
+	required func(o *cliOptions) bool // Reports whether the flags the command requires are set; nil when it requires none
+}
+
+// commands lists the supported subcommands.
+var commands = []commandSpec{
+	{name: "link", usage: "link"},
+	{name: "unlink", usage: "unlink"},
+	{name: "status", usage: "status"},
+	{name: "adopt", args: 1, usage: "adopt <path>"},
+	{name: "encrypt", args: 1, usage: "encrypt <path>"},
+	{name: "restore", args: 1, usage: "restore <run-id>"},
+	{name: "prune", usage: "prune"},
+	{name: "doctor", usage: "doctor"},
+	{name: "relocate", usage: "relocate --from <old> --to <new>", required: func(o *cliOptions) bool { return o.from != "" && o.to != "" }},
+}
+
+// flagSpec describes a flag. Flags that take a value accept "--name value" and "--name=value";
+// boolean flags accept an optional "=y" or "=n" style value.
+type flagSpec struct {
+	long  string
+	short byte // 0 when the flag has no short form
+	value bool // Whether the flag requires a value
+	set   func(o *cliOptions, value string) error
+}
+
+// flags lists the supported flags. Every flag is accepted by every subcommand.
+var flags = []flagSpec{
+	{long: "help", short: 'h', set: boolFlag(func(o *cliOptions) *bool { return &o.help })},
+	{long: "version", set: boolFlag(func(o *cliOptions) *bool { return &o.version })},
+	{long: "force", set: boolFlag(func(o *cliOptions) *bool { return &o.force })},
+	{long: "backup", set: boolFlag(func(o *cliOptions) *bool { return &o.backup })},
+	{long: "verbose", short: 'v', set: boolFlag(func(o *cliOptions) *bool { return &o.verbose })},
+	{long: "dry-run", short: 'd', set: boolFlag(func(o *cliOptions) *bool { return &o.dryRun })},
+	{long: "yes", short: 'y', set: boolFlag(func(o *cliOptions) *bool { return &o.yes })},
+	{long: "relative", set: boolFlag(func(o *cliOptions) *bool { return &o.relative })},
+	{long: "fold", set: boolFlag(func(o *cliOptions) *bool { return &o.fold })},
+	{long: "root", value: true, set: stringFlag(func(o *cliOptions) *string { return &o.root })},
+	{long: "home", value: true, set: stringFlag(func(o *cliOptions) *string { return &o.home })},
+	{long: "ignore-file", value: true, set: stringFlag(func(o *cliOptions) *string { return &o.ignoreFile })},
+	{long: "mode", value: true, set: stringFlag(func(o *cliOptions) *string { return &o.mode })},
+	{long: "identity", value: true, set: stringFlag(func(o *cliOptions) *string { return &o.identity })},
+	{long: "host", value: true, set: stringFlag(func(o *cliOptions) *string { return &o.host })},
+	{long: "profile", value: true, set: stringFlag(func(o *cliOptions) *string { return &o.profile })},
+	{long: "from", value: true, set: stringFlag(func(o *cliOptions) *string { return &o.from })},
+	{long: "to", value: true, set: stringFlag(func(o *cliOptions) *string { return &o.to })},
+}
+
+// boolFlag returns a setter for a boolean flag. An empty value means the flag was given without one.
+func boolFlag(field func(o *cliOptions) *bool) func(o *cliOptions, value string) error {
+	return func(o *cliOptions, value string) error {
+		if value == "" {
+			*field(o) = true
+			return nil
+		}
+		switch strings.ToLower(value) {
+		case "y", "yes", "true", "1":
+			*field(o) = true
+		case "n", "no", "false", "0":
+			*field(o) = false
+		default:
+			return fmt.Errorf("invalid value %q, expected y or n", value)
+		}
+		return nil
+	}
+}
+
+// stringFlag returns a setter for a flag that takes a non-empty string value.
+func stringFlag(field func(o *cliOptions) *string) func(o *cliOptions, value string) error {
+	return func(o *cliOptions, value string) error {
+		if value == "" {
+			return fmt.Errorf("value must not be empty")
+		}
+		*field(o) = value
+		return nil
+	}
+}
+
+// parseArgs parses the command line arguments, excluding the program name.
+// Flags may appear before or after the subcommand, short boolean flags may be combined ("-vd"),
+// and every argument after "--" is treated as positional.
+func parseArgs(args []string) (*cliOptions, error) {
+	opts := &cliOptions{}
+	var positional []string
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			positional = append(positional, args[i+1:]...)
+			i = len(args)
+		case strings.HasPrefix(arg, "--"):
+			name, value, hasValue := strings.Cut(arg[2:], "=")
+			spec := findLongFlag(name)
+			if spec == nil {
+				return nil, fmt.Errorf("unknown flag: --%s", name)
+			}
+			if spec.value && !hasValue {
+				if i+1 >= len(args) {
+					return nil, fmt.Errorf("flag --%s requires a value", name)
+				}
+				i++
+				value = args[i]
+			}
+			if hasValue && value == "" && !spec.value {
+				return nil, fmt.Errorf("flag --%s: value must not be empty", name)
+			}
+			if err := spec.set(opts, value); err != nil {
+				return nil, fmt.Errorf("flag --%s: %w", name, err)
+			}
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			for j := 1; j < len(arg); j++ {
+				spec := findShortFlag(arg[j])
+				if spec == nil {
+					return nil, fmt.Errorf("unknown flag: -%c", arg[j])
+				}
+				if spec.value {
+					return nil, fmt.Errorf("flag -%c requires a value", arg[j])
+				}
+				if err := spec.set(opts, ""); err != nil {
+					return nil, fmt.Errorf("flag -%c: %w", arg[j], err)
+				}
+			}
+		default:
+			positional = append(positional, arg)
+		}
+	}
+
+	opts.command = "link"
+	if len(positional) > 0 {
+		opts.command = strings.ToLower(positional[0])
+		opts.commandArgs = positional[1:]
+	}
+
+	// Help and version are shown regardless of the rest of the command line
+	if opts.help || opts.version {
+		return opts, nil
+	}
+
+	spec := findCommand(opts.command)
+	if spec == nil {
+		return nil, fmt.Errorf("unknown command: %s", opts.command)
+	}
+	if len(opts.commandArgs) != spec.args || (spec.required != nil && !spec.required(opts)) {
+		return nil, fmt.Errorf("usage: %s", spec.usage)
+	}
+	return opts, nil
+}
+
+// findLongFlag returns the flag with the given long name, or nil.
+func findLongFlag(name string) *flagSpec {
+	for i := range flags {
+		if flags[i].long == name {
+			return &flags[i]
+		}
+	}
+	return nil
+}
+
+// findShortFlag returns the flag with the given short name, or nil.
+func findShortFlag(name byte) *flagSpec {
+	for i := range flags {
+		if flags[i].short != 0 && flags[i].short == name {
+			return &flags[i]
+		}
+	}
+	return nil
+}
+
+// findCommand returns the subcommand with the given name, or nil.
+func findCommand(name string) *commandSpec {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected cliOptions
+	}{
+		{"No arguments links", nil, cliOptions{command: "link"}},
+		{"Legacy force value", []string{"--force=y"}, cliOptions{command: "link", force: true}},
+		{"Force without value", []string{"--force"}, cliOptions{command: "link", force: true}},
+		{"Force disabled", []string{"--force=n"}, cliOptions{command: "link"}},
+		{"Combined short flags", []string{"-vd"}, cliOptions{command: "link", verbose: true, dryRun: true}},
+		{"Flags after the command", []string{"unlink", "-v", "--dry-run"}, cliOptions{command: "unlink", verbose: true, dryRun: true}},
+		{"Command is case-insensitive", []string{"STATUS"}, cliOptions{command: "status"}},
+		{"Path flags with separate value", []string{"--root", "/repo", "--home", "/home/user", "--ignore-file", "ignore"},
+			cliOptions{command: "link", root: "/repo", home: "/home/user", ignoreFile: "ignore"}},
+		{"Path flags with inline value", []string{"status", "--root=/repo"}, cliOptions{command: "status", root: "/repo"}},
+		{"Command argument", []string{"adopt", "/home/user/.gitconfig"},
+			cliOptions{command: "adopt", commandArgs: []string{"/home/user/.gitconfig"}}},
+		{"Double dash ends flags", []string{"-v", "adopt", "--", "-weird"},
+			cliOptions{command: "adopt", commandArgs: []string{"-weird"}, verbose: true}},
+		{"Encrypt with an identity", []string{"encrypt", "/home/user/.netrc", "--identity", "/keys/age.txt"},
+			cliOptions{command: "encrypt", commandArgs: []string{"/home/user/.netrc"}, identity: "/keys/age.txt"}},
+		{"Host override", []string{"--host", "laptop"}, cliOptions{command: "link", host: "laptop"}},
+		{"Profile", []string{"status", "--profile=work"}, cliOptions{command: "status", profile: "work"}},
+		{"Relocate", []string{"relocate", "--from", "/old/dotfiles", "--to=/new/dotfiles"},
+			cliOptions{command: "relocate", from: "/old/dotfiles", to: "/new/dotfiles"}},
+		{"Help skips validation", []string{"adopt", "-h"}, cliOptions{command: "adopt", help: true}},
+		{"Version skips validation", []string{"unknown", "--version"}, cliOptions{command: "unknown", version: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := parseArgs(tt.args)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(opts.commandArgs) == 0 {
+				opts.commandArgs = nil
+			}
+			if !reflect.DeepEqual(*opts, tt.expected) {
+				t.Errorf("parseArgs(%q) = %+v; want %+v", tt.args, *opts, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseArgs_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		contains string
+	}{
+		{"Misspelled long flag", []string{"--forse=y"}, "unknown flag: --forse"},
+		{"Unknown short flag", []string{"-vx"}, "unknown flag: -x"},
+		{"Unknown command", []string{"lnk"}, "unknown command: lnk"},
+		{"Missing value", []string{"--root"}, "flag --root requires a value"},
+		{"Empty value", []string{"--home="}, "flag --home: value must not be empty"},
+		{"Invalid boolean value", []string{"--force=maybe"}, "flag --force: invalid value"},
+		{"Missing command argument", []string{"adopt"}, "usage: adopt <path>"},
+		{"Too many command arguments", []string{"restore", "a", "b"}, "usage: restore <run-id>"},
+		{"Unexpected command argument", []string{"status", "extra"}, "usage: status"},
+		{"Missing required flag", []string{"relocate", "--from", "/old"}, "usage: relocate --from <old> --to <new>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseArgs(tt.args)
+			if err == nil {
+				t.Fatalf("Expected error for %q", tt.args)
+			}
+			if !strings.Contains(err.Error(), tt.contains) {
+				t.Errorf("Expected error containing %q, got %q", tt.contains, err.Error())
+			}
+		})
+	}
+}
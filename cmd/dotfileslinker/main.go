@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -17,43 +18,141 @@ var (
 )
 
 func main() {
-	args := os.Args[1:]
-
-	// parse args
-	showHelp := containsFlag(args, "--help", "-h")
-	showVersion := containsFlag(args, "--version")
-	forceOverwrite := containsFlag(args, "--force=y")
-	verbose := containsFlag(args, "--verbose", "-v")
-	dryRun := containsFlag(args, "--dry-run", "-d")
+	opts, err := parseArgs(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		fmt.Fprintf(os.Stderr, "Run '%s --help' for usage.\n", filepath.Base(os.Args[0]))
+		os.Exit(2)
+	}
+	command := opts.command
+	commandArgs := opts.commandArgs
+	dryRun := opts.dryRun
 
 	// display help or version information and exit if requested
-	if showHelp {
+	if opts.help {
 		displayHelp()
 		return
 	}
-	if showVersion {
+	if opts.version {
 		displayVersion()
 		return
 	}
 
 	// build up
 	fs := infrastructure.NewDefaultFileSystem()
-	logger := service.NewConsoleLogger(verbose)
+	logger := service.NewConsoleLogger(opts.verbose)
 	svc := service.NewFileLinkerService(fs, logger)
 
-	// Get configuration from environment variables or use defaults
-	executionRoot := getEnvOrDefault("DOTFILES_ROOT", getCurrentDir())
-	userHome := getEnvOrDefault("DOTFILES_HOME", getUserHomeDir())
-	ignoreFileName := getEnvOrDefault("DOTFILES_IGNORE_FILE", "dotfiles_ignore")
+	// Get configuration from flags, then environment variables, then defaults
+	executionRoot := getOptionOrDefault(opts.root, "DOTFILES_ROOT", getCurrentDir())
+	userHome := getOptionOrDefault(opts.home, "DOTFILES_HOME", getUserHomeDir())
+	// Links point into the repository, so relative paths are resolved against the working directory first
+	if executionRoot, err = filepath.Abs(executionRoot); err == nil {
+		userHome, err = filepath.Abs(userHome)
+	}
+	if err != nil {
+		handleError(logger, err)
+		os.Exit(1)
+	}
+	ignoreFileName := getOptionOrDefault(opts.ignoreFile, "DOTFILES_IGNORE_FILE", "dotfiles_ignore")
+	stateDir := getStateDir(userHome)
+	backupDir := filepath.Join(stateDir, "backups")
+	svc.SetManifestPath(filepath.Join(stateDir, "manifest.json"))
+	svc.SetIdentityPath(getOptionOrDefault(opts.identity, "DOTFILES_AGE_IDENTITY", filepath.Join(getConfigDir(userHome), "identity.txt")))
+	if host := getOptionOrDefault(opts.host, "DOTFILES_HOST", ""); host != "" {
+		svc.SetHostname(host)
+		logger.Info(fmt.Sprintf("Host: %s", host))
+	}
+	if profile := getOptionOrDefault(opts.profile, "DOTFILES_PROFILE", ""); profile != "" {
+		svc.SetProfile(profile)
+		logger.Info(fmt.Sprintf("Profile: %s", profile))
+	}
 
+	logger.Info(fmt.Sprintf("Command: %s", command))
 	logger.Info(fmt.Sprintf("Execution root: %s", executionRoot))
 	logger.Info(fmt.Sprintf("User home: %s", userHome))
 	logger.Info(fmt.Sprintf("Ignore file: %s", ignoreFileName))
-	logger.Info(fmt.Sprintf("Force overwrite: %v", forceOverwrite))
+	logger.Info(fmt.Sprintf("Force overwrite: %v", opts.force))
+	logger.Info(fmt.Sprintf("Backup: %v", opts.backup))
 	logger.Info(fmt.Sprintf("Dry run: %v", dryRun))
 
 	// execute
-	err := svc.LinkDotfiles(executionRoot, userHome, ignoreFileName, forceOverwrite, dryRun)
+	switch command {
+	case "unlink":
+		_, err = svc.UnlinkDotfiles(executionRoot, userHome, ignoreFileName, dryRun)
+	case "adopt":
+		var path string
+		path, err = filepath.Abs(commandArgs[0])
+		if err == nil {
+			_, err = svc.Adopt(executionRoot, userHome, path, dryRun)
+		}
+	case "encrypt":
+		var path string
+		path, err = filepath.Abs(commandArgs[0])
+		if err == nil {
+			_, err = svc.Encrypt(executionRoot, userHome, path, dryRun)
+		}
+	case "status":
+		var statuses []service.LinkStatus
+		statuses, err = svc.Status(executionRoot, userHome, ignoreFileName)
+		if err != nil {
+			break
+		}
+		var mismatches []service.AttributeMismatch
+		mismatches, err = svc.AttributeMismatches(executionRoot, userHome, ignoreFileName)
+		if err == nil {
+			displayStatus(statuses)
+			displayAttributeMismatches(mismatches)
+			return
+		}
+	case "doctor":
+		if !displayDoctor(svc.Doctor(executionRoot, userHome, ignoreFileName)) {
+			os.Exit(1)
+		}
+		return
+	case "prune":
+		var stale []service.StaleLink
+		stale, err = svc.FindStaleLinks(executionRoot, userHome, ignoreFileName)
+		if err != nil {
+			break
+		}
+		if len(stale) == 0 {
+			logger.Success("No stale links found.")
+			return
+		}
+		displayStaleLinks(stale)
+		if !dryRun && !opts.yes && !confirm(fmt.Sprintf("Remove %d stale links?", len(stale))) {
+			fmt.Println("Prune cancelled.")
+			return
+		}
+		_, err = svc.Prune(executionRoot, stale, dryRun)
+	case "restore":
+		_, err = svc.Restore(executionRoot, backupDir, commandArgs[0], dryRun)
+	case "relocate":
+		var from, to string
+		if from, err = filepath.Abs(opts.from); err != nil {
+			break
+		}
+		if to, err = filepath.Abs(opts.to); err != nil {
+			break
+		}
+		_, err = svc.Relocate(from, to, userHome, ignoreFileName, dryRun)
+	default:
+		linkOpts := service.LinkOptions{BackupDir: backupDir, DryRun: dryRun, Relative: opts.relative, Fold: opts.fold}
+		if opts.mode != "" {
+			linkOpts.Mode, err = service.ParseLinkMode(opts.mode)
+			if err != nil {
+				break
+			}
+		}
+		switch {
+		case opts.backup:
+			linkOpts.Conflict = service.ConflictBackup
+		case opts.force:
+			linkOpts.Conflict = service.ConflictOverwrite
+		}
+		err = svc.LinkDotfilesWithOptions(executionRoot, userHome, ignoreFileName, linkOpts)
+	}
 	if err != nil {
 		handleError(logger, err)
 		os.Exit(1)
@@ -64,6 +163,87 @@ func main() {
 	}
 }
 
+// displayStatus prints the state of each planned link followed by a count per state
+func displayStatus(statuses []service.LinkStatus) {
+	counts := make(map[service.LinkState]int)
+	for _, status := range statuses {
+		counts[status.State]++
+		switch status.State {
+		case service.LinkStateWrongTarget, service.LinkStateDangling:
+			fmt.Printf("%-12s %s -> %s (expected %s)\n", status.State, status.Target, status.LinkTarget, status.Source)
+		default:
+			fmt.Printf("%-12s %s -> %s\n", status.State, status.Target, status.Source)
+		}
+	}
+
+	var summary []string
+	for _, state := range []service.LinkState{
+		service.LinkStateLinked,
+		service.LinkStateMissing,
+		service.LinkStateConflict,
+		service.LinkStateWrongTarget,
+		service.LinkStateDangling,
+	} {
+		summary = append(summary, fmt.Sprintf("%d %s", counts[state], state))
+	}
+	// Copy states only appear when --mode=copy was used, so they are listed only when present
+	for _, state := range []service.LinkState{
+		service.LinkStateModified,
+		service.LinkStateOutdated,
+		service.LinkStateDiverged,
+	} {
+		if counts[state] > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", counts[state], state))
+		}
+	}
+	fmt.Printf("\n%d targets: %s\n", len(statuses), strings.Join(summary, ", "))
+}
+
+// displayAttributeMismatches prints the managed paths whose permissions differ from dotfiles_attributes
+func displayAttributeMismatches(mismatches []service.AttributeMismatch) {
+	if len(mismatches) == 0 {
+		return
+	}
+	fmt.Println()
+	for _, mismatch := range mismatches {
+		fmt.Printf("%-12s %s: %s, expected %s\n", "mismatch", mismatch.Path, mismatch.Actual, mismatch.Expected)
+	}
+	fmt.Printf("\n%d paths differ from %s\n", len(mismatches), service.AttributesFileName)
+}
+
+// displayDoctor prints the result of every check with its suggested fix, and reports whether none failed
+func displayDoctor(results []service.CheckResult) bool {
+	counts := make(map[service.CheckStatus]int)
+	for _, result := range results {
+		counts[result.Status]++
+		fmt.Printf("[%s] %s: %s\n", result.Status, result.Name, result.Message)
+		if result.Fix != "" {
+			fmt.Printf("       fix: %s\n", result.Fix)
+		}
+	}
+	fmt.Printf("\n%d checks: %d pass, %d warn, %d fail\n", len(results), counts[service.CheckPass], counts[service.CheckWarn], counts[service.CheckFail])
+	return counts[service.CheckFail] == 0
+}
+
+// displayStaleLinks prints each stale link and the missing source it points to
+func displayStaleLinks(stale []service.StaleLink) {
+	for _, link := range stale {
+		fmt.Printf("stale        %s -> %s\n", link.Target, link.LinkTarget)
+	}
+	fmt.Println()
+}
+
+// confirm asks a yes/no question on the terminal and reports whether the answer was yes
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N]: ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
 // handleError logs errors based on their type
 func handleError(logger service.Logger, err error) {
 	switch {
@@ -80,16 +260,12 @@ func handleError(logger service.Logger, err error) {
 	}
 }
 
-// containsFlag checks if args contains any of the specified flags
-func containsFlag(args []string, flags ...string) bool {
-	for _, arg := range args {
-		for _, flag := range flags {
-			if strings.EqualFold(arg, flag) {
-				return true
-			}
-		}
+// getOptionOrDefault returns the flag value when set, otherwise the environment variable or the default value
+func getOptionOrDefault(option string, key string, defaultValue string) string {
+	if option != "" {
+		return option
 	}
-	return false
+	return getEnvOrDefault(key, defaultValue)
 }
 
 // getEnvOrDefault gets an environment variable or returns a default value if not set
@@ -101,6 +277,18 @@ func getEnvOrDefault(key, defaultValue string) string {
 	return value
 }
 
+// getConfigDir gets the directory for user configuration such as the age identity ($XDG_CONFIG_HOME/dotfileslinker)
+func getConfigDir(userHome string) string {
+	configHome := getEnvOrDefault("XDG_CONFIG_HOME", filepath.Join(userHome, ".config"))
+	return filepath.Join(configHome, "dotfileslinker")
+}
+
+// getStateDir gets the directory for persistent state such as backups and the manifest ($XDG_STATE_HOME/dotfileslinker)
+func getStateDir(userHome string) string {
+	stateHome := getEnvOrDefault("XDG_STATE_HOME", filepath.Join(userHome, ".local", "state"))
+	return filepath.Join(stateHome, "dotfileslinker")
+}
+
 // getCurrentDir gets the current working directory
 func getCurrentDir() string {
 	dir, err := os.Getwd()
@@ -129,14 +317,40 @@ func displayHelp() {
 	appName := filepath.Base(os.Args[0])
 	fmt.Printf(`Dotfiles Linker - A utility to link dotfiles from a repository to your home directory
 
-Usage: %s [options]
+Usage: %s [command] [options]
+
+Commands:
+  link               Link dotfiles from the repository (default)
+  unlink             Remove links that point into the repository
+  status             Show the state of every planned link without changing anything
+  adopt <path>       Move an existing file or directory into the repository and link it back
+  encrypt <path>     Move a file into the repository encrypted with age and keep it as the decrypted target
+  restore <run-id>   Put back the targets backed up by --backup during the given run
+  prune              Remove links into the repository whose source no longer exists
+  relocate --from <old> --to <new>
+                     Point links into a repository moved from <old> to <new> to the new location
+  doctor             Check the environment for problems that would make linking fail
 
 Options:
   --help, -h         Display this help message
-  --force=y          Overwrite existing files or directories
+  --force, --force=y Overwrite existing files or directories
+  --backup           Move existing files or directories into a backup directory instead of deleting them
   --verbose, -v      Display detailed information during execution
   --version          Display version information
   --dry-run, -d      Simulate the operations without making any changes
+  --yes, -y          Do not ask for confirmation before pruning
+  --root <dir>       Directory containing dotfiles (overrides DOTFILES_ROOT)
+  --home <dir>       Target home directory (overrides DOTFILES_HOME)
+  --ignore-file <name>
+                     Name of ignore file (overrides DOTFILES_IGNORE_FILE)
+  --mode <mode>      How files are deployed: symlink (default), copy or hardlink
+  --relative         Point symlinks to the repository by a path relative to the link
+  --fold             Link HOME and ROOT directories that do not exist yet as a whole
+  --identity <file>  age identity used for encrypted files (overrides DOTFILES_AGE_IDENTITY)
+  --host <name>      Hostname that selects HOST/<name>/ overlays and templates see (overrides DOTFILES_HOST)
+  --profile <name>   Profile in profiles/<name>/ layered over HOME and ROOT (overrides DOTFILES_PROFILE)
+
+  Short flags can be combined (-vd). Arguments after -- are never read as flags.
 
 Description:
   This utility creates symbolic links from files in the current directory
@@ -147,21 +361,68 @@ Directory Structure:
   - Files in the HOME/ directory will be linked to the same relative path in $HOME
   - Files in the ROOT/ directory will be linked to the same relative path in /
     (Only available on Linux/macOS)
+  - Files in HOME.<os>/ and ROOT.<os>/ (such as HOME.linux or HOME.darwin) are only linked
+    on that OS and take precedence over the same path in HOME/ and ROOT/
+  - Files in HOST/<hostname>/HOME/ and HOST/<hostname>/ROOT/ are only linked on that machine
+    and take precedence over both; --verbose shows which directory supplied each target
+  - With --profile, files in profiles/<name>/HOME/ and profiles/<name>/ROOT/ take precedence over
+    HOME/ and ROOT/ and their OS directories, and over the profiles listed in profiles/<name>/inherits
+  - Names with conditions such as '.gitconfig##os.linux,host.buildbox' or 'config##default' are
+    alternates: only the best match for the user, host, profile, OS and architecture is linked,
+    without the conditions
+  - Files ending in .tmpl are rendered as Go templates and written without the suffix,
+    using variables from 'dotfiles_data.json'
+  - Files ending in .age are decrypted with the age identity and written without the suffix,
+    readable only by you
 
 Ignore File:
   Files listed in 'dotfiles_ignore' will be excluded from linking
 
+Attributes File:
+  Lines in 'dotfiles_attributes' such as '~/.ssh dirmode=0700' or '~/.ssh/* mode=0600'
+  set the mode of target directories and of copied or rendered files, and owner= and
+  group= of ROOT targets. status reports paths whose permissions differ
+
+Inject File:
+  Targets matching a line in 'dotfiles_inject' such as '~/.bashrc' stay regular files and
+  keep the source between '# >>> dotfileslinker >>>' and '# <<< dotfileslinker <<<' lines,
+  preserving content written by other tools
+
+Include File:
+  Targets matching a line in 'dotfiles_include' such as '~/.gitconfig' or '~/.ssh/config'
+  get an include directive of the source (git, ssh, vim or tmux) instead of a link
+
+Mappings File:
+  Lines in 'dotfiles_mappings' such as 'XDG_CONFIG ${XDG_CONFIG_HOME:-~/.config}' or
+  'TOOLS /opt/tools os=linux recursive=n' link more repository directories, with their
+  overlays, to a destination; lines for HOME and ROOT replace their destinations
+
 Environment Variables:
   DOTFILES_ROOT            Directory containing dotfiles (default: current directory)
   DOTFILES_HOME            Target home directory (default: user's home directory)
   DOTFILES_IGNORE_FILE     Name of ignore file (default: dotfiles_ignore)
+  DOTFILES_AGE_IDENTITY    age identity file (default: $XDG_CONFIG_HOME/dotfileslinker/identity.txt)
+  DOTFILES_HOST            Hostname that selects host overlays (default: the machine's hostname)
+  DOTFILES_PROFILE         Profile to link (default: none)
+  XDG_STATE_HOME           Base directory for backups and the manifest (default: $HOME/.local/state)
+  XDG_CONFIG_HOME          Base directory for the age identity (default: $HOME/.config)
 
 Examples:
   %s              # Link dotfiles using default settings
   %s --force=y    # Overwrite any existing files
   %s --verbose    # Show detailed information
   %s --dry-run    # Simulate the operations
-`, appName, appName, appName, appName, appName)
+  %s unlink       # Remove links created from the repository
+  %s status       # Report linked, missing and conflicting targets
+  %s adopt ~/.gitconfig   # Start managing an existing file
+  %s --backup     # Back up existing files before linking
+  %s prune --dry-run      # List links left behind by removed files
+  %s status --root ~/dotfiles   # Check a repository outside the current directory
+  %s doctor       # Diagnose permissions and configuration before the first link
+  %s --mode=copy  # Copy files instead of linking them and track changes
+  %s encrypt ~/.netrc     # Commit a secret in encrypted form
+  %s relocate --from ~/dotfiles --to ~/src/dotfiles   # Repair links after moving the repository
+`, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName)
 }
 
 // displayVersion displays version information for the application
@@ -1,6 +1,11 @@
 package infrastructure
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -46,6 +51,11 @@ func (dfs *DefaultFileSystem) Delete(path string) error {
 	return os.Remove(path)
 }
 
+// DeleteAll deletes the specified file or directory and everything it contains.
+func (dfs *DefaultFileSystem) DeleteAll(path string) error {
+	return os.RemoveAll(path)
+}
+
 // CreateFileSymlink creates a symbolic link to a file at the specified path.
 func (dfs *DefaultFileSystem) CreateFileSymlink(linkPath string, target string) error {
 	return os.Symlink(target, linkPath)
@@ -56,6 +66,25 @@ func (dfs *DefaultFileSystem) CreateDirectorySymlink(linkPath string, target str
 	return os.Symlink(target, linkPath)
 }
 
+// CreateHardLink creates a hard link to a file at the specified path.
+func (dfs *DefaultFileSystem) CreateHardLink(linkPath string, target string) error {
+	return os.Link(target, linkPath)
+}
+
+// SameFile determines whether two paths refer to the same file, such as two hard links to one inode.
+// Symbolic links are not followed.
+func (dfs *DefaultFileSystem) SameFile(a string, b string) (bool, error) {
+	infoA, err := os.Lstat(a)
+	if err != nil {
+		return false, err
+	}
+	infoB, err := os.Lstat(b)
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(infoA, infoB), nil
+}
+
 // EnumerateFiles enumerates files that match a specific pattern in a specified directory.
 func (dfs *DefaultFileSystem) EnumerateFiles(root string, pattern string, recursive bool) ([]string, error) {
 	var files []string
@@ -88,6 +117,27 @@ func (dfs *DefaultFileSystem) EnumerateFiles(root string, pattern string, recurs
 	return files, err
 }
 
+// EnumerateSymlinks enumerates the symbolic links below the specified directory, recursively.
+// Linked directories are not followed, and subdirectories that cannot be read are skipped.
+func (dfs *DefaultFileSystem) EnumerateSymlinks(root string) ([]string, error) {
+	var links []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path != root && errors.Is(err, fs.ErrPermission) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+
+		if d.Type()&fs.ModeSymlink != 0 {
+			links = append(links, path)
+		}
+		return nil
+	})
+
+	return links, err
+}
+
 // EnsureDirectory creates a directory at the specified path if it does not already exist.
 func (dfs *DefaultFileSystem) EnsureDirectory(path string) error {
 	if dfs.DirectoryExists(path) {
@@ -113,3 +163,215 @@ func (dfs *DefaultFileSystem) ReadAllLines(path string) ([]string, error) {
 
 	return lines, nil
 }
+
+// WriteAllLines writes the lines to the specified file, replacing any existing content.
+func (dfs *DefaultFileSystem) WriteAllLines(path string, lines []string) error {
+	content := strings.Join(lines, "\n")
+	if len(lines) > 0 {
+		content += "\n"
+	}
+	return os.WriteFile(path, []byte(content), 0644)
+}
+
+// ReadFile reads the whole content of the specified file.
+func (dfs *DefaultFileSystem) ReadFile(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+// WriteFile atomically replaces the content of the specified file
+// by writing a temporary file in the same directory and renaming it over the original.
+func (dfs *DefaultFileSystem) WriteFile(path string, data []byte) error {
+	return writeFileAtomically(path, data, 0644)
+}
+
+// WritePrivateFile atomically replaces the content of the specified file with a file only its owner can access.
+// The temporary file is created with mode 0600, so the content is never readable by others.
+func (dfs *DefaultFileSystem) WritePrivateFile(path string, data []byte) error {
+	return writeFileAtomically(path, data, 0600)
+}
+
+// UpdateFile atomically replaces the content of the specified file, keeping the mode and owner of an existing file.
+// When the owner cannot be given to the replacement, such as for a file of another user, the file is rewritten in place.
+func (dfs *DefaultFileSystem) UpdateFile(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return writeFileAtomically(path, data, 0644)
+	}
+	if err != nil {
+		return err
+	}
+
+	ownerKept := true
+	err = writeFileAtomically(path, data, info.Mode().Perm(), func(tmpName string) error {
+		if err := keepOwner(tmpName, info); err != nil {
+			ownerKept = false
+			return err
+		}
+		return nil
+	})
+	if !ownerKept {
+		return os.WriteFile(path, data, info.Mode().Perm())
+	}
+	return err
+}
+
+// writeFileAtomically writes data to a temporary file in the same directory as path,
+// sets its mode, runs the optional prepare functions on it and renames it over path.
+func writeFileAtomically(path string, data []byte, mode os.FileMode, prepare ...func(tmpName string) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Chmod(tmpName, mode); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	for _, fn := range prepare {
+		if err := fn(tmpName); err != nil {
+			os.Remove(tmpName)
+			return err
+		}
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
+
+// CopyFile atomically replaces the destination with a copy of the source file, keeping its permissions.
+func (dfs *DefaultFileSystem) CopyFile(source string, destination string) error {
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(destination), "."+filepath.Base(destination)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	tmp.Close()
+
+	if err := copyFileContents(source, tmpName, info.Mode().Perm()); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, destination); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
+
+// FileHash returns the hex-encoded SHA-256 hash of the content of the specified file.
+func (dfs *DefaultFileSystem) FileHash(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// GetMode returns the permission bits of the specified file or directory.
+func (dfs *DefaultFileSystem) GetMode(path string) (fs.FileMode, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Mode().Perm(), nil
+}
+
+// SetMode sets the permission bits of the specified file or directory.
+func (dfs *DefaultFileSystem) SetMode(path string, mode fs.FileMode) error {
+	return os.Chmod(path, mode)
+}
+
+// Move moves a file or directory to a new path.
+// When the destination is on another device, the source is copied first and removed only after the copy succeeded,
+// so a failure never leaves both copies missing.
+func (dfs *DefaultFileSystem) Move(source string, destination string) error {
+	err := os.Rename(source, destination)
+	if err == nil || !isCrossDevice(err) {
+		return err
+	}
+
+	// Cross-device move: copy, then remove the source
+	if err := copyTree(source, destination); err != nil {
+		_ = os.RemoveAll(destination)
+		return err
+	}
+	return os.RemoveAll(source)
+}
+
+// copyTree copies a file, symbolic link or directory tree while preserving permissions.
+func copyTree(source string, destination string) error {
+	return filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(destination, rel)
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		default:
+			return copyFileContents(path, target, info.Mode().Perm())
+		}
+	})
+}
+
+// copyFileContents copies the contents of a regular file and applies the given permissions.
+func copyFileContents(source string, destination string, perm os.FileMode) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(destination, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chmod(destination, perm)
+}
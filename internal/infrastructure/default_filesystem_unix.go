@@ -0,0 +1,143 @@
+//go:build !windows
+
+package infrastructure
+
+import (
+	"errors"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// IsWritable determines whether the current user can create entries in the specified directory.
+func (dfs *DefaultFileSystem) IsWritable(path string) bool {
+	if !dfs.DirectoryExists(path) {
+		return false
+	}
+	// W_OK|X_OK: creating an entry needs write and search permission on the directory
+	return syscall.Access(path, 0x2|0x1) == nil
+}
+
+// IsOwnedByCurrentUser determines whether the specified path is owned by the current user.
+func (dfs *DefaultFileSystem) IsOwnedByCurrentUser(path string) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false, errors.New("file owner is not available on this platform")
+	}
+	return int(stat.Uid) == os.Geteuid(), nil
+}
+
+// SameDevice determines whether two existing paths are on the same file system.
+func (dfs *DefaultFileSystem) SameDevice(a string, b string) (bool, error) {
+	devA, err := deviceOf(a)
+	if err != nil {
+		return false, err
+	}
+	devB, err := deviceOf(b)
+	if err != nil {
+		return false, err
+	}
+	return devA == devB, nil
+}
+
+// deviceOf returns the ID of the device that contains the specified path.
+func deviceOf(path string) (uint64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, errors.New("device is not available on this platform")
+	}
+	return uint64(stat.Dev), nil
+}
+
+// GetOwner returns the names of the user and group that own the specified path.
+// IDs without a name are returned as numbers.
+func (dfs *DefaultFileSystem) GetOwner(path string) (string, string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", "", err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", "", errors.New("file owner is not available on this platform")
+	}
+
+	owner := strconv.FormatUint(uint64(stat.Uid), 10)
+	if u, err := user.LookupId(owner); err == nil {
+		owner = u.Username
+	}
+	group := strconv.FormatUint(uint64(stat.Gid), 10)
+	if g, err := user.LookupGroupId(group); err == nil {
+		group = g.Name
+	}
+	return owner, group, nil
+}
+
+// SetOwner changes the user and group that own the specified path; an empty name leaves it unchanged.
+func (dfs *DefaultFileSystem) SetOwner(path string, owner string, group string) error {
+	uid, gid := -1, -1
+	if owner != "" {
+		id, err := lookupID(owner, func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		})
+		if err != nil {
+			return err
+		}
+		uid = id
+	}
+	if group != "" {
+		id, err := lookupID(group, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		})
+		if err != nil {
+			return err
+		}
+		gid = id
+	}
+	return os.Chown(path, uid, gid)
+}
+
+// lookupID resolves a user or group name to its numeric ID; numeric names are used as they are.
+func lookupID(name string, lookup func(name string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+	id, err := lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(id)
+}
+
+// keepOwner gives path the owner and group of the file described by info.
+func keepOwner(path string, info os.FileInfo) error {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return errors.New("file owner is not available on this platform")
+	}
+	if int(stat.Uid) == os.Geteuid() && int(stat.Gid) == os.Getegid() {
+		return nil
+	}
+	return os.Lchown(path, int(stat.Uid), int(stat.Gid))
+}
+
+// isCrossDevice reports whether err is the error of a rename to another file system.
+func isCrossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
@@ -0,0 +1,75 @@
+//go:build windows
+
+package infrastructure
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// IsWritable determines whether the current user can create entries in the specified directory.
+// Windows ACLs are not reflected in file modes, so a temporary file is created and removed to find out.
+func (dfs *DefaultFileSystem) IsWritable(path string) bool {
+	if !dfs.DirectoryExists(path) {
+		return false
+	}
+	probe, err := os.CreateTemp(path, ".dotfileslinker-probe-*")
+	if err != nil {
+		return false
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return true
+}
+
+// IsOwnedByCurrentUser determines whether the specified path is owned by the current user.
+// Ownership is not checked on Windows, so any existing path is reported as owned.
+func (dfs *DefaultFileSystem) IsOwnedByCurrentUser(path string) (bool, error) {
+	if _, err := os.Stat(path); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SameDevice determines whether two existing paths are on the same file system.
+// Windows hard links cannot cross volumes, so the volume names of the absolute paths are compared.
+func (dfs *DefaultFileSystem) SameDevice(a string, b string) (bool, error) {
+	volumes := make([]string, 0, 2)
+	for _, path := range []string{a, b} {
+		if _, err := os.Stat(path); err != nil {
+			return false, err
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return false, err
+		}
+		volumes = append(volumes, filepath.VolumeName(abs))
+	}
+	return strings.EqualFold(volumes[0], volumes[1]), nil
+}
+
+// GetOwner returns an error because ownership is not available on Windows.
+func (dfs *DefaultFileSystem) GetOwner(path string) (string, string, error) {
+	return "", "", errors.New("file owner is not available on Windows")
+}
+
+// SetOwner returns an error because ownership cannot be changed on Windows.
+func (dfs *DefaultFileSystem) SetOwner(path string, owner string, group string) error {
+	return errors.New("file owner cannot be changed on Windows")
+}
+
+// keepOwner does nothing on Windows, where a replaced file is owned by the user who writes it.
+func keepOwner(path string, info os.FileInfo) error {
+	return nil
+}
+
+// errorNotSameDevice is ERROR_NOT_SAME_DEVICE, returned when a file is renamed to another volume.
+const errorNotSameDevice syscall.Errno = 0x11
+
+// isCrossDevice reports whether err is the error of a rename to another volume.
+func isCrossDevice(err error) bool {
+	return errors.Is(err, errorNotSameDevice)
+}
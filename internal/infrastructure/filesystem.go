@@ -1,5 +1,7 @@
 package infrastructure
 
+import "io/fs"
+
 // FileSystem provides an abstraction for file system operations to support testing and platform-specific behavior.
 type FileSystem interface {
 	// FileExists determines whether the specified file exists.
@@ -15,6 +17,10 @@ type FileSystem interface {
 	// Delete deletes the specified file or empty directory.
 	Delete(path string) error
 
+	// DeleteAll deletes the specified file or directory and everything it contains.
+	// Symbolic links are removed without following them.
+	DeleteAll(path string) error
+
 	// CreateFileSymlink creates a symbolic link to a file at the specified path.
 	CreateFileSymlink(linkPath string, target string) error
 
@@ -24,9 +30,71 @@ type FileSystem interface {
 	// EnumerateFiles enumerates files that match a specific pattern in a specified directory.
 	EnumerateFiles(root string, pattern string, recursive bool) ([]string, error)
 
+	// EnumerateSymlinks enumerates the symbolic links below the specified directory, recursively.
+	// Linked directories are not followed, and subdirectories that cannot be read are skipped.
+	EnumerateSymlinks(root string) ([]string, error)
+
 	// EnsureDirectory creates a directory at the specified path if it does not already exist.
 	EnsureDirectory(path string) error
 
 	// ReadAllLines reads all lines from the specified file.
 	ReadAllLines(path string) ([]string, error)
+
+	// WriteAllLines writes the lines to the specified file, replacing any existing content.
+	WriteAllLines(path string, lines []string) error
+
+	// ReadFile reads the whole content of the specified file.
+	ReadFile(path string) ([]byte, error)
+
+	// WriteFile atomically replaces the content of the specified file.
+	// Readers see either the old or the new content, never a partially written file.
+	WriteFile(path string, data []byte) error
+
+	// WritePrivateFile atomically replaces the content of the specified file like WriteFile,
+	// but the file is only readable and writable by its owner at every point.
+	WritePrivateFile(path string, data []byte) error
+
+	// UpdateFile atomically replaces the content of the specified file like WriteFile,
+	// but an existing file keeps its mode and owner. A missing file is created like WriteFile does.
+	UpdateFile(path string, data []byte) error
+
+	// CreateHardLink creates a hard link to a file at the specified path.
+	CreateHardLink(linkPath string, target string) error
+
+	// SameFile determines whether two paths refer to the same file, such as two hard links to one inode.
+	SameFile(a string, b string) (bool, error)
+
+	// SameDevice determines whether two existing paths are on the same file system, so that one can be hard linked to the other.
+	SameDevice(a string, b string) (bool, error)
+
+	// CopyFile atomically replaces the destination with a copy of the source file, keeping its permissions.
+	CopyFile(source string, destination string) error
+
+	// FileHash returns the hex-encoded SHA-256 hash of the content of the specified file.
+	FileHash(path string) (string, error)
+
+	// IsWritable determines whether the current user can create entries in the specified directory.
+	IsWritable(path string) bool
+
+	// IsOwnedByCurrentUser determines whether the specified path is owned by the current user.
+	// Ownership is not checked on Windows, where it always returns true for an existing path.
+	IsOwnedByCurrentUser(path string) (bool, error)
+
+	// GetMode returns the permission bits of the specified file or directory.
+	GetMode(path string) (fs.FileMode, error)
+
+	// SetMode sets the permission bits of the specified file or directory.
+	SetMode(path string, mode fs.FileMode) error
+
+	// GetOwner returns the names of the user and group that own the specified path.
+	// Ownership is not available on Windows, where it returns an error.
+	GetOwner(path string) (owner string, group string, err error)
+
+	// SetOwner changes the user and group that own the specified path; an empty name leaves it unchanged.
+	// Names may also be numeric IDs. Ownership cannot be changed on Windows, where it returns an error.
+	SetOwner(path string, owner string, group string) error
+
+	// Move moves a file or directory to a new path.
+	// When the destination is on another device, the source is copied first and removed only after the copy succeeded.
+	Move(source string, destination string) error
 }
@@ -1,19 +1,29 @@
 package infrastructure
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"io/fs"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
 // MockFileSystem implements FileSystem interface for testing purposes
 type MockFileSystem struct {
-	Files            map[string]string   // Map of path to file content
-	Directories      map[string]bool     // Map of existing directories
-	SymLinks         map[string]string   // Map of symlink paths to targets
-	FileEnumerations map[string][]string // Map of path pattern to enumerated files
-	ErrorResponses   map[string]error    // Map of operations to errors
-	OperationLog     []string            // Log of performed operations
+	Files            map[string]string      // Map of path to file content
+	Directories      map[string]bool        // Map of existing directories
+	SymLinks         map[string]string      // Map of symlink paths to targets
+	FileEnumerations map[string][]string    // Map of path pattern to enumerated files
+	ReadOnlyPaths    map[string]bool        // Directories the current user cannot write to
+	ForeignPaths     map[string]bool        // Paths owned by another user
+	HardLinks        map[string]string      // Map of hard link paths to the path they were linked to
+	Devices          map[string]string      // Map of mount points to device names; paths below no mount point are on ""
+	Modes            map[string]fs.FileMode // Map of paths to permission bits; files default to 0644 and directories to 0755
+	Owners           map[string]string      // Map of paths to "owner:group"; paths default to "user:user"
+	ErrorResponses   map[string]error       // Map of operations to errors
+	OperationLog     []string               // Log of performed operations
 }
 
 // NewMockFileSystem creates a new instance of MockFileSystem
@@ -23,6 +33,12 @@ func NewMockFileSystem() *MockFileSystem {
 		Directories:      make(map[string]bool),
 		SymLinks:         make(map[string]string),
 		FileEnumerations: make(map[string][]string),
+		ReadOnlyPaths:    make(map[string]bool),
+		ForeignPaths:     make(map[string]bool),
+		HardLinks:        make(map[string]string),
+		Devices:          make(map[string]string),
+		Modes:            make(map[string]fs.FileMode),
+		Owners:           make(map[string]string),
 		ErrorResponses:   make(map[string]error),
 	}
 }
@@ -57,10 +73,42 @@ func (m *MockFileSystem) Delete(path string) error {
 	if err, exists := m.ErrorResponses["Delete:"+path]; exists {
 		return err
 	}
+	if m.hasChildren(path) {
+		return errors.New("directory not empty")
+	}
 
 	delete(m.Files, path)
 	delete(m.Directories, path)
 	delete(m.SymLinks, path)
+	delete(m.HardLinks, path)
+	delete(m.Modes, path)
+	delete(m.Owners, path)
+	return nil
+}
+
+// DeleteAll removes a file or directory and everything below it
+func (m *MockFileSystem) DeleteAll(path string) error {
+	m.OperationLog = append(m.OperationLog, "DeleteAll: "+path)
+	if err, exists := m.ErrorResponses["DeleteAll:"+path]; exists {
+		return err
+	}
+
+	prefix := path + string(filepath.Separator)
+	for file := range m.Files {
+		if file == path || strings.HasPrefix(file, prefix) {
+			delete(m.Files, file)
+		}
+	}
+	for dir := range m.Directories {
+		if dir == path || strings.HasPrefix(dir, prefix) {
+			delete(m.Directories, dir)
+		}
+	}
+	for link := range m.SymLinks {
+		if link == path || strings.HasPrefix(link, prefix) {
+			delete(m.SymLinks, link)
+		}
+	}
 	return nil
 }
 
@@ -101,6 +149,27 @@ func (m *MockFileSystem) EnumerateFiles(root string, pattern string, recursive b
 	return []string{}, nil
 }
 
+// EnumerateSymlinks lists the symlinks below a directory in sorted order
+func (m *MockFileSystem) EnumerateSymlinks(root string) ([]string, error) {
+	m.OperationLog = append(m.OperationLog, "EnumerateSymlinks: "+root)
+	if err, exists := m.ErrorResponses["EnumerateSymlinks:"+root]; exists {
+		return nil, err
+	}
+
+	prefix := root + string(filepath.Separator)
+	if strings.HasSuffix(root, string(filepath.Separator)) {
+		prefix = root
+	}
+	var links []string
+	for link := range m.SymLinks {
+		if strings.HasPrefix(link, prefix) {
+			links = append(links, link)
+		}
+	}
+	sort.Strings(links)
+	return links, nil
+}
+
 // EnsureDirectory creates a directory if it doesn't exist
 func (m *MockFileSystem) EnsureDirectory(path string) error {
 	m.OperationLog = append(m.OperationLog, "EnsureDirectory: "+path)
@@ -127,9 +196,312 @@ func (m *MockFileSystem) ReadAllLines(path string) ([]string, error) {
 	return strings.Split(content, "\n"), nil
 }
 
+// WriteAllLines writes lines to a file
+func (m *MockFileSystem) WriteAllLines(path string, lines []string) error {
+	m.OperationLog = append(m.OperationLog, "WriteAllLines: "+path)
+	if err, exists := m.ErrorResponses["WriteAllLines:"+path]; exists {
+		return err
+	}
+
+	m.AddFile(path, strings.Join(lines, "\n"))
+	return nil
+}
+
+// ReadFile reads the content of a file
+func (m *MockFileSystem) ReadFile(path string) ([]byte, error) {
+	m.OperationLog = append(m.OperationLog, "ReadFile: "+path)
+	if err, exists := m.ErrorResponses["ReadFile:"+path]; exists {
+		return nil, err
+	}
+
+	content, exists := m.Files[path]
+	if !exists {
+		return nil, errors.New("file not found")
+	}
+	return []byte(content), nil
+}
+
+// WriteFile writes the content of a file
+func (m *MockFileSystem) WriteFile(path string, data []byte) error {
+	m.OperationLog = append(m.OperationLog, "WriteFile: "+path)
+	if err, exists := m.ErrorResponses["WriteFile:"+path]; exists {
+		return err
+	}
+
+	m.AddFile(path, string(data))
+	return nil
+}
+
+// UpdateFile writes the content of a file, keeping its recorded mode and owner
+func (m *MockFileSystem) UpdateFile(path string, data []byte) error {
+	m.OperationLog = append(m.OperationLog, "UpdateFile: "+path)
+	if err, exists := m.ErrorResponses["UpdateFile:"+path]; exists {
+		return err
+	}
+
+	mode, hasMode := m.Modes[path]
+	owner, hasOwner := m.Owners[path]
+	m.AddFile(path, string(data))
+	if hasMode {
+		m.Modes[path] = mode
+	}
+	if hasOwner {
+		m.Owners[path] = owner
+	}
+	return nil
+}
+
+// WritePrivateFile writes the content of a file and records mode 0600
+func (m *MockFileSystem) WritePrivateFile(path string, data []byte) error {
+	m.OperationLog = append(m.OperationLog, "WritePrivateFile: "+path)
+	if err, exists := m.ErrorResponses["WritePrivateFile:"+path]; exists {
+		return err
+	}
+
+	m.AddFile(path, string(data))
+	m.Modes[path] = 0600
+	return nil
+}
+
+// CreateHardLink creates a hard link to a file
+func (m *MockFileSystem) CreateHardLink(linkPath string, target string) error {
+	m.OperationLog = append(m.OperationLog, "CreateHardLink: "+linkPath+" -> "+target)
+	if err, exists := m.ErrorResponses["CreateHardLink:"+linkPath]; exists {
+		return err
+	}
+
+	content, exists := m.Files[target]
+	if !exists {
+		return errors.New("file not found")
+	}
+	m.AddFile(linkPath, content)
+	m.HardLinks[linkPath] = m.inode(target)
+	return nil
+}
+
+// SameFile checks if two paths are the same file or hard links to the same file
+func (m *MockFileSystem) SameFile(a string, b string) (bool, error) {
+	m.OperationLog = append(m.OperationLog, "SameFile: "+a+" "+b)
+	for _, path := range []string{a, b} {
+		if _, exists := m.Files[path]; !exists && !m.Directories[path] {
+			return false, errors.New("file not found")
+		}
+	}
+	return m.inode(a) == m.inode(b), nil
+}
+
+// SameDevice checks if two paths are below the same mount point in Devices
+func (m *MockFileSystem) SameDevice(a string, b string) (bool, error) {
+	m.OperationLog = append(m.OperationLog, "SameDevice: "+a+" "+b)
+	if err, exists := m.ErrorResponses["SameDevice:"+a]; exists {
+		return false, err
+	}
+	return m.device(a) == m.device(b), nil
+}
+
+// CopyFile copies the content of a file
+func (m *MockFileSystem) CopyFile(source string, destination string) error {
+	m.OperationLog = append(m.OperationLog, "CopyFile: "+source+" -> "+destination)
+	if err, exists := m.ErrorResponses["CopyFile:"+destination]; exists {
+		return err
+	}
+
+	content, exists := m.Files[source]
+	if !exists {
+		return errors.New("file not found")
+	}
+	delete(m.SymLinks, destination)
+	m.AddFile(destination, content)
+	if mode, exists := m.Modes[source]; exists {
+		m.Modes[destination] = mode
+	}
+	return nil
+}
+
+// FileHash returns the SHA-256 hash of the content of a file
+func (m *MockFileSystem) FileHash(path string) (string, error) {
+	m.OperationLog = append(m.OperationLog, "FileHash: "+path)
+	if err, exists := m.ErrorResponses["FileHash:"+path]; exists {
+		return "", err
+	}
+
+	content, exists := m.Files[path]
+	if !exists {
+		return "", errors.New("file not found")
+	}
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// IsWritable checks if a directory exists and is not marked read-only
+func (m *MockFileSystem) IsWritable(path string) bool {
+	m.OperationLog = append(m.OperationLog, "IsWritable: "+path)
+	return m.Directories[path] && !m.ReadOnlyPaths[path]
+}
+
+// IsOwnedByCurrentUser checks if a path exists and is not marked as owned by another user
+func (m *MockFileSystem) IsOwnedByCurrentUser(path string) (bool, error) {
+	m.OperationLog = append(m.OperationLog, "IsOwnedByCurrentUser: "+path)
+	if err, exists := m.ErrorResponses["IsOwnedByCurrentUser:"+path]; exists {
+		return false, err
+	}
+	_, isFile := m.Files[path]
+	if !isFile && !m.Directories[path] {
+		return false, errors.New("file not found")
+	}
+	return !m.ForeignPaths[path], nil
+}
+
+// GetMode returns the recorded permission bits of an existing file or directory
+func (m *MockFileSystem) GetMode(path string) (fs.FileMode, error) {
+	m.OperationLog = append(m.OperationLog, "GetMode: "+path)
+	if err, exists := m.ErrorResponses["GetMode:"+path]; exists {
+		return 0, err
+	}
+	if mode, exists := m.Modes[path]; exists {
+		return mode, nil
+	}
+	if _, isFile := m.Files[path]; isFile {
+		return 0644, nil
+	}
+	if m.Directories[path] {
+		return 0755, nil
+	}
+	return 0, errors.New("file not found")
+}
+
+// SetMode records the permission bits of an existing file or directory
+func (m *MockFileSystem) SetMode(path string, mode fs.FileMode) error {
+	m.OperationLog = append(m.OperationLog, "SetMode: "+path)
+	if err, exists := m.ErrorResponses["SetMode:"+path]; exists {
+		return err
+	}
+	if _, isFile := m.Files[path]; !isFile && !m.Directories[path] {
+		return errors.New("file not found")
+	}
+	m.Modes[path] = mode
+	return nil
+}
+
+// GetOwner returns the recorded owner and group of an existing path
+func (m *MockFileSystem) GetOwner(path string) (string, string, error) {
+	m.OperationLog = append(m.OperationLog, "GetOwner: "+path)
+	if err, exists := m.ErrorResponses["GetOwner:"+path]; exists {
+		return "", "", err
+	}
+	if _, isFile := m.Files[path]; !isFile && !m.Directories[path] {
+		return "", "", errors.New("file not found")
+	}
+	owner, group, _ := strings.Cut(m.Owners[path], ":")
+	if owner == "" {
+		owner = "user"
+	}
+	if group == "" {
+		group = "user"
+	}
+	return owner, group, nil
+}
+
+// SetOwner records the owner and group of an existing path; an empty name leaves it unchanged
+func (m *MockFileSystem) SetOwner(path string, owner string, group string) error {
+	m.OperationLog = append(m.OperationLog, "SetOwner: "+path)
+	if err, exists := m.ErrorResponses["SetOwner:"+path]; exists {
+		return err
+	}
+	currentOwner, currentGroup, err := m.GetOwner(path)
+	if err != nil {
+		return err
+	}
+	if owner == "" {
+		owner = currentOwner
+	}
+	if group == "" {
+		group = currentGroup
+	}
+	m.Owners[path] = owner + ":" + group
+	return nil
+}
+
+// Move moves a file or directory and everything below it, keeping their modes and owners
+func (m *MockFileSystem) Move(source string, destination string) error {
+	m.OperationLog = append(m.OperationLog, "Move: "+source+" -> "+destination)
+	if err, exists := m.ErrorResponses["Move:"+source]; exists {
+		return err
+	}
+
+	prefix := source + string(filepath.Separator)
+	rename := func(path string) (string, bool) {
+		if path == source {
+			return destination, true
+		}
+		if strings.HasPrefix(path, prefix) {
+			return filepath.Join(destination, strings.TrimPrefix(path, prefix)), true
+		}
+		return "", false
+	}
+
+	// Collect the renames first so that entries added during the move are not visited again
+	files := make(map[string]string)
+	for path, content := range m.Files {
+		if newPath, ok := rename(path); ok {
+			delete(m.Files, path)
+			files[newPath] = content
+		}
+	}
+	dirs := make(map[string]bool)
+	for path := range m.Directories {
+		if newPath, ok := rename(path); ok {
+			delete(m.Directories, path)
+			dirs[newPath] = true
+		}
+	}
+	links := make(map[string]string)
+	for path, target := range m.SymLinks {
+		if newPath, ok := rename(path); ok {
+			delete(m.SymLinks, path)
+			links[newPath] = target
+		}
+	}
+	modes := make(map[string]fs.FileMode)
+	for path, mode := range m.Modes {
+		if newPath, ok := rename(path); ok {
+			delete(m.Modes, path)
+			modes[newPath] = mode
+		}
+	}
+	owners := make(map[string]string)
+	for path, owner := range m.Owners {
+		if newPath, ok := rename(path); ok {
+			delete(m.Owners, path)
+			owners[newPath] = owner
+		}
+	}
+
+	for path, content := range files {
+		m.Files[path] = content
+	}
+	for path := range dirs {
+		m.Directories[path] = true
+	}
+	for path, target := range links {
+		m.SymLinks[path] = target
+	}
+	for path, mode := range modes {
+		m.Modes[path] = mode
+	}
+	for path, owner := range owners {
+		m.Owners[path] = owner
+	}
+	return nil
+}
+
 // AddFile adds a file to the mock filesystem
 func (m *MockFileSystem) AddFile(path string, content string) {
 	m.Files[path] = content
+	// A new file never shares its inode with a hard link created earlier, and has the default mode and owner
+	delete(m.HardLinks, path)
+	delete(m.Modes, path)
+	delete(m.Owners, path)
 	// When adding a file, ensure its directory exists
 	dir := filepath.Dir(path)
 	m.Directories[dir] = true
@@ -151,6 +523,46 @@ func (m *MockFileSystem) SetErrorForOperation(operation string, err error) {
 	m.ErrorResponses[operation] = err
 }
 
+// inode returns the path that identifies the file a path refers to, following recorded hard links
+func (m *MockFileSystem) inode(path string) string {
+	if original, exists := m.HardLinks[path]; exists {
+		return original
+	}
+	return path
+}
+
+// device returns the device of the longest mount point in Devices that contains path
+func (m *MockFileSystem) device(path string) string {
+	device, longest := "", -1
+	for mount, name := range m.Devices {
+		if (path == mount || strings.HasPrefix(path, mount+string(filepath.Separator))) && len(mount) > longest {
+			device, longest = name, len(mount)
+		}
+	}
+	return device
+}
+
+// hasChildren reports whether any file, directory or symlink exists below path
+func (m *MockFileSystem) hasChildren(path string) bool {
+	prefix := path + string(filepath.Separator)
+	for file := range m.Files {
+		if strings.HasPrefix(file, prefix) {
+			return true
+		}
+	}
+	for dir := range m.Directories {
+		if strings.HasPrefix(dir, prefix) {
+			return true
+		}
+	}
+	for link := range m.SymLinks {
+		if strings.HasPrefix(link, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 // getBoolStr converts a boolean to a string
 func getBoolStr(b bool) string {
 	if b {
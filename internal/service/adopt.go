@@ -0,0 +1,212 @@
+package service
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/guitarrapc/dotfileslinker-go/internal/util"
+)
+
+// Adopt moves an existing file or directory into the repository and links it back to its original location.
+// The repository path mirrors the layout LinkDotfiles uses: top-level dotfiles in the home directory go to the
+// repository root and everything else to the mapped directory whose destination holds it, such as HOME/ or ROOT/.
+// A directory is recreated with its original mode, and the attributes file applies as it does for LinkDotfiles.
+// If linking fails, the moved content is put back so the original is never lost.
+// repoRoot: The root directory of the dotfiles repository.
+// userHome: The user's home directory path.
+// path: The absolute path of the file or directory to adopt.
+// dryRun: If true, only shows what would be done without moving or linking anything.
+// Returns the path of the adopted content in the repository.
+func (s *FileLinkerService) Adopt(repoRoot string, userHome string, path string, dryRun bool) (string, error) {
+	if s.fs.GetLinkTarget(path) != "" {
+		return "", fmt.Errorf("'%s' is already a symbolic link", path)
+	}
+
+	isDir := s.fs.DirectoryExists(path)
+	if !isDir && !s.fs.FileExists(path) {
+		return "", fmt.Errorf("'%s' does not exist", path)
+	}
+
+	repoPath, err := s.adoptDestination(repoRoot, userHome, path, isDir)
+	if err != nil {
+		return "", err
+	}
+	if s.fs.FileExists(repoPath) || s.fs.DirectoryExists(repoPath) {
+		return "", fmt.Errorf("'%s' already exists in the repository", repoPath)
+	}
+
+	if dryRun {
+		s.logger.Success(fmt.Sprintf("[DRY-RUN] Would move %s to %s", path, repoPath))
+		s.logger.Success(fmt.Sprintf("[DRY-RUN] Would link %s -> %s", path, repoPath))
+		return repoPath, nil
+	}
+
+	if err := s.fs.EnsureDirectory(filepath.Dir(repoPath)); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	// The directories are recreated after the move, so read their modes first
+	var modes map[string]fs.FileMode
+	if isDir {
+		if modes, err = s.directoryModes(path); err != nil {
+			return "", err
+		}
+	}
+
+	s.logger.Success(fmt.Sprintf("Moving %s to %s", path, repoPath))
+	if err := s.fs.Move(path, repoPath); err != nil {
+		return "", fmt.Errorf("failed to move '%s' into the repository: %w", path, err)
+	}
+
+	plan, linkErr := s.planAdoption(repoRoot, userHome, repoPath, path, isDir, modes)
+	if linkErr == nil {
+		linkErr = s.Apply(plan)
+	}
+	if linkErr != nil {
+		s.logger.Error(fmt.Sprintf("Linking failed, moving %s back to %s", repoPath, path))
+		if err := s.fs.Move(repoPath, path); err != nil {
+			return "", fmt.Errorf("failed to link '%s' (%v) and failed to restore it from '%s': %w", path, linkErr, repoPath, err)
+		}
+		return "", linkErr
+	}
+
+	if err := s.recordPlan(plan); err != nil {
+		return repoPath, fmt.Errorf("'%s' was adopted but the manifest could not be updated: %w", path, err)
+	}
+	return repoPath, nil
+}
+
+// adoptDestination determines where in the repository an adopted path is stored, so that LinkDotfiles links it back:
+// top-level dotfiles in the home directory go to the repository root, everything else to the mapped directory
+// whose destination holds the path, the longest destination winning. HOME and ROOT are only used when no mapping
+// of the mappings file holds the path, unless the mappings file replaces them.
+func (s *FileLinkerService) adoptDestination(repoRoot string, userHome string, path string, isDir bool) (string, error) {
+	if util.IsSubPath(path, repoRoot) {
+		return "", fmt.Errorf("'%s' is already inside the repository", path)
+	}
+	if util.PathEquals(path, userHome) {
+		return "", fmt.Errorf("cannot adopt the home directory itself")
+	}
+
+	// Only top-level dotfiles are linked from the repository root; directories are not enumerated there
+	if rel, err := filepath.Rel(userHome, path); err == nil && util.IsSubPath(path, userHome) &&
+		!isDir && !strings.ContainsRune(rel, filepath.Separator) && strings.HasPrefix(rel, ".") {
+		return filepath.Join(repoRoot, rel), nil
+	}
+
+	mappings, err := s.loadMappings(repoRoot, userHome)
+	if err != nil {
+		return "", err
+	}
+	var found *directoryMapping
+	var foundRel string
+	for i, mapping := range mappings {
+		rel, err := filepath.Rel(mapping.destination, path)
+		if err != nil || !util.IsSubPath(path, mapping.destination) {
+			continue
+		}
+		if rel == "." {
+			return "", fmt.Errorf("cannot adopt '%s': it is the destination of %s", path, mapping.source)
+		}
+		// A mapping that is not recursive only links the files directly in its destination
+		if !mapping.recursive && (isDir || strings.ContainsRune(rel, filepath.Separator)) {
+			continue
+		}
+		if found == nil || len(mapping.destination) > len(found.destination) {
+			found, foundRel = &mappings[i], rel
+		}
+	}
+	if found == nil {
+		return "", fmt.Errorf("'%s' is not below the destination of any mapped directory on %s; map a directory to it in %s", path, s.host().OS, MappingsFileName)
+	}
+	return filepath.Join(repoRoot, found.source, foundRel), nil
+}
+
+// directoryModes returns the modes of a directory and of the directories below it that hold files, keyed by path.
+func (s *FileLinkerService) directoryModes(dir string) (map[string]fs.FileMode, error) {
+	files, err := s.fs.EnumerateFiles(dir, "*", true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enumerate files in %s: %w", dir, err)
+	}
+
+	modes := make(map[string]fs.FileMode)
+	read := func(path string) error {
+		if _, exists := modes[path]; exists {
+			return nil
+		}
+		mode, err := s.fs.GetMode(path)
+		if err != nil {
+			return fmt.Errorf("failed to read the mode of %s: %w", path, err)
+		}
+		modes[path] = mode
+		return nil
+	}
+
+	if err := read(dir); err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		for d := filepath.Dir(file); util.IsSubPath(d, dir) && !util.PathEquals(d, dir); d = filepath.Dir(d) {
+			if err := read(d); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return modes, nil
+}
+
+// planAdoption plans the links from the original path to the adopted content in the repository.
+// A directory is recreated at its original path with the modes in modes, and every file inside it is linked,
+// the same way LinkDotfiles links the contents of HOME and ROOT. Attributes declared in the attributes file apply last.
+func (s *FileLinkerService) planAdoption(repoRoot string, userHome string, repoPath string, path string, isDir bool, modes map[string]fs.FileMode) (*Plan, error) {
+	plan := &Plan{RepoRoot: repoRoot, UserHome: userHome, Options: LinkOptions{RunID: s.newRunID()}}
+	if !isDir {
+		action, err := s.planTarget(linkEntry{source: repoPath, target: path}, plan.Options, nil)
+		if err != nil {
+			return nil, err
+		}
+		plan.Actions = append(plan.Actions, action)
+	} else {
+		files, err := s.fs.EnumerateFiles(repoPath, "*", true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to enumerate files in %s: %w", repoPath, err)
+		}
+
+		plannedDirs := make(map[string]bool)
+		plan.Actions = append(plan.Actions, s.planDirectories(path, plannedDirs, nil)...)
+		for _, file := range files {
+			entry, err := newDirectoryEntry(repoPath, path, file, false)
+			if err != nil {
+				return nil, err
+			}
+			action, err := s.planTarget(entry, plan.Options, nil)
+			if err != nil {
+				return nil, err
+			}
+			plan.Actions = append(plan.Actions, s.planDirectories(filepath.Dir(entry.target), plannedDirs, nil)...)
+			plan.Actions = append(plan.Actions, action)
+		}
+
+		// Directories are created with the default mode, so give the recreated ones back the mode they had
+		var restored []Action
+		for _, action := range plan.Actions {
+			if mode, exists := modes[action.Target]; exists && action.Kind == ActionMkdir {
+				restored = append(restored, Action{Kind: ActionSetAttributes, Target: action.Target, IsDir: true, Attributes: Attributes{DirMode: mode}, Reason: "mode of the adopted directory"})
+			}
+		}
+		plan.Actions = append(plan.Actions, restored...)
+	}
+
+	rules, err := s.loadAttributes(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	attributes, err := s.planAttributes(plan, rules)
+	if err != nil {
+		return nil, err
+	}
+	plan.Actions = append(plan.Actions, attributes...)
+	return plan, nil
+}
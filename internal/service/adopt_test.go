@@ -0,0 +1,308 @@
+package service
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/guitarrapc/dotfileslinker-go/internal/infrastructure"
+)
+
+func TestFileLinkerService_Adopt(t *testing.T) {
+	repoRoot := "/repo"
+	userHome := "/home/user"
+
+	t.Run("Top-level dotfile goes to the repository root", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		service := NewFileLinkerService(fs, NewMockLogger())
+
+		path := filepath.Join(userHome, ".bashrc")
+		fs.AddFile(path, "# bashrc")
+
+		repoPath, err := service.Adopt(repoRoot, userHome, path, false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := filepath.Join(repoRoot, ".bashrc")
+		if repoPath != expected {
+			t.Errorf("Expected repository path %s, got %s", expected, repoPath)
+		}
+		if fs.Files[expected] != "# bashrc" {
+			t.Error("File content was not moved into the repository")
+		}
+		if fs.GetLinkTarget(path) != expected {
+			t.Errorf("Link not created: %s -> %s", path, fs.GetLinkTarget(path))
+		}
+	})
+
+	t.Run("Nested file goes to HOME", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		service := NewFileLinkerService(fs, NewMockLogger())
+
+		path := filepath.Join(userHome, ".config", "git", "config")
+		fs.AddFile(path, "[user]")
+
+		repoPath, err := service.Adopt(repoRoot, userHome, path, false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := filepath.Join(repoRoot, "HOME", ".config", "git", "config")
+		if repoPath != expected {
+			t.Errorf("Expected repository path %s, got %s", expected, repoPath)
+		}
+		if fs.GetLinkTarget(path) != expected {
+			t.Errorf("Link not created: %s -> %s", path, fs.GetLinkTarget(path))
+		}
+	})
+
+	t.Run("File below a mapped destination goes to its mapped directory", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.host = func() HostInfo { return HostInfo{OS: "linux"} }
+
+		// Repository mapping LOCAL_BIN to ~/.local/bin and LOCAL to ~/.local
+		fs.AddFile(filepath.Join(repoRoot, MappingsFileName), "LOCAL ~/.local\nLOCAL_BIN ~/.local/bin\n")
+		path := filepath.Join(userHome, ".local", "bin", "tool")
+		fs.AddFile(path, "#!/bin/sh")
+
+		repoPath, err := service.Adopt(repoRoot, userHome, path, false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := filepath.Join(repoRoot, "LOCAL_BIN", "tool")
+		if repoPath != expected {
+			t.Errorf("Expected repository path %s, got %s", expected, repoPath)
+		}
+		if fs.GetLinkTarget(path) != expected {
+			t.Errorf("Link not created: %s -> %s", path, fs.GetLinkTarget(path))
+		}
+	})
+
+	t.Run("Remapped HOME is used for files in its destination", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.host = func() HostInfo { return HostInfo{OS: "linux"} }
+
+		// Repository mapping HOME to /xdg/home and TOOLS, which is not recursive, to /opt/tools
+		fs.AddFile(filepath.Join(repoRoot, MappingsFileName), "HOME /xdg/home\nTOOLS /opt/tools recursive=n\n")
+		path := filepath.Join("/xdg", "home", ".config", "git", "config")
+		fs.AddFile(path, "[user]")
+		nested := filepath.Join("/opt", "tools", "lib", "run.sh")
+		fs.AddFile(nested, "#!/bin/sh")
+
+		repoPath, err := service.Adopt(repoRoot, userHome, path, false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if expected := filepath.Join(repoRoot, "HOME", ".config", "git", "config"); repoPath != expected {
+			t.Errorf("Expected repository path %s, got %s", expected, repoPath)
+		}
+
+		// Files in subdirectories of a mapping that is not recursive are not linked from it
+		repoPath, err = service.Adopt(repoRoot, userHome, nested, false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if expected := filepath.Join(repoRoot, "ROOT", "opt", "tools", "lib", "run.sh"); repoPath != expected {
+			t.Errorf("Expected repository path %s, got %s", expected, repoPath)
+		}
+	})
+
+	t.Run("Directory is linked file by file", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		service := NewFileLinkerService(fs, NewMockLogger())
+
+		path := filepath.Join(userHome, ".config", "nvim")
+		fs.AddDirectory(path)
+		fs.AddFile(filepath.Join(path, "init.vim"), "set number")
+		fs.AddFile(filepath.Join(path, "lua", "plugins.lua"), "return {}")
+
+		repoPath := filepath.Join(repoRoot, "HOME", ".config", "nvim")
+		fs.SetupFileEnumeration(repoPath, "*", true, []string{
+			filepath.Join(repoPath, "init.vim"),
+			filepath.Join(repoPath, "lua", "plugins.lua"),
+		})
+
+		if _, err := service.Adopt(repoRoot, userHome, path, false); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		for _, rel := range []string{"init.vim", filepath.Join("lua", "plugins.lua")} {
+			link := filepath.Join(path, rel)
+			if fs.GetLinkTarget(link) != filepath.Join(repoPath, rel) {
+				t.Errorf("Link not created: %s -> %s", link, fs.GetLinkTarget(link))
+			}
+		}
+	})
+
+	t.Run("Directory is recreated with its original mode", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		service := NewFileLinkerService(fs, NewMockLogger())
+
+		// Home directory with a private ~/.ssh
+		path := filepath.Join(userHome, ".ssh")
+		fs.AddDirectory(path)
+		fs.AddFile(filepath.Join(path, "config"), "Host *")
+		fs.AddFile(filepath.Join(path, "config.d", "work"), "Host work")
+		fs.Modes[path] = 0o700
+		fs.Modes[filepath.Join(path, "config.d")] = 0o750
+		fs.SetupFileEnumeration(path, "*", true, []string{
+			filepath.Join(path, "config"),
+			filepath.Join(path, "config.d", "work"),
+		})
+
+		repoPath := filepath.Join(repoRoot, "HOME", ".ssh")
+		fs.SetupFileEnumeration(repoPath, "*", true, []string{
+			filepath.Join(repoPath, "config"),
+			filepath.Join(repoPath, "config.d", "work"),
+		})
+
+		if _, err := service.Adopt(repoRoot, userHome, path, false); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if fs.Modes[path] != 0o700 {
+			t.Errorf("Expected %s to have mode 0700, got %04o", path, fs.Modes[path])
+		}
+		if subDir := filepath.Join(path, "config.d"); fs.Modes[subDir] != 0o750 {
+			t.Errorf("Expected %s to have mode 0750, got %04o", subDir, fs.Modes[subDir])
+		}
+		if fs.Modes[repoPath] != 0o700 {
+			t.Errorf("Expected %s to keep mode 0700, got %04o", repoPath, fs.Modes[repoPath])
+		}
+		if fs.GetLinkTarget(filepath.Join(path, "config")) != filepath.Join(repoPath, "config") {
+			t.Error("Link not created in the recreated directory")
+		}
+	})
+
+	t.Run("Declared attributes apply to the recreated directory", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		service := NewFileLinkerService(fs, NewMockLogger())
+
+		// Repository declaring the mode of ~/.gnupg
+		fs.AddFile(filepath.Join(repoRoot, AttributesFileName), "~/.gnupg dirmode=0700")
+		path := filepath.Join(userHome, ".gnupg")
+		fs.AddDirectory(path)
+		fs.AddFile(filepath.Join(path, "gpg.conf"), "use-agent")
+
+		repoPath := filepath.Join(repoRoot, "HOME", ".gnupg")
+		fs.SetupFileEnumeration(repoPath, "*", true, []string{filepath.Join(repoPath, "gpg.conf")})
+
+		if _, err := service.Adopt(repoRoot, userHome, path, false); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.Modes[path] != 0o700 {
+			t.Errorf("Expected %s to have mode 0700, got %04o", path, fs.Modes[path])
+		}
+	})
+
+	t.Run("System file goes to ROOT", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("ROOT is only available on Linux/macOS")
+		}
+
+		fs := infrastructure.NewMockFileSystem()
+		service := NewFileLinkerService(fs, NewMockLogger())
+
+		path := "/etc/profile.d/custom.sh"
+		fs.AddFile(path, "export FOO=1")
+
+		repoPath, err := service.Adopt(repoRoot, userHome, path, false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if repoPath != filepath.Join(repoRoot, "ROOT", "etc", "profile.d", "custom.sh") {
+			t.Errorf("Unexpected repository path: %s", repoPath)
+		}
+	})
+
+	t.Run("System file is rejected on Windows", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.host = func() HostInfo { return HostInfo{OS: "windows"} }
+
+		path := "/etc/profile.d/custom.sh"
+		fs.AddFile(path, "export FOO=1")
+
+		if _, err := service.Adopt(repoRoot, userHome, path, false); err == nil {
+			t.Fatal("Expected error adopting a file outside the home directory on Windows")
+		}
+		if fs.Files[path] != "export FOO=1" {
+			t.Error("Original file was moved")
+		}
+	})
+
+	t.Run("Link failure moves the file back", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		service := NewFileLinkerService(fs, NewMockLogger())
+
+		path := filepath.Join(userHome, ".bashrc")
+		fs.AddFile(path, "# bashrc")
+		fs.SetErrorForOperation("CreateFileSymlink:"+path, errTest)
+
+		if _, err := service.Adopt(repoRoot, userHome, path, false); err == nil {
+			t.Fatal("Expected error when the link cannot be created")
+		}
+
+		if fs.Files[path] != "# bashrc" {
+			t.Error("Original file was not restored")
+		}
+		if _, exists := fs.Files[filepath.Join(repoRoot, ".bashrc")]; exists {
+			t.Error("Repository copy was left behind")
+		}
+	})
+
+	t.Run("Move failure keeps the original", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		service := NewFileLinkerService(fs, NewMockLogger())
+
+		path := filepath.Join(userHome, ".bashrc")
+		fs.AddFile(path, "# bashrc")
+		fs.SetErrorForOperation("Move:"+path, errTest)
+
+		if _, err := service.Adopt(repoRoot, userHome, path, false); err == nil {
+			t.Fatal("Expected error when the file cannot be moved")
+		}
+		if fs.Files[path] != "# bashrc" {
+			t.Error("Original file was lost")
+		}
+	})
+
+	t.Run("Rejects invalid sources", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		service := NewFileLinkerService(fs, NewMockLogger())
+
+		link := filepath.Join(userHome, ".linked")
+		fs.SymLinks[link] = "/somewhere"
+		fs.AddFile(link, "")
+		existing := filepath.Join(userHome, ".vimrc")
+		fs.AddFile(existing, "# vimrc")
+		fs.AddFile(filepath.Join(repoRoot, ".vimrc"), "# repo vimrc")
+		inRepo := filepath.Join(repoRoot, "HOME", ".profile")
+		fs.AddFile(inRepo, "# profile")
+
+		for _, path := range []string{link, existing, inRepo, filepath.Join(userHome, ".missing")} {
+			if _, err := service.Adopt(repoRoot, userHome, path, false); err == nil {
+				t.Errorf("Expected error adopting %s", path)
+			}
+		}
+	})
+
+	t.Run("Dry run does not move", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		service := NewFileLinkerService(fs, NewMockLogger())
+
+		path := filepath.Join(userHome, ".bashrc")
+		fs.AddFile(path, "# bashrc")
+
+		if _, err := service.Adopt(repoRoot, userHome, path, true); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.Files[path] != "# bashrc" || fs.GetLinkTarget(path) != "" {
+			t.Error("Dry run modified the file system")
+		}
+	})
+}
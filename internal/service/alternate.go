@@ -0,0 +1,239 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// alternateSeparator separates the name of an alternate file or directory from its conditions,
+// as in ".gitconfig##os.linux,host.buildbox" or "config##default".
+const alternateSeparator = "##"
+
+// alternateWeights are the scores of the conditions an alternate can carry. An alternate matches when every
+// condition matches, and among the alternates of a target the one with the highest total score is linked,
+// so a condition on the user is more specific than one on the host, the profile, the OS or the architecture.
+var alternateWeights = map[string]int{
+	"arch":    1,
+	"os":      2,
+	"profile": 4,
+	"host":    8,
+	"user":    16,
+}
+
+// alternateAliases are the short names yadm accepts for conditions.
+var alternateAliases = map[string]string{
+	"a":        "arch",
+	"o":        "os",
+	"p":        "profile",
+	"h":        "host",
+	"hostname": "host",
+	"u":        "user",
+}
+
+// alternateCondition is a single condition in the name of an alternate, such as "os.linux".
+type alternateCondition struct {
+	key   string // Name of the condition, such as "os"
+	value string // Value the condition requires
+}
+
+// parseAlternateName splits a file or directory name into the name it is linked as and its conditions.
+// A name without the separator has no conditions; "##default" is a condition-less alternate.
+func parseAlternateName(name string) (string, []alternateCondition, bool, error) {
+	base, spec, found := strings.Cut(name, alternateSeparator)
+	if !found {
+		return name, nil, false, nil
+	}
+	if base == "" {
+		return "", nil, false, fmt.Errorf("alternate %q has no name before %s", name, alternateSeparator)
+	}
+	if spec == "default" {
+		return base, nil, true, nil
+	}
+
+	var conditions []alternateCondition
+	for _, part := range strings.Split(spec, ",") {
+		key, value, hasValue := strings.Cut(strings.TrimSpace(part), ".")
+		key = strings.ToLower(key)
+		if alias, ok := alternateAliases[key]; ok {
+			key = alias
+		}
+		if _, ok := alternateWeights[key]; !ok {
+			return "", nil, false, fmt.Errorf("alternate %q has an unknown condition %q", name, part)
+		}
+		if !hasValue || value == "" {
+			return "", nil, false, fmt.Errorf("alternate %q has no value for condition %q", name, key)
+		}
+		conditions = append(conditions, alternateCondition{key: key, value: value})
+	}
+	return base, conditions, true, nil
+}
+
+// alternateContext is what the conditions of alternates are matched against.
+type alternateContext struct {
+	host     HostInfo
+	profiles map[string]bool // The selected profile and the profiles it inherits
+}
+
+// matches reports whether the condition holds on this machine.
+func (c alternateContext) matches(condition alternateCondition) bool {
+	switch condition.key {
+	case "os":
+		return strings.EqualFold(condition.value, c.host.OS)
+	case "arch":
+		return strings.EqualFold(condition.value, c.host.Arch)
+	case "host":
+		short, _, _ := strings.Cut(c.host.Hostname, ".")
+		return strings.EqualFold(condition.value, c.host.Hostname) || strings.EqualFold(condition.value, short)
+	case "user":
+		return condition.value == c.host.Username
+	case "profile":
+		return c.profiles[condition.value]
+	}
+	return false
+}
+
+// alternateCandidate is an entry that supplies a target through an alternate name, with its score.
+type alternateCandidate struct {
+	index   int  // Index of the entry
+	score   int  // Sum of the weights of its conditions; 0 for defaults
+	matched bool // Whether every condition holds on this machine
+}
+
+// resolveAlternates links every target supplied by alternates to the alternate that matches this machine best.
+// Names with conditions are replaced by the name they are linked as; the other alternates of the target are
+// marked ignored. A plain file in the same directory counts as the default, and templates and encrypted files
+// are alternates of the target they are written to. Two best alternates with the same score, or a target none
+// of whose alternates matches and that has no default, is an error.
+func (s *FileLinkerService) resolveAlternates(repoRoot string, entries []linkEntry) error {
+	groups := make(map[string][]alternateCandidate)
+	var order []string
+	hasAlternates := make(map[string]bool)
+	var context *alternateContext
+
+	for i := range entries {
+		if entries[i].ignored {
+			continue
+		}
+		target, conditions, alternate, err := resolveAlternatePath(entries[i].target)
+		if err != nil {
+			return fmt.Errorf("invalid alternate %s: %w", entries[i].source, err)
+		}
+		if alternate && context == nil {
+			if context, err = s.newAlternateContext(repoRoot); err != nil {
+				return err
+			}
+		}
+
+		candidate := alternateCandidate{index: i, matched: true}
+		for _, condition := range conditions {
+			candidate.score += alternateWeights[condition.key]
+			if !context.matches(condition) {
+				candidate.matched = false
+			}
+		}
+		entries[i].target = target
+		entries[i].alternate = alternate
+
+		key := entries[i].layer + "\x00" + s.generatedTarget(entries[i])
+		if _, exists := groups[key]; !exists {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], candidate)
+		hasAlternates[key] = hasAlternates[key] || alternate
+	}
+
+	for _, key := range order {
+		if !hasAlternates[key] {
+			continue
+		}
+		if err := s.selectAlternate(entries, groups[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// selectAlternate keeps the best matching candidate of a target and marks the others ignored.
+func (s *FileLinkerService) selectAlternate(entries []linkEntry, candidates []alternateCandidate) error {
+	var matched []alternateCandidate
+	for _, candidate := range candidates {
+		if candidate.matched {
+			matched = append(matched, candidate)
+		}
+	}
+	target := entries[candidates[0].index].target
+	if len(matched) == 0 {
+		sources := make([]string, 0, len(candidates))
+		for _, candidate := range candidates {
+			sources = append(sources, filepath.Base(entries[candidate.index].source))
+		}
+		return fmt.Errorf("no alternate of %s matches this machine (%s); add %s%sdefault",
+			target, strings.Join(sources, ", "), filepath.Base(target), alternateSeparator)
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool { return matched[i].score > matched[j].score })
+	if len(matched) > 1 && matched[0].score == matched[1].score {
+		return fmt.Errorf("alternates %s and %s of %s match this machine equally well",
+			entries[matched[0].index].source, entries[matched[1].index].source, target)
+	}
+
+	for _, candidate := range candidates {
+		if candidate.index == matched[0].index {
+			s.logger.Verbose(fmt.Sprintf("Alternate %s is selected for %s", entries[candidate.index].source, target))
+			continue
+		}
+		entries[candidate.index].ignored = true
+	}
+	return nil
+}
+
+// generatedTarget returns the target of an entry without the encrypted and template suffixes that markEncrypted
+// and markTemplates remove later, so "config##os.linux" and "config.tmpl##os.darwin" are alternates of one target.
+func (s *FileLinkerService) generatedTarget(entry linkEntry) string {
+	if s.fs.DirectoryExists(entry.source) {
+		return entry.target
+	}
+	target := entry.target
+	for _, suffix := range []string{encryptedSuffix, templateSuffix} {
+		if name := filepath.Base(target); strings.HasSuffix(name, suffix) && name != suffix {
+			target = strings.TrimSuffix(target, suffix)
+		}
+	}
+	return target
+}
+
+// resolveAlternatePath removes the conditions from every name in path and returns the conditions of all of them.
+func resolveAlternatePath(path string) (string, []alternateCondition, bool, error) {
+	if !strings.Contains(path, alternateSeparator) {
+		return path, nil, false, nil
+	}
+	var names []string
+	var conditions []alternateCondition
+	alternate := false
+	dir := path
+	for ; filepath.Dir(dir) != dir; dir = filepath.Dir(dir) {
+		name, nameConditions, nameAlternate, err := parseAlternateName(filepath.Base(dir))
+		if err != nil {
+			return "", nil, false, err
+		}
+		names = append([]string{name}, names...)
+		conditions = append(conditions, nameConditions...)
+		alternate = alternate || nameAlternate
+	}
+	return filepath.Join(append([]string{dir}, names...)...), conditions, alternate, nil
+}
+
+// newAlternateContext describes this machine for matching alternates.
+func (s *FileLinkerService) newAlternateContext(repoRoot string) (*alternateContext, error) {
+	profiles, err := s.profileChain(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	context := &alternateContext{host: s.host(), profiles: make(map[string]bool)}
+	for _, profile := range profiles {
+		context.profiles[profile] = true
+	}
+	return context, nil
+}
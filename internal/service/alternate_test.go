@@ -0,0 +1,303 @@
+package service
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/guitarrapc/dotfileslinker-go/internal/infrastructure"
+)
+
+func TestParseAlternateName(t *testing.T) {
+	t.Run("Valid names", func(t *testing.T) {
+		name, conditions, alternate, err := parseAlternateName(".gitconfig##os.linux,h.buildbox")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := []alternateCondition{{key: "os", value: "linux"}, {key: "host", value: "buildbox"}}
+		if name != ".gitconfig" || !alternate || len(conditions) != 2 || conditions[0] != expected[0] || conditions[1] != expected[1] {
+			t.Errorf("Unexpected result %q %+v %v", name, conditions, alternate)
+		}
+
+		name, conditions, alternate, _ = parseAlternateName("config##default")
+		if name != "config" || !alternate || len(conditions) != 0 {
+			t.Errorf("Unexpected default %q %+v %v", name, conditions, alternate)
+		}
+
+		if _, _, alternate, _ := parseAlternateName(".bashrc"); alternate {
+			t.Error("Plain name was read as an alternate")
+		}
+	})
+
+	tests := map[string]string{
+		"unknown condition": ".gitconfig##distro.ubuntu",
+		"missing value":     ".gitconfig##os",
+		"missing name":      "##os.linux",
+	}
+	for name, file := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, _, _, err := parseAlternateName(file); err == nil {
+				t.Errorf("Expected an error for %q", file)
+			}
+		})
+	}
+}
+
+func TestFileLinkerService_Alternates(t *testing.T) {
+	repoRoot := "/repo"
+	userHome := "/home/user"
+	ignoreFileName := ".ignore"
+	home := filepath.Join(repoRoot, "HOME")
+	gitconfig := filepath.Join(userHome, ".gitconfig")
+
+	t.Run("Most specific match is linked to the base name", func(t *testing.T) {
+		// HOME directory with the alternates on the Linux machine "buildbox" of alice
+		files := []string{".gitconfig##default", ".gitconfig##os.linux", ".gitconfig##os.linux,host.buildbox", ".gitconfig##os.darwin"}
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(home)
+		var paths []string
+		for _, file := range files {
+			path := filepath.Join(home, file)
+			fs.AddFile(path, "# "+file)
+			paths = append(paths, path)
+		}
+		fs.SetupFileEnumeration(home, "*", true, paths)
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.host = func() HostInfo {
+			return HostInfo{Hostname: "buildbox.example.com", OS: "linux", Arch: "amd64", Username: "alice"}
+		}
+
+		plan, err := service.Plan(repoRoot, userHome, ignoreFileName, LinkOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		sources := make(map[string]string)
+		var ignored []string
+		for _, action := range plan.Actions {
+			switch action.Kind {
+			case ActionLink:
+				sources[action.Target] = action.Source
+			case ActionIgnore:
+				ignored = append(ignored, filepath.Base(action.Source))
+			}
+		}
+		if sources[gitconfig] != filepath.Join(home, ".gitconfig##os.linux,host.buildbox") {
+			t.Errorf("Unexpected source %q", sources[gitconfig])
+		}
+		if len(sources) != 1 || len(ignored) != 3 {
+			t.Errorf("Expected the other alternates to be ignored, got %v %v", sources, ignored)
+		}
+	})
+
+	t.Run("Default is linked when nothing else matches", func(t *testing.T) {
+		// HOME directory with the alternates on the Linux machine "buildbox" of alice
+		files := []string{".gitconfig##default", ".gitconfig##os.darwin", ".gitconfig##user.bob"}
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(home)
+		var paths []string
+		for _, file := range files {
+			path := filepath.Join(home, file)
+			fs.AddFile(path, "# "+file)
+			paths = append(paths, path)
+		}
+		fs.SetupFileEnumeration(home, "*", true, paths)
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.host = func() HostInfo {
+			return HostInfo{Hostname: "buildbox.example.com", OS: "linux", Arch: "amd64", Username: "alice"}
+		}
+
+		plan, err := service.Plan(repoRoot, userHome, ignoreFileName, LinkOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		sources := make(map[string]string)
+		for _, action := range plan.Actions {
+			if action.Kind == ActionLink {
+				sources[action.Target] = action.Source
+			}
+		}
+		if sources[gitconfig] != filepath.Join(home, ".gitconfig##default") {
+			t.Errorf("Unexpected source %q", sources[gitconfig])
+		}
+	})
+
+	t.Run("Plain file counts as the default", func(t *testing.T) {
+		// HOME directory with the alternates on the Linux machine "buildbox" of alice
+		files := []string{".gitconfig", ".gitconfig##arch.arm64"}
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(home)
+		var paths []string
+		for _, file := range files {
+			path := filepath.Join(home, file)
+			fs.AddFile(path, "# "+file)
+			paths = append(paths, path)
+		}
+		fs.SetupFileEnumeration(home, "*", true, paths)
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.host = func() HostInfo {
+			return HostInfo{Hostname: "buildbox.example.com", OS: "linux", Arch: "amd64", Username: "alice"}
+		}
+
+		plan, err := service.Plan(repoRoot, userHome, ignoreFileName, LinkOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		sources := make(map[string]string)
+		for _, action := range plan.Actions {
+			if action.Kind == ActionLink {
+				sources[action.Target] = action.Source
+			}
+		}
+		if sources[gitconfig] != filepath.Join(home, ".gitconfig") {
+			t.Errorf("Unexpected source %q", sources[gitconfig])
+		}
+	})
+
+	t.Run("Alternate directories and templates are resolved", func(t *testing.T) {
+		// HOME directory with the alternates on the Linux machine "buildbox" of alice
+		files := []string{filepath.Join(".config", "nvim##os.linux", "init.vim"), ".gitconfig.tmpl##user.alice"}
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(home)
+		var paths []string
+		for _, file := range files {
+			path := filepath.Join(home, file)
+			fs.AddFile(path, "# "+file)
+			paths = append(paths, path)
+		}
+		fs.SetupFileEnumeration(home, "*", true, paths)
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.host = func() HostInfo {
+			return HostInfo{Hostname: "buildbox.example.com", OS: "linux", Arch: "amd64", Username: "alice"}
+		}
+		fs.AddDirectory(filepath.Join(home, ".config"))
+		fs.AddDirectory(filepath.Join(home, ".config", "nvim##os.linux"))
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{Fold: true}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		init := filepath.Join(userHome, ".config", "nvim", "init.vim")
+		if fs.GetLinkTarget(init) != filepath.Join(home, ".config", "nvim##os.linux", "init.vim") {
+			t.Errorf("Alternate directory was not linked per file: %q", fs.GetLinkTarget(init))
+		}
+		if fs.Files[gitconfig] != "# .gitconfig.tmpl##user.alice" {
+			t.Errorf("Alternate template was not rendered: %q", fs.Files[gitconfig])
+		}
+	})
+
+	t.Run("Template alternates compete with plain alternates", func(t *testing.T) {
+		// HOME directory with the alternates on the Linux machine "buildbox" of alice
+		files := []string{"config##os.linux", "config.tmpl##os.darwin"}
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(home)
+		var paths []string
+		for _, file := range files {
+			path := filepath.Join(home, file)
+			fs.AddFile(path, "# "+file)
+			paths = append(paths, path)
+		}
+		fs.SetupFileEnumeration(home, "*", true, paths)
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.host = func() HostInfo {
+			return HostInfo{Hostname: "buildbox.example.com", OS: "linux", Arch: "amd64", Username: "alice"}
+		}
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		config := filepath.Join(userHome, "config")
+		if fs.GetLinkTarget(config) != filepath.Join(home, "config##os.linux") {
+			t.Errorf("Unexpected source %q", fs.GetLinkTarget(config))
+		}
+
+		// Same directory with the template being the alternate that matches
+		files = []string{"config##os.darwin", "config.tmpl##os.linux"}
+		fs = infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(home)
+		paths = nil
+		for _, file := range files {
+			path := filepath.Join(home, file)
+			fs.AddFile(path, "# "+file)
+			paths = append(paths, path)
+		}
+		fs.SetupFileEnumeration(home, "*", true, paths)
+
+		service = NewFileLinkerService(fs, NewMockLogger())
+		service.host = func() HostInfo {
+			return HostInfo{Hostname: "buildbox.example.com", OS: "linux", Arch: "amd64", Username: "alice"}
+		}
+		plan, err := service.Plan(repoRoot, userHome, ignoreFileName, LinkOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		sources := make(map[string]string)
+		for _, action := range plan.Actions {
+			if action.Kind == ActionLink {
+				sources[action.Target] = action.Source
+			}
+		}
+		if sources[config] != filepath.Join(home, "config.tmpl##os.linux") {
+			t.Errorf("Template alternate was not selected: %v", sources)
+		}
+	})
+
+	t.Run("Tie is an error", func(t *testing.T) {
+		// HOME directory with the alternates on the Linux machine "buildbox" of alice
+		files := []string{".gitconfig##os.linux", ".gitconfig##profile.work,arch.amd64", ".gitconfig##o.linux"}
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(home)
+		var paths []string
+		for _, file := range files {
+			path := filepath.Join(home, file)
+			fs.AddFile(path, "# "+file)
+			paths = append(paths, path)
+		}
+		fs.SetupFileEnumeration(home, "*", true, paths)
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.host = func() HostInfo {
+			return HostInfo{Hostname: "buildbox.example.com", OS: "linux", Arch: "amd64", Username: "alice"}
+		}
+
+		_, err := service.Plan(repoRoot, userHome, ignoreFileName, LinkOptions{})
+		if err == nil || !strings.Contains(err.Error(), "equally well") {
+			t.Fatalf("Expected a tie error, got %v", err)
+		}
+	})
+
+	t.Run("Missing default is an error", func(t *testing.T) {
+		// HOME directory with the alternates on the Linux machine "buildbox" of alice
+		files := []string{".gitconfig##os.darwin", ".gitconfig##os.windows"}
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(home)
+		var paths []string
+		for _, file := range files {
+			path := filepath.Join(home, file)
+			fs.AddFile(path, "# "+file)
+			paths = append(paths, path)
+		}
+		fs.SetupFileEnumeration(home, "*", true, paths)
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.host = func() HostInfo {
+			return HostInfo{Hostname: "buildbox.example.com", OS: "linux", Arch: "amd64", Username: "alice"}
+		}
+
+		_, err := service.Plan(repoRoot, userHome, ignoreFileName, LinkOptions{})
+		if err == nil || !strings.Contains(err.Error(), ".gitconfig##default") {
+			t.Fatalf("Expected a missing default error, got %v", err)
+		}
+	})
+}
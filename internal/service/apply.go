@@ -0,0 +1,162 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// Apply executes the actions of a plan in order.
+// Every mutation is journaled; if an action fails, the mutations made so far are reversed
+// so the file system is left as it was before the run.
+func (s *FileLinkerService) Apply(plan *Plan) error {
+	j := newJournal(plan.Options)
+	for _, action := range plan.Actions {
+		if err := s.applyAction(action, j); err != nil {
+			return s.abort(j, err)
+		}
+	}
+	s.commit(j)
+	return nil
+}
+
+// abort rolls back the journal after err and returns err, annotated if the rollback failed too.
+func (s *FileLinkerService) abort(j *journal, err error) error {
+	s.logger.Error(fmt.Sprintf("Rolling back %d changes: %s", len(j.entries), err))
+	if rollbackErr := s.rollback(j); rollbackErr != nil {
+		s.logger.Error(fmt.Sprintf("Rollback incomplete: %s", rollbackErr))
+		return fmt.Errorf("%w (rollback incomplete: %v)", err, rollbackErr)
+	}
+	return err
+}
+
+// applyAction executes a single action and records its mutations in the journal.
+func (s *FileLinkerService) applyAction(action Action, j *journal) error {
+	switch action.Kind {
+	case ActionMkdir:
+		s.logger.Verbose(fmt.Sprintf("Ensuring directory exists: %s", action.Target))
+		if err := s.fs.EnsureDirectory(action.Target); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+		j.created(action.Target)
+		return nil
+	case ActionIgnore:
+		return nil
+	case ActionUnfold:
+		s.logger.Success(fmt.Sprintf("Unfolding directory: %s", action.Target))
+		if err := s.stageTarget(action.Target, j); err != nil {
+			return err
+		}
+		if err := s.fs.EnsureDirectory(action.Target); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+		j.created(action.Target)
+		return nil
+	case ActionSetAttributes:
+		return s.setAttributes(action, j)
+	case ActionSkip:
+		s.logger.Success(fmt.Sprintf("Skipping already linked: %s -> %s", action.Target, action.Source))
+		return nil
+	case ActionReplace:
+		inPlace := s.rewritesInPlace(action)
+		if j.opts.Conflict == ConflictBackup {
+			if err := s.backupTarget(action.Target, inPlace, j); err != nil {
+				return err
+			}
+		}
+		if inPlace {
+			previous, err := s.fs.ReadFile(action.Target)
+			if err != nil {
+				return fmt.Errorf("failed to read existing target: %w", err)
+			}
+			if err := s.writeTarget(action); err != nil {
+				return err
+			}
+			j.rewritten(action.Target, previous)
+			return nil
+		}
+		if j.opts.Conflict != ConflictBackup {
+			if err := s.stageTarget(action.Target, j); err != nil {
+				return err
+			}
+		}
+		return s.createLink(action, j)
+	case ActionLink:
+		return s.createLink(action, j)
+	default:
+		return fmt.Errorf("unknown action %s for %s", action.Kind, action.Target)
+	}
+}
+
+// rewritesInPlace reports whether a replace action edits the existing file of the user, as injecting a block
+// or adding an include directive does, so the file keeps its mode, owner and inode instead of being replaced.
+func (s *FileLinkerService) rewritesInPlace(action Action) bool {
+	if !action.Injected && action.Include == "" {
+		return false
+	}
+	return s.fs.GetLinkTarget(action.Target) == "" && s.fs.FileExists(action.Target)
+}
+
+// createLink creates the target of a link or replace action and records it in the journal.
+func (s *FileLinkerService) createLink(action Action, j *journal) error {
+	if err := s.writeTarget(action); err != nil {
+		return err
+	}
+	j.created(action.Target)
+	return nil
+}
+
+// writeTarget writes the symbolic link, copy, rendered template, decrypted, injected or including file of an action.
+func (s *FileLinkerService) writeTarget(action Action) error {
+	var err error
+	switch {
+	case action.Injected:
+		s.logger.Success(fmt.Sprintf("Injecting managed block: %s -> %s", action.Target, action.Source))
+		// The block is written into a file of the user, which keeps its mode and owner unless it now holds a secret
+		write := s.fs.UpdateFile
+		if action.Encrypted {
+			write = s.fs.WritePrivateFile
+		}
+		err = write(action.Target, []byte(action.Content))
+	case action.Include != "":
+		s.logger.Success(fmt.Sprintf("Adding %s include: %s -> %s", action.Include, action.Target, action.Source))
+		err = s.fs.UpdateFile(action.Target, []byte(action.Content))
+	case action.Encrypted:
+		s.logger.Success(fmt.Sprintf("Decrypting: %s -> %s", action.Source, action.Target))
+		err = s.fs.WritePrivateFile(action.Target, []byte(action.Content))
+	case action.Template:
+		s.logger.Success(fmt.Sprintf("Rendering template: %s -> %s", action.Source, action.Target))
+		err = s.fs.WriteFile(action.Target, []byte(action.Content))
+	case action.Mode == ModeCopy:
+		s.logger.Success(fmt.Sprintf("Copying file: %s -> %s", action.Source, action.Target))
+		err = s.fs.CopyFile(action.Source, action.Target)
+	case action.Mode == ModeHardlink:
+		s.logger.Success(fmt.Sprintf("Creating hard link: %s -> %s", action.Target, action.Source))
+		err = s.fs.CreateHardLink(action.Target, action.Source)
+	case action.IsDir:
+		s.logger.Success(fmt.Sprintf("Creating directory symlink: %s -> %s", action.Target, s.symlinkValue(action)))
+		err = s.fs.CreateDirectorySymlink(action.Target, s.symlinkValue(action))
+	default:
+		s.logger.Success(fmt.Sprintf("Creating file symlink: %s -> %s", action.Target, s.symlinkValue(action)))
+		err = s.fs.CreateFileSymlink(action.Target, s.symlinkValue(action))
+	}
+
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to create %s from %s to %s: %s", linkKind(action), action.Source, action.Target, err))
+		return err
+	}
+	return nil
+}
+
+// symlinkValue returns the path a symbolic link created by the action points to.
+// A relative path is used when requested and possible; links across Windows volumes stay absolute.
+func (s *FileLinkerService) symlinkValue(action Action) string {
+	if !action.Relative {
+		return action.Source
+	}
+	rel, err := filepath.Rel(filepath.Dir(action.Target), action.Source)
+	if err != nil {
+		s.logger.Verbose(fmt.Sprintf("Using an absolute link for %s: %s", action.Target, err))
+		return action.Source
+	}
+	return rel
+}
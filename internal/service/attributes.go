@@ -0,0 +1,395 @@
+package service
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/guitarrapc/dotfileslinker-go/internal/util"
+)
+
+// AttributesFileName is the name of the file in the repository root that declares the permissions of targets,
+// along the lines of .gitattributes. Each line holds a path pattern followed by attributes:
+//
+//	~/.ssh       dirmode=0700
+//	~/.ssh/*     mode=0600
+//	/etc/sudoers.d/*  mode=0440 owner=root group=root
+const AttributesFileName = "dotfiles_attributes"
+
+// Attributes are the permissions declared for a path. Zero values leave the attribute unchanged.
+type Attributes struct {
+	DirMode fs.FileMode // Mode of directories that hold targets
+	Mode    fs.FileMode // Mode of copies, rendered templates, decrypted, injected and including files; symbolic links and hard links share the mode of their source
+	Owner   string      // Owner of targets outside the home directory
+	Group   string      // Group of targets outside the home directory
+}
+
+// IsZero reports whether no attribute is set.
+func (a Attributes) IsZero() bool {
+	return a == Attributes{}
+}
+
+// String returns the attributes that are set in the syntax of the attributes file, such as "mode=0600 owner=root".
+func (a Attributes) String() string {
+	var parts []string
+	if a.DirMode != 0 {
+		parts = append(parts, fmt.Sprintf("dirmode=%04o", uint32(a.DirMode)))
+	}
+	if a.Mode != 0 {
+		parts = append(parts, fmt.Sprintf("mode=%04o", uint32(a.Mode)))
+	}
+	if a.Owner != "" {
+		parts = append(parts, "owner="+a.Owner)
+	}
+	if a.Group != "" {
+		parts = append(parts, "group="+a.Group)
+	}
+	return strings.Join(parts, " ")
+}
+
+// attributeRule is a single line of the attributes file.
+type attributeRule struct {
+	pattern targetPattern
+	attrs   Attributes
+}
+
+// parseAttributes parses the lines of an attributes file. Blank lines and lines starting with '#' are skipped.
+func parseAttributes(lines []string) ([]attributeRule, error) {
+	var rules []attributeRule
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		pattern, err := parseTargetPattern(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		rule := attributeRule{pattern: pattern}
+
+		if len(fields) == 1 {
+			return nil, fmt.Errorf("line %d: %q declares no attributes", i+1, fields[0])
+		}
+		for _, field := range fields[1:] {
+			name, value, found := strings.Cut(field, "=")
+			if !found || value == "" {
+				return nil, fmt.Errorf("line %d: expected name=value, got %q", i+1, field)
+			}
+			switch name {
+			case "dirmode", "mode":
+				mode, err := strconv.ParseUint(value, 8, 32)
+				if err != nil || mode == 0 || mode > 0o777 {
+					return nil, fmt.Errorf("line %d: invalid %s %q, expected an octal mode such as 0644", i+1, name, value)
+				}
+				if name == "dirmode" {
+					rule.attrs.DirMode = fs.FileMode(mode)
+				} else {
+					rule.attrs.Mode = fs.FileMode(mode)
+				}
+			case "owner":
+				rule.attrs.Owner = value
+			case "group":
+				rule.attrs.Group = value
+			default:
+				return nil, fmt.Errorf("line %d: unknown attribute %q, expected dirmode, mode, owner or group", i+1, name)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// loadAttributes reads the attributes file of the repository. A missing file declares nothing.
+func (s *FileLinkerService) loadAttributes(repoRoot string) ([]attributeRule, error) {
+	path := filepath.Join(repoRoot, AttributesFileName)
+	if !s.fs.FileExists(path) {
+		return nil, nil
+	}
+	lines, err := s.fs.ReadAllLines(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	rules, err := parseAttributes(lines)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	s.logger.Verbose(fmt.Sprintf("Loaded %d attribute rules from %s", len(rules), path))
+	return rules, nil
+}
+
+// declaredAttributes merges the attributes of every rule that matches a managed path, later rules taking precedence.
+// Only the directory mode applies to directories and only the file mode to files;
+// owner and group only apply outside the home directory.
+func declaredAttributes(rules []attributeRule, path string, isDir bool, userHome string) Attributes {
+	var attrs Attributes
+	for _, rule := range rules {
+		if !rule.pattern.matches(path, userHome) {
+			continue
+		}
+		if rule.attrs.DirMode != 0 {
+			attrs.DirMode = rule.attrs.DirMode
+		}
+		if rule.attrs.Mode != 0 {
+			attrs.Mode = rule.attrs.Mode
+		}
+		if rule.attrs.Owner != "" {
+			attrs.Owner = rule.attrs.Owner
+		}
+		if rule.attrs.Group != "" {
+			attrs.Group = rule.attrs.Group
+		}
+	}
+
+	if isDir {
+		attrs.Mode = 0
+	} else {
+		attrs.DirMode = 0
+	}
+	if util.IsSubPath(path, userHome) {
+		attrs.Owner, attrs.Group = "", ""
+	}
+	return attrs
+}
+
+// attributeChange compares the attributes declared for an existing path with the ones on disk.
+// It returns the declared attributes that differ and their current values.
+func (s *FileLinkerService) attributeChange(path string, declared Attributes) (Attributes, Attributes, error) {
+	var change, current Attributes
+	if declared.DirMode != 0 || declared.Mode != 0 {
+		mode, err := s.fs.GetMode(path)
+		if err != nil {
+			return change, current, fmt.Errorf("failed to read the mode of %s: %w", path, err)
+		}
+		if declared.DirMode != 0 && mode != declared.DirMode {
+			change.DirMode, current.DirMode = declared.DirMode, mode
+		}
+		if declared.Mode != 0 && mode != declared.Mode {
+			change.Mode, current.Mode = declared.Mode, mode
+		}
+	}
+	if declared.Owner != "" || declared.Group != "" {
+		owner, group, err := s.fs.GetOwner(path)
+		if err != nil {
+			return change, current, fmt.Errorf("failed to read the owner of %s: %w", path, err)
+		}
+		if declared.Owner != "" && owner != declared.Owner {
+			change.Owner, current.Owner = declared.Owner, owner
+		}
+		if declared.Group != "" && group != declared.Group {
+			change.Group, current.Group = declared.Group, group
+		}
+	}
+	return change, current, nil
+}
+
+// targetDirectories returns the directories between the root a target is linked into and the target, outermost first.
+// The root is the home directory for targets inside it and the file system root otherwise.
+func targetDirectories(target string, userHome string) []string {
+	var dirs []string
+	for dir := filepath.Dir(target); dir != filepath.Dir(dir) && !util.PathEquals(dir, userHome); dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+	}
+	slices.Reverse(dirs)
+	return dirs
+}
+
+// writesContent reports whether an action writes the content of its target rather than linking it.
+func writesContent(action Action) bool {
+	return action.generated() || action.Mode == ModeCopy
+}
+
+// planAttributes returns the actions that apply the declared attributes after the other actions of the plan.
+// Attributes apply to the directories that hold targets and to the files the plan copies or renders.
+// Paths the plan creates or rewrites always get their declared attributes; other paths only when they differ.
+func (s *FileLinkerService) planAttributes(plan *Plan, rules []attributeRule) ([]Action, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	var actions []Action
+	visited := make(map[string]bool)
+	visit := func(path string, isDir bool, created bool) error {
+		if visited[path] {
+			return nil
+		}
+		visited[path] = true
+
+		declared := declaredAttributes(rules, path, isDir, plan.UserHome)
+		if declared.IsZero() {
+			return nil
+		}
+		change, reason := declared, fmt.Sprintf("declared in %s", AttributesFileName)
+		if !created {
+			if s.fs.GetLinkTarget(path) != "" {
+				s.logger.Verbose(fmt.Sprintf("Not setting %s on %s: it is a symbolic link", declared, path))
+				return nil
+			}
+			var current Attributes
+			var err error
+			if change, current, err = s.attributeChange(path, declared); err != nil {
+				return err
+			}
+			if change.IsZero() {
+				return nil
+			}
+			reason = fmt.Sprintf("currently %s", current)
+		}
+		actions = append(actions, Action{Kind: ActionSetAttributes, Target: path, IsDir: isDir, Attributes: change, Reason: reason})
+		return nil
+	}
+
+	for _, action := range plan.Actions {
+		switch action.Kind {
+		case ActionMkdir, ActionUnfold:
+			if err := visit(action.Target, true, true); err != nil {
+				return nil, err
+			}
+		case ActionLink, ActionReplace, ActionSkip:
+			for _, dir := range targetDirectories(action.Target, plan.UserHome) {
+				if err := visit(dir, true, false); err != nil {
+					return nil, err
+				}
+			}
+			if writesContent(action) {
+				if err := visit(action.Target, false, action.Kind != ActionSkip); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return actions, nil
+}
+
+// setAttributes applies the attributes of an action and records the previous values in the journal.
+func (s *FileLinkerService) setAttributes(action Action, j *journal) error {
+	previous := Attributes{}
+	if action.Attributes.DirMode != 0 || action.Attributes.Mode != 0 {
+		mode, err := s.fs.GetMode(action.Target)
+		if err != nil {
+			return fmt.Errorf("failed to read the mode of %s: %w", action.Target, err)
+		}
+		if action.IsDir {
+			previous.DirMode = mode
+		} else {
+			previous.Mode = mode
+		}
+	}
+	if action.Attributes.Owner != "" || action.Attributes.Group != "" {
+		owner, group, err := s.fs.GetOwner(action.Target)
+		if err != nil {
+			return fmt.Errorf("failed to read the owner of %s: %w", action.Target, err)
+		}
+		previous.Owner, previous.Group = owner, group
+	}
+
+	s.logger.Success(fmt.Sprintf("Setting %s on %s", action.Attributes, action.Target))
+	if err := s.applyAttributes(action.Target, action.Attributes); err != nil {
+		return err
+	}
+	j.attributesChanged(action.Target, previous)
+	return nil
+}
+
+// applyAttributes sets the attributes that are set on path.
+func (s *FileLinkerService) applyAttributes(path string, attrs Attributes) error {
+	mode := attrs.Mode
+	if attrs.DirMode != 0 {
+		mode = attrs.DirMode
+	}
+	if mode != 0 {
+		if err := s.fs.SetMode(path, mode); err != nil {
+			return fmt.Errorf("failed to set the mode of %s: %w", path, err)
+		}
+	}
+	if attrs.Owner != "" || attrs.Group != "" {
+		if err := s.fs.SetOwner(path, attrs.Owner, attrs.Group); err != nil {
+			return fmt.Errorf("failed to set the owner of %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// AttributeMismatch is a managed path whose attributes differ from the ones declared in the attributes file.
+type AttributeMismatch struct {
+	Path     string     // Directory holding targets, or a copied or rendered file
+	Expected Attributes // Declared attributes that differ
+	Actual   Attributes // Current values of those attributes
+}
+
+// AttributeMismatches compares the attributes declared in the attributes file with the existing managed paths,
+// without modifying the file system. Paths that do not exist yet are not reported.
+// repoRoot: The root directory of the dotfiles repository.
+// userHome: The user's home directory path.
+// ignoreFileName: The name of the ignore file containing patterns to exclude.
+func (s *FileLinkerService) AttributeMismatches(repoRoot string, userHome string, ignoreFileName string) ([]AttributeMismatch, error) {
+	rules, err := s.loadAttributes(repoRoot)
+	if err != nil || len(rules) == 0 {
+		return nil, err
+	}
+
+	userIgnore := s.loadIgnoreList(filepath.Join(repoRoot, ignoreFileName))
+	entries, err := s.collectAll(repoRoot, userHome, userIgnore)
+	if err != nil {
+		return nil, err
+	}
+	entries, _ = s.foldEntries(entries, foldExisting)
+
+	manifest, err := s.LoadManifest()
+	if err != nil {
+		return nil, err
+	}
+	state := manifest.Repository(repoRoot)
+
+	var mismatches []AttributeMismatch
+	visited := make(map[string]bool)
+	check := func(path string, isDir bool) error {
+		if visited[path] {
+			return nil
+		}
+		visited[path] = true
+
+		declared := declaredAttributes(rules, path, isDir, userHome)
+		if declared.IsZero() || s.fs.GetLinkTarget(path) != "" {
+			return nil
+		}
+		if isDir && !s.fs.DirectoryExists(path) || !isDir && !s.fs.FileExists(path) {
+			return nil
+		}
+		change, current, err := s.attributeChange(path, declared)
+		if err != nil {
+			return err
+		}
+		if !change.IsZero() {
+			mismatches = append(mismatches, AttributeMismatch{Path: path, Expected: change, Actual: current})
+		}
+		return nil
+	}
+
+	for _, entry := range entries {
+		if entry.ignored {
+			continue
+		}
+		for _, dir := range targetDirectories(entry.target, userHome) {
+			if err := check(dir, true); err != nil {
+				return nil, err
+			}
+		}
+
+		written := entry.template || entry.encrypted || entry.injected || entry.include != ""
+		if state != nil {
+			if record := state.Link(entry.target); record != nil && record.Kind == LinkKindCopy {
+				written = true
+			}
+		}
+		if written {
+			if err := check(entry.target, false); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return mismatches, nil
+}
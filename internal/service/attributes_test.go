@@ -0,0 +1,301 @@
+package service
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/guitarrapc/dotfileslinker-go/internal/infrastructure"
+)
+
+func TestParseAttributes(t *testing.T) {
+	t.Run("Valid lines", func(t *testing.T) {
+		rules, err := parseAttributes([]string{
+			"# ssh",
+			"",
+			"~/.ssh  dirmode=0700",
+			"~/.ssh/*  mode=600",
+			"/etc/sudoers.d/*  mode=0440 owner=root group=root",
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(rules) != 3 {
+			t.Fatalf("Expected 3 rules, got %+v", rules)
+		}
+		if !rules[0].pattern.home || rules[0].attrs.DirMode != 0o700 {
+			t.Errorf("Unexpected first rule: %+v", rules[0])
+		}
+		if rules[1].attrs.Mode != 0o600 {
+			t.Errorf("Mode without a leading zero was not read as octal: %+v", rules[1])
+		}
+		expected := Attributes{Mode: 0o440, Owner: "root", Group: "root"}
+		if rules[2].pattern.home || rules[2].attrs != expected {
+			t.Errorf("Unexpected last rule: %+v", rules[2])
+		}
+		if rules[2].attrs.String() != "mode=0440 owner=root group=root" {
+			t.Errorf("Unexpected string %q", rules[2].attrs.String())
+		}
+	})
+
+	tests := map[string]string{
+		"relative pattern":  ".ssh dirmode=0700",
+		"no attributes":     "~/.ssh",
+		"missing value":     "~/.ssh dirmode=",
+		"decimal mode":      "~/.ssh mode=0699",
+		"mode out of range": "~/.ssh mode=01777",
+		"unknown attribute": "~/.ssh immutable=true",
+	}
+	for name, line := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseAttributes([]string{"# comment", line})
+			if err == nil || !strings.HasPrefix(err.Error(), "line 2:") {
+				t.Errorf("Expected an error on line 2 for %q, got %v", line, err)
+			}
+		})
+	}
+}
+
+func TestFileLinkerService_Attributes(t *testing.T) {
+	repoRoot := "/repo"
+	userHome := "/home/user"
+	ignoreFileName := ".ignore"
+	manifestPath := "/state/dotfileslinker/manifest.json"
+	sshDir := filepath.Join(userHome, ".ssh")
+	source := filepath.Join(repoRoot, "HOME", ".ssh", "config")
+	target := filepath.Join(sshDir, "config")
+
+	t.Run("Created directory gets its mode", func(t *testing.T) {
+		// Repository with an ssh configuration and attributes for it
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+		fs.AddFile(source, "Host *")
+		fs.AddFile(filepath.Join(repoRoot, AttributesFileName), "~/.ssh dirmode=0700\n~/.ssh/* mode=0600 owner=root\n")
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.Modes[sshDir] != 0o700 {
+			t.Errorf("Expected %s to have mode 0700, got %04o", sshDir, fs.Modes[sshDir])
+		}
+		if _, exists := fs.Modes[source]; exists {
+			t.Error("Mode was set through a symbolic link")
+		}
+	})
+
+	t.Run("Existing directory is only changed when it differs", func(t *testing.T) {
+		// Repository with an ssh configuration and attributes for it
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+		fs.AddFile(source, "Host *")
+		fs.AddFile(filepath.Join(repoRoot, AttributesFileName), "~/.ssh dirmode=0700\n~/.ssh/* mode=0600 owner=root\n")
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		fs.AddDirectory(sshDir)
+
+		plan, err := service.Plan(repoRoot, userHome, ignoreFileName, LinkOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		last := plan.Actions[len(plan.Actions)-1]
+		if last.Kind != ActionSetAttributes || last.Target != sshDir || last.Reason != "currently dirmode=0755" {
+			t.Fatalf("Expected the directory mode to be changed, got %+v", last)
+		}
+
+		fs.Modes[sshDir] = 0o700
+		plan, err = service.Plan(repoRoot, userHome, ignoreFileName, LinkOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if plan.Count(ActionSetAttributes) != 0 {
+			t.Errorf("Expected no attribute changes, got %+v", plan.Actions)
+		}
+	})
+
+	t.Run("Copies get their mode but not an owner in the home directory", func(t *testing.T) {
+		// Repository with an ssh configuration and attributes for it
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+		fs.AddFile(source, "Host *")
+		fs.AddFile(filepath.Join(repoRoot, AttributesFileName), "~/.ssh dirmode=0700\n~/.ssh/* mode=0600 owner=root\n")
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{Mode: ModeCopy}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.Modes[target] != 0o600 {
+			t.Errorf("Expected the copy to have mode 0600, got %04o", fs.Modes[target])
+		}
+		if _, exists := fs.Owners[target]; exists {
+			t.Error("Owner was set inside the home directory")
+		}
+	})
+
+	t.Run("Rendered templates get their mode", func(t *testing.T) {
+		// Repository with an ssh configuration and attributes for it
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+		fs.AddFile(source, "Host *")
+		fs.AddFile(filepath.Join(repoRoot, AttributesFileName), "~/.ssh dirmode=0700\n~/.ssh/* mode=0600 owner=root\n")
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		template := filepath.Join(repoRoot, "HOME", ".ssh", "known_hosts.tmpl")
+		fs.AddFile(template, "{{ .OS }}")
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, []string{source, template})
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.Modes[filepath.Join(sshDir, "known_hosts")] != 0o600 {
+			t.Error("Rendered template did not get its mode")
+		}
+	})
+
+	t.Run("Owner and group apply outside the home directory", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("ROOT is not processed on Windows")
+		}
+		// Repository with an ssh configuration and attributes for it
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+		fs.AddFile(source, "Host *")
+		fs.AddFile(filepath.Join(repoRoot, AttributesFileName), "~/.ssh dirmode=0700\n~/.ssh/* mode=0600 owner=root\n")
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		rootSource := filepath.Join(repoRoot, "ROOT", "etc", "sudoers.d", "user")
+		rootTarget := "/etc/sudoers.d/user"
+		fs.AddDirectory(filepath.Join(repoRoot, "ROOT"))
+		fs.AddDirectory("/etc/sudoers.d")
+		fs.AddFile(rootSource, "user ALL=(ALL) ALL")
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "ROOT"), "*", true, []string{rootSource})
+		fs.AddFile(filepath.Join(repoRoot, AttributesFileName), "/etc/sudoers.d/* mode=0440 owner=root group=root\n")
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{Mode: ModeCopy}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.Modes[rootTarget] != 0o440 || fs.Owners[rootTarget] != "root:root" {
+			t.Errorf("Unexpected attributes: %04o %q", fs.Modes[rootTarget], fs.Owners[rootTarget])
+		}
+	})
+
+	t.Run("Failed change is rolled back", func(t *testing.T) {
+		// Repository with an ssh configuration and attributes for it
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+		fs.AddFile(source, "Host *")
+		fs.AddFile(filepath.Join(repoRoot, AttributesFileName), "~/.ssh dirmode=0700\n~/.ssh/* mode=0600 owner=root\n")
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		fs.AddDirectory(sshDir)
+		fs.SetErrorForOperation("SetMode:"+target, errTest)
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{Mode: ModeCopy}); err == nil {
+			t.Fatal("Expected error")
+		}
+		if fs.Modes[sshDir] != 0o755 {
+			t.Errorf("Directory mode was not restored, got %04o", fs.Modes[sshDir])
+		}
+		if fs.FileExists(target) {
+			t.Error("Copy was not removed")
+		}
+	})
+
+	t.Run("Dry run changes nothing", func(t *testing.T) {
+		// Repository with an ssh configuration and attributes for it
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+		fs.AddFile(source, "Host *")
+		fs.AddFile(filepath.Join(repoRoot, AttributesFileName), "~/.ssh dirmode=0700\n~/.ssh/* mode=0600 owner=root\n")
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		fs.AddDirectory(sshDir)
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{DryRun: true}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(fs.Modes) != 0 {
+			t.Errorf("Modes were changed during a dry run: %v", fs.Modes)
+		}
+	})
+
+	t.Run("Invalid attributes file is an error", func(t *testing.T) {
+		// Repository with an ssh configuration and attributes for it
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+		fs.AddFile(source, "Host *")
+		fs.AddFile(filepath.Join(repoRoot, AttributesFileName), "~/.ssh dirmode=0700\n~/.ssh/* mode=0600 owner=root\n")
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		fs.AddFile(filepath.Join(repoRoot, AttributesFileName), ".ssh dirmode=0700")
+
+		err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{})
+		if err == nil || !strings.Contains(err.Error(), AttributesFileName) {
+			t.Fatalf("Expected an error naming the attributes file, got %v", err)
+		}
+		if fs.FileExists(target) || fs.GetLinkTarget(target) != "" {
+			t.Error("Target was linked despite the invalid attributes file")
+		}
+	})
+
+	t.Run("Mismatches are reported for existing paths", func(t *testing.T) {
+		// Repository with an ssh configuration and attributes for it
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+		fs.AddFile(source, "Host *")
+		fs.AddFile(filepath.Join(repoRoot, AttributesFileName), "~/.ssh dirmode=0700\n~/.ssh/* mode=0600 owner=root\n")
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{Mode: ModeCopy}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		mismatches, err := service.AttributeMismatches(repoRoot, userHome, ignoreFileName)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(mismatches) != 0 {
+			t.Errorf("Expected no mismatches after linking, got %+v", mismatches)
+		}
+
+		fs.Modes[target] = 0o644
+		mismatches, err = service.AttributeMismatches(repoRoot, userHome, ignoreFileName)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := AttributeMismatch{Path: target, Expected: Attributes{Mode: 0o600}, Actual: Attributes{Mode: 0o644}}
+		if len(mismatches) != 1 || mismatches[0] != expected {
+			t.Errorf("Expected %+v, got %+v", expected, mismatches)
+		}
+	})
+}
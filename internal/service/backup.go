@@ -0,0 +1,332 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/guitarrapc/dotfileslinker-go/internal/util"
+)
+
+// backupIndexFileName is the file in each backup run directory that lists the original target paths.
+const backupIndexFileName = "backup.index"
+
+// RestoreResult summarizes the targets visited by Restore.
+type RestoreResult struct {
+	Restored []string // Targets that were put back (or would be in dry-run mode)
+	Skipped  []string // Targets that could not be restored
+}
+
+// backupTarget moves an existing target into the backup directory of the current run
+// and records it in the run's index so that Restore can put it back.
+// With keep set, a file that is rewritten in place is copied instead, so the target itself stays.
+func (s *FileLinkerService) backupTarget(target string, keep bool, j *journal) error {
+	opts := j.opts
+	if opts.BackupDir == "" {
+		return fmt.Errorf("cannot back up '%s': no backup directory configured", target)
+	}
+
+	runDir := filepath.Join(opts.BackupDir, opts.RunID)
+	backup := backupPath(runDir, target)
+
+	s.logger.Verbose(fmt.Sprintf("Backing up existing target: %s to %s", target, backup))
+	if err := s.fs.EnsureDirectory(filepath.Dir(backup)); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	save := s.fs.Move
+	if keep {
+		save = s.fs.CopyFile
+	}
+	if err := save(target, backup); err != nil {
+		s.removeEmptyParents(filepath.Dir(backup), opts.BackupDir)
+		return fmt.Errorf("failed to back up existing target: %w", err)
+	}
+	j.backedUp(target, backup)
+
+	// Record the target right away so a failure later in the run can still be restored
+	indexPath := filepath.Join(runDir, backupIndexFileName)
+	targets := s.readBackupIndex(indexPath)
+	targets = append(targets, target)
+	if err := s.fs.WriteAllLines(indexPath, targets); err != nil {
+		return fmt.Errorf("failed to update backup index: %w", err)
+	}
+
+	return nil
+}
+
+// unrecordBackup removes a target that was moved back during rollback from the run's backup index,
+// deleting the index and the emptied backup directories when nothing is left.
+func (s *FileLinkerService) unrecordBackup(target string, opts LinkOptions) error {
+	runDir := filepath.Join(opts.BackupDir, opts.RunID)
+	indexPath := filepath.Join(runDir, backupIndexFileName)
+	s.removeEmptyParents(filepath.Dir(backupPath(runDir, target)), runDir)
+
+	var remaining []string
+	for _, recorded := range s.readBackupIndex(indexPath) {
+		if recorded != target {
+			remaining = append(remaining, recorded)
+		}
+	}
+
+	if len(remaining) > 0 {
+		if err := s.fs.WriteAllLines(indexPath, remaining); err != nil {
+			return fmt.Errorf("failed to update backup index: %w", err)
+		}
+		return nil
+	}
+
+	if s.fs.FileExists(indexPath) {
+		if err := s.fs.Delete(indexPath); err != nil {
+			return fmt.Errorf("failed to remove backup index: %w", err)
+		}
+	}
+	s.removeEmptyParents(runDir, opts.BackupDir)
+	return nil
+}
+
+// reportBackups logs how to restore the targets backed up during the run, if any.
+func (s *FileLinkerService) reportBackups(opts LinkOptions) {
+	runDir := filepath.Join(opts.BackupDir, opts.RunID)
+	targets := s.readBackupIndex(filepath.Join(runDir, backupIndexFileName))
+	if len(targets) == 0 {
+		return
+	}
+	s.logger.Success(fmt.Sprintf("Backed up %d existing targets to %s; run 'restore %s' to put them back", len(targets), runDir, opts.RunID))
+}
+
+// Restore puts back the targets backed up by the run with the given ID and removes the links that replaced them.
+// Like unlink, it only removes a symbolic link that resolves into the repository or that the manifest records
+// as created by the run; a target linked elsewhere since is skipped.
+// A regular file in place of a backup is only replaced when the manifest records it as written by the tool
+// and it was not changed since, such as an unedited copy; the manifest then forgets it. A file the tool edited
+// in place, by injecting a managed block or adding an include directive, gets its backed up content back.
+// repoRoot: The root directory of the dotfiles repository.
+// backupDir: Root directory of backups.
+// runID: Identifier of the run to restore.
+// dryRun: If true, only shows what would be done without actually restoring files.
+func (s *FileLinkerService) Restore(repoRoot string, backupDir string, runID string, dryRun bool) (*RestoreResult, error) {
+	runDir := filepath.Join(backupDir, runID)
+	indexPath := filepath.Join(runDir, backupIndexFileName)
+	if !s.fs.FileExists(indexPath) {
+		return nil, fmt.Errorf("no backup found for run '%s' in %s", runID, backupDir)
+	}
+
+	if dryRun {
+		s.logger.Info("DRY RUN MODE: No files will be actually restored")
+	}
+
+	manifest, err := s.LoadManifest()
+	if err != nil {
+		return nil, err
+	}
+	forgotten := false
+
+	result := &RestoreResult{}
+	for _, target := range s.readBackupIndex(indexPath) {
+		backup := backupPath(runDir, target)
+		if !s.fs.FileExists(backup) && !s.fs.DirectoryExists(backup) && s.fs.GetLinkTarget(backup) == "" {
+			s.logger.Error(fmt.Sprintf("Backup of %s not found at %s", target, backup))
+			result.Skipped = append(result.Skipped, target)
+			continue
+		}
+
+		linkTarget := s.fs.GetLinkTarget(target)
+		state, record := manifest.findLink(target)
+		written := false
+		if linkTarget != "" && !util.IsSubPath(util.ResolveLinkTarget(target, linkTarget), repoRoot) && (record == nil || record.RunID != runID) {
+			s.logger.Error(fmt.Sprintf("Skipping %s: it links outside the repository (%s)", target, linkTarget))
+			result.Skipped = append(result.Skipped, target)
+			continue
+		}
+		if linkTarget == "" && (s.fs.FileExists(target) || s.fs.DirectoryExists(target)) {
+			reason := "a file that is not a link already exists there"
+			if record != nil && s.fs.FileExists(target) {
+				if written, reason, err = s.unchangedSinceWritten(record, backup); err != nil {
+					return result, err
+				}
+			}
+			if !written {
+				s.logger.Error(fmt.Sprintf("Skipping %s: %s", target, reason))
+				result.Skipped = append(result.Skipped, target)
+				continue
+			}
+		}
+
+		if dryRun {
+			s.logger.Success(fmt.Sprintf("[DRY-RUN] Would restore %s from %s", target, backup))
+			result.Restored = append(result.Restored, target)
+			continue
+		}
+
+		if written && record.Kind.rewrittenInPlace() {
+			if err := s.restoreInPlace(target, backup); err != nil {
+				return result, err
+			}
+		} else {
+			switch {
+			case linkTarget != "":
+				s.logger.Verbose(fmt.Sprintf("Removing symlink: %s -> %s", target, linkTarget))
+				if err := s.fs.Delete(target); err != nil {
+					return result, fmt.Errorf("failed to remove symlink %s: %w", target, err)
+				}
+			case written:
+				s.logger.Verbose(fmt.Sprintf("Removing %s written from %s", target, record.Source))
+				if err := s.fs.Delete(target); err != nil {
+					return result, fmt.Errorf("failed to remove %s: %w", target, err)
+				}
+			}
+
+			if err := s.fs.EnsureDirectory(filepath.Dir(target)); err != nil {
+				return result, fmt.Errorf("failed to create directory: %w", err)
+			}
+			s.logger.Success(fmt.Sprintf("Restoring %s from %s", target, backup))
+			if err := s.fs.Move(backup, target); err != nil {
+				return result, fmt.Errorf("failed to restore %s: %w", target, err)
+			}
+		}
+		s.removeEmptyParents(filepath.Dir(backup), runDir)
+		if state != nil {
+			state.removeLink(target)
+			forgotten = true
+		}
+		result.Restored = append(result.Restored, target)
+	}
+
+	if forgotten {
+		if err := s.saveManifest(manifest); err != nil {
+			return result, err
+		}
+	}
+	if !dryRun {
+		if len(result.Skipped) == 0 {
+			if err := s.fs.Delete(indexPath); err != nil {
+				return result, fmt.Errorf("failed to remove backup index: %w", err)
+			}
+			s.removeEmptyParents(runDir, backupDir)
+		} else if err := s.fs.WriteAllLines(indexPath, result.Skipped); err != nil {
+			return result, fmt.Errorf("failed to update backup index: %w", err)
+		}
+	}
+
+	verb := "Restored"
+	if dryRun {
+		verb = "Would restore"
+	}
+	s.logger.Success(fmt.Sprintf("%s %d targets, skipped %d", verb, len(result.Restored), len(result.Skipped)))
+
+	return result, nil
+}
+
+// unchangedSinceWritten reports whether the regular file at the target of a manifest record is still the one
+// the tool wrote, so Restore may replace it with its backup. Otherwise the reason explains why it is kept.
+// A file the tool rewrote in place must still be its backup with the managed part added, so no other edit is lost.
+func (s *FileLinkerService) unchangedSinceWritten(record *ManifestLink, backup string) (bool, string, error) {
+	target := record.Target
+	switch {
+	case record.Kind == LinkKindInjected:
+		content, err := s.fs.ReadFile(target)
+		if err != nil {
+			return false, "", fmt.Errorf("failed to read %s: %w", target, err)
+		}
+		body, found := extractBlock(string(content))
+		if !found || contentHash(body) != record.Hash {
+			return false, "the managed block was changed after it was written", nil
+		}
+		original, err := s.fs.ReadFile(backup)
+		if err != nil {
+			return false, "", fmt.Errorf("failed to read backup %s: %w", backup, err)
+		}
+		if injectBlock(string(original), body) != string(content) {
+			return false, "the file was changed after the managed block was written", nil
+		}
+	case record.Kind == LinkKindIncluded:
+		format, known := includeFormats[record.Format]
+		content, err := s.fs.ReadFile(target)
+		if err != nil {
+			return false, "", fmt.Errorf("failed to read %s: %w", target, err)
+		}
+		if !known || !hasInclude(string(content), format, record.Source) {
+			return false, "the include directive was removed after it was written", nil
+		}
+		original, err := s.fs.ReadFile(backup)
+		if err != nil {
+			return false, "", fmt.Errorf("failed to read backup %s: %w", backup, err)
+		}
+		if addInclude(string(original), format, record.Source) != string(content) {
+			return false, "the file was changed after the include directive was written", nil
+		}
+	case record.Kind.hashed():
+		hash, err := s.fs.FileHash(target)
+		if err != nil {
+			return false, "", fmt.Errorf("failed to hash %s: %w", target, err)
+		}
+		if hash != record.Hash {
+			return false, "the file was changed after it was written", nil
+		}
+	case record.Kind == LinkKindHardlink:
+		if same, err := s.fs.SameFile(record.Source, target); err != nil || !same {
+			return false, fmt.Sprintf("the file is no longer hard linked to %s", record.Source), nil
+		}
+	default:
+		return false, "a file that is not a link already exists there", nil
+	}
+	return true, "", nil
+}
+
+// restoreInPlace writes the content of the backup of a file that was rewritten in place back into it and removes the backup.
+// The file itself stays, so it keeps its mode and owner.
+func (s *FileLinkerService) restoreInPlace(target string, backup string) error {
+	original, err := s.fs.ReadFile(backup)
+	if err != nil {
+		return fmt.Errorf("failed to read backup %s: %w", backup, err)
+	}
+	s.logger.Success(fmt.Sprintf("Restoring the content of %s from %s", target, backup))
+	if err := s.fs.UpdateFile(target, original); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", target, err)
+	}
+	if err := s.fs.Delete(backup); err != nil {
+		return fmt.Errorf("failed to remove backup %s: %w", backup, err)
+	}
+	return nil
+}
+
+// readBackupIndex reads the target paths recorded in a backup index, ignoring blank lines.
+func (s *FileLinkerService) readBackupIndex(indexPath string) []string {
+	if !s.fs.FileExists(indexPath) {
+		return nil
+	}
+	lines, err := s.fs.ReadAllLines(indexPath)
+	if err != nil {
+		s.logger.Verbose(fmt.Sprintf("Failed to read backup index: %s", err))
+		return nil
+	}
+
+	var targets []string
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line != "" {
+			targets = append(targets, line)
+		}
+	}
+	return targets
+}
+
+// removeEmptyParents deletes dir and its parents while they are empty, stopping at (and excluding) stopAt.
+// Delete only removes empty directories, so a failure simply means the directory still has content.
+func (s *FileLinkerService) removeEmptyParents(dir string, stopAt string) {
+	for !util.PathEquals(dir, stopAt) && util.IsSubPath(dir, stopAt) {
+		if err := s.fs.Delete(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// backupPath returns where a target is stored inside a backup run directory.
+// The absolute target path is mirrored below runDir, e.g. /home/user/.bashrc becomes <runDir>/home/user/.bashrc.
+// On Windows, the drive letter becomes the first path element.
+func backupPath(runDir string, target string) string {
+	volume := filepath.VolumeName(target)
+	rest := strings.TrimLeft(target[len(volume):], `/\`)
+	volume = strings.Trim(volume, `:/\`)
+	return filepath.Join(runDir, volume, rest)
+}
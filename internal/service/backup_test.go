@@ -0,0 +1,256 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/guitarrapc/dotfileslinker-go/internal/infrastructure"
+)
+
+func TestFileLinkerService_Backup(t *testing.T) {
+	repoRoot := "/repo"
+	userHome := "/home/user"
+	ignoreFileName := ".ignore"
+	backupDir := "/home/user/.local/state/dotfileslinker/backups"
+
+	t.Run("Conflicting target is moved into the backup tree", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.now = func() time.Time { return time.Date(2025, 4, 21, 10, 30, 0, 0, time.UTC) }
+
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# repo bashrc")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{filepath.Join(repoRoot, ".bashrc")})
+		fs.AddFile(filepath.Join(userHome, ".bashrc"), "# user bashrc")
+
+		err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{
+			Conflict:  ConflictBackup,
+			BackupDir: backupDir,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		target := filepath.Join(userHome, ".bashrc")
+		if fs.GetLinkTarget(target) != filepath.Join(repoRoot, ".bashrc") {
+			t.Errorf("Link not created: %s -> %s", target, fs.GetLinkTarget(target))
+		}
+
+		backup := filepath.Join(backupDir, "20250421-103000.000000", "home", "user", ".bashrc")
+		if fs.Files[backup] != "# user bashrc" {
+			t.Errorf("Backup not found at %s", backup)
+		}
+		index := filepath.Join(backupDir, "20250421-103000.000000", backupIndexFileName)
+		if fs.Files[index] != target {
+			t.Errorf("Backup index not written, got %q", fs.Files[index])
+		}
+	})
+
+	t.Run("Runs within the same second back up to separate directories", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		service := NewFileLinkerService(fs, NewMockLogger())
+		start := time.Date(2025, 4, 21, 10, 30, 0, 0, time.UTC)
+
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# repo bashrc")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{filepath.Join(repoRoot, ".bashrc")})
+		target := filepath.Join(userHome, ".bashrc")
+
+		for i, content := range []string{"# first bashrc", "# second bashrc"} {
+			service.now = func() time.Time { return start.Add(time.Duration(i+1) * 100 * time.Millisecond) }
+			_ = fs.Delete(target)
+			fs.AddFile(target, content)
+
+			err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{
+				Conflict:  ConflictBackup,
+				BackupDir: backupDir,
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+
+		for runID, content := range map[string]string{"20250421-103000.100000": "# first bashrc", "20250421-103000.200000": "# second bashrc"} {
+			if backup := filepath.Join(backupDir, runID, "home", "user", ".bashrc"); fs.Files[backup] != content {
+				t.Errorf("Expected %q backed up at %s, got %q", content, backup, fs.Files[backup])
+			}
+		}
+	})
+
+	t.Run("Restore puts the backup back and removes the link", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		service := NewFileLinkerService(fs, NewMockLogger())
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# repo bashrc")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{filepath.Join(repoRoot, ".bashrc")})
+		fs.AddFile(filepath.Join(userHome, ".bashrc"), "# user bashrc")
+
+		err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{
+			Conflict:  ConflictBackup,
+			BackupDir: backupDir,
+			RunID:     "run1",
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		result, err := service.Restore(repoRoot, backupDir, "run1", false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		target := filepath.Join(userHome, ".bashrc")
+		if len(result.Restored) != 1 {
+			t.Errorf("Expected 1 restored target, got %v", result.Restored)
+		}
+		if fs.GetLinkTarget(target) != "" {
+			t.Error("Link was not removed")
+		}
+		if fs.Files[target] != "# user bashrc" {
+			t.Error("Original file was not restored")
+		}
+		if fs.DirectoryExists(filepath.Join(backupDir, "run1")) {
+			t.Error("Empty backup run directory was not removed")
+		}
+	})
+
+	t.Run("Restore skips targets replaced by regular files", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		service := NewFileLinkerService(fs, NewMockLogger())
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# repo bashrc")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{filepath.Join(repoRoot, ".bashrc")})
+		fs.AddFile(filepath.Join(userHome, ".bashrc"), "# user bashrc")
+
+		err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{
+			Conflict:  ConflictBackup,
+			BackupDir: backupDir,
+			RunID:     "run1",
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		target := filepath.Join(userHome, ".bashrc")
+		_ = fs.Delete(target)
+		fs.AddFile(target, "# newer user bashrc")
+
+		result, err := service.Restore(repoRoot, backupDir, "run1", false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(result.Skipped) != 1 || fs.Files[target] != "# newer user bashrc" {
+			t.Error("Restore overwrote a regular file")
+		}
+		if !fs.FileExists(filepath.Join(backupDir, "run1", backupIndexFileName)) {
+			t.Error("Backup index of skipped targets was removed")
+		}
+	})
+
+	t.Run("Restore skips targets linked outside the repository", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		service := NewFileLinkerService(fs, NewMockLogger())
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# repo bashrc")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{filepath.Join(repoRoot, ".bashrc")})
+		fs.AddFile(filepath.Join(userHome, ".bashrc"), "# user bashrc")
+
+		err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{
+			Conflict:  ConflictBackup,
+			BackupDir: backupDir,
+			RunID:     "run1",
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		// Another tool links the target elsewhere after the run
+		target := filepath.Join(userHome, ".bashrc")
+		_ = fs.Delete(target)
+		fs.SymLinks[target] = "/other/dotfiles/.bashrc"
+
+		result, err := service.Restore(repoRoot, backupDir, "run1", false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(result.Skipped) != 1 || fs.GetLinkTarget(target) != "/other/dotfiles/.bashrc" {
+			t.Error("Restore replaced a link outside the repository")
+		}
+		if fs.Files[filepath.Join(backupDir, "run1", "home", "user", ".bashrc")] != "# user bashrc" {
+			t.Error("Backup of the skipped target was removed")
+		}
+	})
+
+	t.Run("Dry run does not move anything", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		service := NewFileLinkerService(fs, NewMockLogger())
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# repo bashrc")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{filepath.Join(repoRoot, ".bashrc")})
+		fs.AddFile(filepath.Join(userHome, ".bashrc"), "# user bashrc")
+
+		err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{
+			Conflict:  ConflictBackup,
+			BackupDir: backupDir,
+			DryRun:    true,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.Files[filepath.Join(userHome, ".bashrc")] != "# user bashrc" {
+			t.Error("Target was moved in dry run mode")
+		}
+	})
+
+	t.Run("Unknown run", func(t *testing.T) {
+		service := NewFileLinkerService(infrastructure.NewMockFileSystem(), NewMockLogger())
+
+		if _, err := service.Restore(repoRoot, backupDir, "missing", false); err == nil {
+			t.Fatal("Expected error for an unknown run")
+		}
+	})
+}
+
+func TestBackupPath(t *testing.T) {
+	runDir := filepath.Join("/backups", "run1")
+	got := backupPath(runDir, filepath.Join("/home", "user", ".config", "git", "config"))
+	expected := filepath.Join(runDir, "home", "user", ".config", "git", "config")
+	if got != expected {
+		t.Errorf("backupPath() = %q; want %q", got, expected)
+	}
+}
+
+func TestFileLinkerService_BackupDanglingLink(t *testing.T) {
+	repoRoot := "/repo"
+	userHome := "/home/user"
+	backupDir := "/backups"
+
+	fs := infrastructure.NewMockFileSystem()
+	service := NewFileLinkerService(fs, NewMockLogger())
+
+	source := filepath.Join(repoRoot, ".bashrc")
+	fs.AddFile(source, "# repo bashrc")
+	fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+
+	// A dangling symlink is neither a file nor a directory
+	target := filepath.Join(userHome, ".bashrc")
+	fs.SymLinks[target] = "/old/repo/.bashrc"
+
+	err := service.LinkDotfilesWithOptions(repoRoot, userHome, ".ignore", LinkOptions{
+		Conflict:  ConflictBackup,
+		BackupDir: backupDir,
+		RunID:     "run1",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if fs.GetLinkTarget(target) != source {
+		t.Errorf("Dangling link was not replaced: %s -> %s", target, fs.GetLinkTarget(target))
+	}
+	if fs.SymLinks[filepath.Join(backupDir, "run1", "home", "user", ".bashrc")] != "/old/repo/.bashrc" {
+		t.Error("Dangling link was not backed up")
+	}
+
+	if _, err := service.Restore(repoRoot, backupDir, "run1", false); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if fs.GetLinkTarget(target) != "/old/repo/.bashrc" {
+		t.Errorf("Dangling link was not restored: %s -> %s", target, fs.GetLinkTarget(target))
+	}
+}
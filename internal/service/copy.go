@@ -0,0 +1,137 @@
+package service
+
+import (
+	"fmt"
+)
+
+// CopyDrift classifies how a copied target differs from the state recorded when it was copied.
+type CopyDrift int
+
+const (
+	// CopyUnchanged means neither the copy nor its source changed.
+	CopyUnchanged CopyDrift = iota
+	// CopyChangedInRepo means the source changed in the repository and the copy is outdated.
+	CopyChangedInRepo
+	// CopyChangedLocally means the copy was edited in place.
+	CopyChangedLocally
+	// CopyChangedInBoth means both the copy and its source changed.
+	CopyChangedInBoth
+)
+
+// String returns a description of the drift.
+func (d CopyDrift) String() string {
+	switch d {
+	case CopyUnchanged:
+		return "unchanged"
+	case CopyChangedInRepo:
+		return "changed in the repository"
+	case CopyChangedLocally:
+		return "changed locally"
+	case CopyChangedInBoth:
+		return "changed both locally and in the repository"
+	default:
+		return "unknown"
+	}
+}
+
+// copyDrift compares the source and the copy with the hash recorded when the copy was made.
+func (s *FileLinkerService) copyDrift(record *ManifestLink) (CopyDrift, error) {
+	sourceHash, err := s.fs.FileHash(record.Source)
+	if err != nil {
+		return CopyUnchanged, fmt.Errorf("failed to hash %s: %w", record.Source, err)
+	}
+	targetHash, err := s.fs.FileHash(record.Target)
+	if err != nil {
+		return CopyUnchanged, fmt.Errorf("failed to hash %s: %w", record.Target, err)
+	}
+
+	return classifyDrift(record.Hash, sourceHash, targetHash), nil
+}
+
+// classifyDrift compares the hashes of a source and its deployed target with the hash recorded when it was deployed.
+func classifyDrift(recorded string, sourceHash string, targetHash string) CopyDrift {
+	repoChanged := sourceHash != recorded
+	localChanged := targetHash != recorded
+	switch {
+	case repoChanged && localChanged:
+		// Both sides may have converged on the same content
+		if sourceHash == targetHash {
+			return CopyChangedInRepo
+		}
+		return CopyChangedInBoth
+	case localChanged:
+		return CopyChangedLocally
+	case repoChanged:
+		return CopyChangedInRepo
+	default:
+		return CopyUnchanged
+	}
+}
+
+// planCopy decides how a single entry is deployed in copy mode.
+// A copy that only changed in the repository is refreshed; a copy edited locally is a conflict,
+// so local edits are never overwritten without --force=y or --backup.
+func (s *FileLinkerService) planCopy(action Action, opts LinkOptions, state *RepositoryState) (Action, error) {
+	if action.IsDir {
+		return action, fmt.Errorf("'%s' is a directory; copy mode only deploys files", action.Source)
+	}
+
+	isRegularFile := s.fs.GetLinkTarget(action.Target) == "" && s.fs.FileExists(action.Target)
+	if !isRegularFile {
+		if s.fs.GetLinkTarget(action.Target) == "" && !s.fs.DirectoryExists(action.Target) {
+			action.Kind = ActionLink
+			action.Reason = "target does not exist"
+			return action, nil
+		}
+		return s.planConflict(action, s.describeExisting(action.Target), opts)
+	}
+
+	var record *ManifestLink
+	if state != nil {
+		record = state.Link(action.Target)
+	}
+	if record == nil || record.Kind != LinkKindCopy || record.Hash == "" {
+		// Not copied by us, but it may already hold the same content
+		same, err := s.sameContent(action.Source, action.Target)
+		if err != nil {
+			return action, err
+		}
+		if same {
+			action.Kind = ActionSkip
+			action.Reason = "copy is up to date"
+			return action, nil
+		}
+		return s.planConflict(action, "file", opts)
+	}
+
+	drift, err := s.copyDrift(record)
+	if err != nil {
+		return action, err
+	}
+	switch drift {
+	case CopyUnchanged:
+		action.Kind = ActionSkip
+		action.Reason = "copy is up to date"
+		return action, nil
+	case CopyChangedInRepo:
+		action.Kind = ActionReplace
+		action.Reason = "source changed in the repository"
+		return action, nil
+	default:
+		s.logger.Verbose(fmt.Sprintf("Copy %s %s", action.Target, drift))
+		return s.planConflict(action, fmt.Sprintf("copy %s", drift), opts)
+	}
+}
+
+// sameContent reports whether two files have the same content.
+func (s *FileLinkerService) sameContent(a string, b string) (bool, error) {
+	hashA, err := s.fs.FileHash(a)
+	if err != nil {
+		return false, fmt.Errorf("failed to hash %s: %w", a, err)
+	}
+	hashB, err := s.fs.FileHash(b)
+	if err != nil {
+		return false, fmt.Errorf("failed to hash %s: %w", b, err)
+	}
+	return hashA == hashB, nil
+}
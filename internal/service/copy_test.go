@@ -0,0 +1,313 @@
+package service
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/guitarrapc/dotfileslinker-go/internal/infrastructure"
+)
+
+func TestFileLinkerService_CopyMode(t *testing.T) {
+	repoRoot := "/repo"
+	userHome := "/home/user"
+	ignoreFileName := ".ignore"
+	manifestPath := "/state/dotfileslinker/manifest.json"
+	source := filepath.Join(repoRoot, ".bashrc")
+	target := filepath.Join(userHome, ".bashrc")
+
+	// countCopies counts the CopyFile operations performed so far
+	countCopies := func(fs *infrastructure.MockFileSystem) int {
+		count := 0
+		for _, op := range fs.OperationLog {
+			if strings.HasPrefix(op, "CopyFile:") {
+				count++
+			}
+		}
+		return count
+	}
+
+	t.Run("Copies the file and records its hash", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "# bashrc")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{Mode: ModeCopy}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if fs.GetLinkTarget(target) != "" {
+			t.Error("A symlink was created in copy mode")
+		}
+		if fs.Files[target] != "# bashrc" {
+			t.Errorf("Copy has unexpected content %q", fs.Files[target])
+		}
+
+		manifest, err := service.LoadManifest()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		record := manifest.Repository(repoRoot).Link(target)
+		if record == nil || record.Kind != LinkKindCopy || record.Hash == "" {
+			t.Errorf("Copy was not recorded with a hash: %+v", record)
+		}
+	})
+
+	t.Run("Unchanged copy is skipped", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "# bashrc")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{Mode: ModeCopy}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{Mode: ModeCopy}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if countCopies(fs) != 1 {
+			t.Errorf("Expected a single copy, got %d", countCopies(fs))
+		}
+	})
+
+	t.Run("Copy changed in the repository is refreshed without force", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "# bashrc")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{Mode: ModeCopy}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		fs.AddFile(source, "# bashrc v2")
+
+		plan, err := service.Plan(repoRoot, userHome, ignoreFileName, LinkOptions{Mode: ModeCopy})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if plan.Actions[0].Kind != ActionReplace || plan.Actions[0].Reason != "source changed in the repository" {
+			t.Errorf("Unexpected action: %+v", plan.Actions[0])
+		}
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{Mode: ModeCopy}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.Files[target] != "# bashrc v2" {
+			t.Errorf("Copy was not refreshed, got %q", fs.Files[target])
+		}
+	})
+
+	t.Run("Copy changed locally is a conflict", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "# bashrc")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{Mode: ModeCopy}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		fs.AddFile(target, "# edited")
+
+		err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{Mode: ModeCopy})
+		if err == nil || !strings.Contains(err.Error(), "changed locally") {
+			t.Fatalf("Expected a local change conflict, got %v", err)
+		}
+		if fs.Files[target] != "# edited" {
+			t.Error("Local change was overwritten")
+		}
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{Mode: ModeCopy, Conflict: ConflictOverwrite}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.Files[target] != "# bashrc" {
+			t.Errorf("Copy was not overwritten, got %q", fs.Files[target])
+		}
+	})
+
+	t.Run("Existing file with the same content is adopted as a copy", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "# bashrc")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		fs.AddFile(target, "# bashrc")
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{Mode: ModeCopy}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if countCopies(fs) != 0 {
+			t.Error("Identical file was copied again")
+		}
+
+		manifest, _ := service.LoadManifest()
+		if record := manifest.Repository(repoRoot).Link(target); record == nil || record.Kind != LinkKindCopy {
+			t.Errorf("Identical file was not recorded as a copy: %+v", record)
+		}
+	})
+
+	t.Run("Directory source is an error", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(filepath.Join(repoRoot, ".config"))
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{filepath.Join(repoRoot, ".config")})
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{Mode: ModeCopy}); err == nil {
+			t.Fatal("Expected error for a directory in copy mode")
+		}
+	})
+
+	t.Run("Status reports drift", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			repo     string
+			local    string
+			expected LinkState
+		}{
+			{"Unchanged", "# bashrc", "# bashrc", LinkStateLinked},
+			{"Changed in repository", "# v2", "# bashrc", LinkStateOutdated},
+			{"Changed locally", "# bashrc", "# edited", LinkStateModified},
+			{"Changed in both", "# v2", "# edited", LinkStateDiverged},
+			{"Both changed to the same content", "# v2", "# v2", LinkStateOutdated},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				fs := infrastructure.NewMockFileSystem()
+				fs.AddDirectory(userHome)
+				fs.AddFile(source, "# bashrc")
+				fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+				service := NewFileLinkerService(fs, NewMockLogger())
+				service.SetManifestPath(manifestPath)
+
+				if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{Mode: ModeCopy}); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				fs.AddFile(source, tt.repo)
+				fs.AddFile(target, tt.local)
+
+				statuses, err := service.Status(repoRoot, userHome, ignoreFileName)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if len(statuses) != 1 || statuses[0].State != tt.expected {
+					t.Errorf("Expected %s, got %+v", tt.expected, statuses)
+				}
+			})
+		}
+	})
+
+	t.Run("Unlink removes unchanged copies and keeps edited ones", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "# bashrc")
+		other := filepath.Join(repoRoot, ".vimrc")
+		fs.AddFile(other, "# vimrc")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source, other})
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{Mode: ModeCopy}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		fs.AddFile(filepath.Join(userHome, ".vimrc"), "# edited")
+
+		result, err := service.UnlinkDotfiles(repoRoot, userHome, ignoreFileName, false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if fs.FileExists(target) {
+			t.Error("Unchanged copy was not removed")
+		}
+		if !fs.FileExists(filepath.Join(userHome, ".vimrc")) {
+			t.Error("Edited copy was removed")
+		}
+		if len(result.Removed) != 1 || len(result.Modified) != 1 {
+			t.Errorf("Unexpected result: %+v", result)
+		}
+	})
+
+	t.Run("Restore replaces unchanged copies and keeps edited ones", func(t *testing.T) {
+		backupDir := "/state/dotfileslinker/backups"
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "# bashrc")
+		other := filepath.Join(repoRoot, ".vimrc")
+		fs.AddFile(other, "# vimrc")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source, other})
+		fs.AddFile(target, "# user bashrc")
+		fs.AddFile(filepath.Join(userHome, ".vimrc"), "# user vimrc")
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+
+		opts := LinkOptions{Mode: ModeCopy, Conflict: ConflictBackup, BackupDir: backupDir, RunID: "run1"}
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, opts); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		fs.AddFile(filepath.Join(userHome, ".vimrc"), "# edited")
+
+		result, err := service.Restore(repoRoot, backupDir, "run1", false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if fs.Files[target] != "# user bashrc" {
+			t.Errorf("Original file was not restored over the copy, got %q", fs.Files[target])
+		}
+		if fs.Files[filepath.Join(userHome, ".vimrc")] != "# edited" {
+			t.Error("Edited copy was replaced")
+		}
+		if len(result.Restored) != 1 || len(result.Skipped) != 1 {
+			t.Errorf("Unexpected result: %+v", result)
+		}
+		manifest, _ := service.LoadManifest()
+		if manifest.Repository(repoRoot).Link(target) != nil {
+			t.Error("Restored target is still recorded")
+		}
+	})
+}
+
+func TestParseLinkMode(t *testing.T) {
+	tests := map[string]LinkMode{
+		"symlink":  ModeSymlink,
+		"copy":     ModeCopy,
+		"COPY":     ModeCopy,
+		"hardlink": ModeHardlink,
+	}
+	for name, expected := range tests {
+		mode, err := ParseLinkMode(name)
+		if err != nil || mode != expected {
+			t.Errorf("ParseLinkMode(%q) = %v, %v; want %v", name, mode, err, expected)
+		}
+	}
+
+	if _, err := ParseLinkMode("move"); err == nil {
+		t.Error("Expected error for an unknown mode")
+	}
+}
+
+func TestCopyDrift_String(t *testing.T) {
+	tests := map[CopyDrift]string{
+		CopyUnchanged:      "unchanged",
+		CopyChangedInRepo:  "changed in the repository",
+		CopyChangedLocally: "changed locally",
+		CopyChangedInBoth:  "changed both locally and in the repository",
+		CopyDrift(99):      "unknown",
+	}
+	for drift, expected := range tests {
+		if drift.String() != expected {
+			t.Errorf("CopyDrift(%d).String() = %q; want %q", int(drift), drift.String(), expected)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// CheckStatus is the outcome of a single Doctor check.
+type CheckStatus int
+
+const (
+	// CheckPass means nothing needs to be done.
+	CheckPass CheckStatus = iota
+	// CheckWarn means linking may partly fail or behave unexpectedly.
+	CheckWarn
+	// CheckFail means linking will fail until the problem is fixed.
+	CheckFail
+)
+
+// String returns the display name of the check status.
+func (c CheckStatus) String() string {
+	switch c {
+	case CheckPass:
+		return "pass"
+	case CheckWarn:
+		return "warn"
+	case CheckFail:
+		return "fail"
+	default:
+		return "unknown"
+	}
+}
+
+// CheckResult reports the outcome of a single Doctor check.
+type CheckResult struct {
+	Name    string      // What was checked
+	Status  CheckStatus // Outcome of the check
+	Message string      // What was found
+	Fix     string      // Suggested fix; empty when the check passed
+}
+
+// Doctor checks the environment for problems that would make linking fail, without modifying anything
+// except for a probe symlink that is removed immediately.
+// repoRoot: The root directory of the dotfiles repository.
+// userHome: The user's home directory path.
+// ignoreFileName: The name of the ignore file containing patterns to exclude.
+func (s *FileLinkerService) Doctor(repoRoot string, userHome string, ignoreFileName string) []CheckResult {
+	homeWritable := s.fs.IsWritable(userHome)
+	return []CheckResult{
+		s.checkRepository(repoRoot),
+		s.checkIgnoreFile(filepath.Join(repoRoot, ignoreFileName)),
+		s.checkHomeOwnership(userHome),
+		s.checkHomeWritable(userHome, homeWritable),
+		s.checkSymlinks(repoRoot, userHome, homeWritable),
+		s.checkMappedElevation(repoRoot, userHome, ignoreFileName),
+	}
+}
+
+// checkRepository checks that the repository exists and can be listed.
+func (s *FileLinkerService) checkRepository(repoRoot string) CheckResult {
+	result := CheckResult{Name: "Repository is readable"}
+	if !s.fs.DirectoryExists(repoRoot) {
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("%s does not exist", repoRoot)
+		result.Fix = "Run from your dotfiles repository, or pass --root or set DOTFILES_ROOT"
+		return result
+	}
+	if _, err := s.fs.EnumerateFiles(repoRoot, ".*", false); err != nil {
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("cannot list %s: %s", repoRoot, err)
+		result.Fix = fmt.Sprintf("Make %s readable by the current user", repoRoot)
+		return result
+	}
+	result.Message = repoRoot
+	return result
+}
+
+// checkIgnoreFile checks that the ignore file, when present, can be read and only uses supported syntax.
+func (s *FileLinkerService) checkIgnoreFile(ignorePath string) CheckResult {
+	result := CheckResult{Name: "Ignore file is valid"}
+	if !s.fs.FileExists(ignorePath) {
+		result.Message = fmt.Sprintf("%s not found; only the default patterns apply", ignorePath)
+		return result
+	}
+
+	lines, err := s.fs.ReadAllLines(ignorePath)
+	if err != nil {
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("cannot read %s: %s", ignorePath, err)
+		result.Fix = fmt.Sprintf("Make %s readable by the current user", ignorePath)
+		return result
+	}
+
+	var problems []string
+	for i, line := range lines {
+		pattern := strings.TrimSpace(line)
+		switch {
+		case pattern == "!":
+			problems = append(problems, fmt.Sprintf("line %d: negation without a pattern", i+1))
+		case strings.ContainsAny(pattern, "[]"):
+			problems = append(problems, fmt.Sprintf("line %d: character classes are not supported in %q", i+1, pattern))
+		case runtime.GOOS != "windows" && strings.Contains(pattern, "\\"):
+			problems = append(problems, fmt.Sprintf("line %d: backslash in %q is matched literally", i+1, pattern))
+		}
+	}
+	if len(problems) > 0 {
+		result.Status = CheckWarn
+		result.Message = strings.Join(problems, "; ")
+		result.Fix = "Use only *, ?, ** and / in patterns, and ! followed by a pattern to negate it"
+		return result
+	}
+
+	result.Message = fmt.Sprintf("%s (%d lines)", ignorePath, len(lines))
+	return result
+}
+
+// checkHomeOwnership checks that the home directory belongs to the current user.
+func (s *FileLinkerService) checkHomeOwnership(userHome string) CheckResult {
+	result := CheckResult{Name: "Home directory is owned by the current user"}
+	owned, err := s.fs.IsOwnedByCurrentUser(userHome)
+	switch {
+	case err != nil:
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("cannot inspect %s: %s", userHome, err)
+		result.Fix = "Pass --home or set DOTFILES_HOME to an existing directory"
+	case !owned:
+		result.Status = CheckWarn
+		result.Message = fmt.Sprintf("%s is owned by another user; links would be created with the wrong owner", userHome)
+		result.Fix = "Run as the owner of the home directory, or pass --home to link into your own"
+	default:
+		result.Message = userHome
+	}
+	return result
+}
+
+// checkHomeWritable checks that links can be created in the home directory.
+func (s *FileLinkerService) checkHomeWritable(userHome string, writable bool) CheckResult {
+	result := CheckResult{Name: "Home directory is writable"}
+	if !writable {
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("cannot create entries in %s", userHome)
+		result.Fix = fmt.Sprintf("Grant write permission on %s to the current user", userHome)
+		return result
+	}
+	result.Message = userHome
+	return result
+}
+
+// checkSymlinks checks that the current user can create symbolic links in the home directory
+// by creating and removing a probe link.
+func (s *FileLinkerService) checkSymlinks(repoRoot string, userHome string, homeWritable bool) CheckResult {
+	result := CheckResult{Name: "Symbolic links can be created"}
+	if !homeWritable {
+		result.Status = CheckWarn
+		result.Message = "skipped because the home directory is not writable"
+		result.Fix = "Fix the home directory permissions first"
+		return result
+	}
+
+	probe := filepath.Join(userHome, fmt.Sprintf(".dotfileslinker-doctor-%s", s.newRunID()))
+	if err := s.fs.CreateFileSymlink(probe, repoRoot); err != nil {
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("cannot create a symlink in %s: %s", userHome, err)
+		if runtime.GOOS == "windows" {
+			result.Fix = "Enable Developer Mode in Windows settings, or run as administrator"
+		} else {
+			result.Fix = "Make sure the file system of the home directory supports symbolic links"
+		}
+		return result
+	}
+	if err := s.fs.Delete(probe); err != nil {
+		result.Status = CheckWarn
+		result.Message = fmt.Sprintf("probe link %s could not be removed: %s", probe, err)
+		result.Fix = fmt.Sprintf("Remove %s manually", probe)
+		return result
+	}
+	result.Message = userHome
+	return result
+}
+
+// checkMappedElevation checks whether the directories that the files of HOME, ROOT and the directories in
+// dotfiles_mappings are linked into are writable, which usually means the tool has to be run with elevated privileges.
+// Mappings that do not apply to this OS, such as ROOT on Windows, are not checked.
+func (s *FileLinkerService) checkMappedElevation(repoRoot string, userHome string, ignoreFileName string) CheckResult {
+	result := CheckResult{Name: "Mapped files can be linked"}
+
+	entries, err := s.collectMappings(repoRoot, userHome, s.loadIgnoreList(filepath.Join(repoRoot, ignoreFileName)))
+	if err != nil {
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("cannot list the mapped directories: %s", err)
+		result.Fix = fmt.Sprintf("Fix %s and make the mapped directories readable by the current user", filepath.Join(repoRoot, MappingsFileName))
+		return result
+	}
+
+	unwritable := make(map[string]bool)
+	count, elevated := 0, 0
+	for _, entry := range entries {
+		if entry.ignored {
+			continue
+		}
+		count++
+		dir := s.nearestExistingDirectory(filepath.Dir(entry.target))
+		if !s.fs.IsWritable(dir) {
+			unwritable[dir] = true
+			elevated++
+		}
+	}
+	if count == 0 {
+		result.Message = "no mapped files to link"
+		return result
+	}
+	if len(unwritable) > 0 {
+		dirs := make([]string, 0, len(unwritable))
+		for dir := range unwritable {
+			dirs = append(dirs, dir)
+		}
+		sort.Strings(dirs)
+		result.Status = CheckWarn
+		result.Message = fmt.Sprintf("%d of %d mapped files need elevated privileges to write to %s", elevated, count, strings.Join(dirs, ", "))
+		result.Fix = "Run with sudo and pass --home so links are still created in your home directory"
+		return result
+	}
+	result.Message = fmt.Sprintf("%d mapped files", count)
+	return result
+}
+
+// nearestExistingDirectory returns dir or its closest ancestor that exists.
+func (s *FileLinkerService) nearestExistingDirectory(dir string) string {
+	for !s.fs.DirectoryExists(dir) && filepath.Dir(dir) != dir {
+		dir = filepath.Dir(dir)
+	}
+	return dir
+}
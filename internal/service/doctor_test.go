@@ -0,0 +1,243 @@
+package service
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/guitarrapc/dotfileslinker-go/internal/infrastructure"
+)
+
+func TestFileLinkerService_Doctor(t *testing.T) {
+	repoRoot := "/repo"
+	userHome := "/home/user"
+	ignoreFileName := ".ignore"
+
+	// find returns the result of the named check
+	find := func(t *testing.T, results []CheckResult, name string) CheckResult {
+		t.Helper()
+		for _, result := range results {
+			if result.Name == name {
+				return result
+			}
+		}
+		t.Fatalf("Check %q was not run", name)
+		return CheckResult{}
+	}
+
+	t.Run("Healthy environment passes every check", func(t *testing.T) {
+		// Healthy environment with a repository, an ignore file and a writable home
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(repoRoot)
+		fs.AddDirectory(userHome)
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# bashrc")
+		fs.AddFile(filepath.Join(repoRoot, ignoreFileName), "README.md\n*.bak\n!keep.bak")
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+
+		results := service.Doctor(repoRoot, userHome, ignoreFileName)
+
+		if len(results) != 6 {
+			t.Fatalf("Expected 6 checks, got %d", len(results))
+		}
+		for _, result := range results {
+			if result.Status != CheckPass {
+				t.Errorf("Check %q: expected pass, got %s (%s)", result.Name, result.Status, result.Message)
+			}
+			if result.Fix != "" {
+				t.Errorf("Check %q passed but suggests a fix", result.Name)
+			}
+		}
+		if len(fs.SymLinks) != 0 {
+			t.Errorf("Probe link was left behind: %v", fs.SymLinks)
+		}
+	})
+
+	t.Run("Missing repository fails", func(t *testing.T) {
+		// Healthy environment with a repository, an ignore file and a writable home
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(repoRoot)
+		fs.AddDirectory(userHome)
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# bashrc")
+		fs.AddFile(filepath.Join(repoRoot, ignoreFileName), "README.md\n*.bak\n!keep.bak")
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+
+		result := find(t, service.Doctor("/missing", userHome, ignoreFileName), "Repository is readable")
+		if result.Status != CheckFail || result.Fix == "" {
+			t.Errorf("Expected fail with a fix, got %+v", result)
+		}
+	})
+
+	t.Run("Unsupported ignore patterns warn", func(t *testing.T) {
+		// Healthy environment with a repository, an ignore file and a writable home
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(repoRoot)
+		fs.AddDirectory(userHome)
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# bashrc")
+		fs.AddFile(filepath.Join(repoRoot, ignoreFileName), "README.md\n*.bak\n!keep.bak")
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		fs.AddFile(filepath.Join(repoRoot, ignoreFileName), "README.md\n[ab].txt\n!")
+
+		result := find(t, service.Doctor(repoRoot, userHome, ignoreFileName), "Ignore file is valid")
+		if result.Status != CheckWarn {
+			t.Fatalf("Expected warn, got %+v", result)
+		}
+		if !strings.Contains(result.Message, "line 2") || !strings.Contains(result.Message, "line 3") {
+			t.Errorf("Expected both problem lines to be reported, got %q", result.Message)
+		}
+	})
+
+	t.Run("Unreadable ignore file fails", func(t *testing.T) {
+		// Healthy environment with a repository, an ignore file and a writable home
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(repoRoot)
+		fs.AddDirectory(userHome)
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# bashrc")
+		fs.AddFile(filepath.Join(repoRoot, ignoreFileName), "README.md\n*.bak\n!keep.bak")
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		fs.SetErrorForOperation("ReadAllLines:"+filepath.Join(repoRoot, ignoreFileName), errTest)
+
+		result := find(t, service.Doctor(repoRoot, userHome, ignoreFileName), "Ignore file is valid")
+		if result.Status != CheckFail {
+			t.Errorf("Expected fail, got %+v", result)
+		}
+	})
+
+	t.Run("Home owned by another user warns", func(t *testing.T) {
+		// Healthy environment with a repository, an ignore file and a writable home
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(repoRoot)
+		fs.AddDirectory(userHome)
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# bashrc")
+		fs.AddFile(filepath.Join(repoRoot, ignoreFileName), "README.md\n*.bak\n!keep.bak")
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		fs.ForeignPaths[userHome] = true
+
+		result := find(t, service.Doctor(repoRoot, userHome, ignoreFileName), "Home directory is owned by the current user")
+		if result.Status != CheckWarn {
+			t.Errorf("Expected warn, got %+v", result)
+		}
+	})
+
+	t.Run("Read-only home fails and skips the symlink probe", func(t *testing.T) {
+		// Healthy environment with a repository, an ignore file and a writable home
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(repoRoot)
+		fs.AddDirectory(userHome)
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# bashrc")
+		fs.AddFile(filepath.Join(repoRoot, ignoreFileName), "README.md\n*.bak\n!keep.bak")
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		fs.ReadOnlyPaths[userHome] = true
+
+		results := service.Doctor(repoRoot, userHome, ignoreFileName)
+		if result := find(t, results, "Home directory is writable"); result.Status != CheckFail {
+			t.Errorf("Expected fail, got %+v", result)
+		}
+		if result := find(t, results, "Symbolic links can be created"); result.Status != CheckWarn {
+			t.Errorf("Expected warn, got %+v", result)
+		}
+		for _, op := range fs.OperationLog {
+			if strings.HasPrefix(op, "CreateFileSymlink:") {
+				t.Errorf("Probe link was created in a read-only home: %s", op)
+			}
+		}
+	})
+
+	t.Run("Symlink creation failure fails", func(t *testing.T) {
+		// Healthy environment with a repository, an ignore file and a writable home
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(repoRoot)
+		fs.AddDirectory(userHome)
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# bashrc")
+		fs.AddFile(filepath.Join(repoRoot, ignoreFileName), "README.md\n*.bak\n!keep.bak")
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) }
+		probe := filepath.Join(userHome, ".dotfileslinker-doctor-20240102-030405.000000")
+		fs.SetErrorForOperation("CreateFileSymlink:"+probe, errTest)
+
+		result := find(t, service.Doctor(repoRoot, userHome, ignoreFileName), "Symbolic links can be created")
+		if result.Status != CheckFail || result.Fix == "" {
+			t.Errorf("Expected fail with a fix, got %+v", result)
+		}
+	})
+
+	t.Run("Mapped files in unwritable directories warn", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("ROOT is not processed on Windows")
+		}
+		// Healthy environment with a repository, an ignore file and a writable home
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(repoRoot)
+		fs.AddDirectory(userHome)
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# bashrc")
+		fs.AddFile(filepath.Join(repoRoot, ignoreFileName), "README.md\n*.bak\n!keep.bak")
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		files := map[string]string{
+			"ROOT":  filepath.Join("etc", "app", "app.conf"),
+			"TOOLS": "run.sh",
+		}
+		for dir, file := range files {
+			path := filepath.Join(repoRoot, dir, file)
+			fs.AddDirectory(filepath.Join(repoRoot, dir))
+			fs.AddFile(path, "# "+dir)
+			fs.SetupFileEnumeration(filepath.Join(repoRoot, dir), "*", true, []string{path})
+		}
+		fs.AddFile(filepath.Join(repoRoot, MappingsFileName), "TOOLS /opt/tools\n")
+		fs.AddDirectory("/etc")
+		fs.AddDirectory("/opt")
+		fs.ReadOnlyPaths["/etc"] = true
+		fs.ReadOnlyPaths["/opt"] = true
+
+		result := find(t, service.Doctor(repoRoot, userHome, ignoreFileName), "Mapped files can be linked")
+		if result.Status != CheckWarn {
+			t.Fatalf("Expected warn, got %+v", result)
+		}
+		if !strings.Contains(result.Message, "/etc, /opt") {
+			t.Errorf("Expected the nearest existing directories to be reported, got %q", result.Message)
+		}
+	})
+
+	t.Run("Mappings for other OS are not checked", func(t *testing.T) {
+		// Healthy environment with a repository, an ignore file and a writable home
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(repoRoot)
+		fs.AddDirectory(userHome)
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# bashrc")
+		fs.AddFile(filepath.Join(repoRoot, ignoreFileName), "README.md\n*.bak\n!keep.bak")
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.host = func() HostInfo { return HostInfo{OS: "windows"} }
+		fs.AddDirectory(filepath.Join(repoRoot, "ROOT"))
+		fs.AddFile(filepath.Join(repoRoot, "ROOT", "app.conf"), "# app")
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "ROOT"), "*", true, []string{filepath.Join(repoRoot, "ROOT", "app.conf")})
+		// The file system root is not registered, so a ROOT file would need elevated privileges
+
+		result := find(t, service.Doctor(repoRoot, userHome, ignoreFileName), "Mapped files can be linked")
+		if result.Status != CheckPass {
+			t.Errorf("Expected ROOT to be skipped, got %+v", result)
+		}
+	})
+}
+
+func TestCheckStatus_String(t *testing.T) {
+	tests := map[CheckStatus]string{
+		CheckPass:       "pass",
+		CheckWarn:       "warn",
+		CheckFail:       "fail",
+		CheckStatus(99): "unknown",
+	}
+	for status, expected := range tests {
+		if status.String() != expected {
+			t.Errorf("CheckStatus(%d).String() = %q; want %q", int(status), status.String(), expected)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// encryptedSuffix marks sources encrypted with age. They are decrypted with the local identity
+// and written to the target path without the suffix instead of linked.
+const encryptedSuffix = ".age"
+
+// encryptedMode is the mode of decrypted files, which only their owner can read.
+const encryptedMode fs.FileMode = 0600
+
+// SetIdentityPath sets the age identity file used to decrypt and encrypt sources.
+// The file holds one or more X25519 identities, as written by age-keygen.
+func (s *FileLinkerService) SetIdentityPath(path string) {
+	s.identityPath = path
+}
+
+// loadIdentities reads the identities of the age identity file.
+func (s *FileLinkerService) loadIdentities() ([]age.Identity, error) {
+	if s.identityPath == "" {
+		return nil, fmt.Errorf("no age identity file is configured")
+	}
+	if !s.fs.FileExists(s.identityPath) {
+		return nil, fmt.Errorf("age identity %s does not exist; create one with 'age-keygen -o %s'", s.identityPath, s.identityPath)
+	}
+	content, err := s.fs.ReadFile(s.identityPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read age identity %s: %w", s.identityPath, err)
+	}
+	identities, err := age.ParseIdentities(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse age identity %s: %w", s.identityPath, err)
+	}
+	return identities, nil
+}
+
+// decrypter decrypts the encrypted sources of a repository.
+// The identities are loaded on first use, so a missing identity only matters when there are encrypted sources.
+type decrypter struct {
+	s          *FileLinkerService
+	identities []age.Identity
+}
+
+// newDecrypter creates a decrypter with the identity file of the service.
+func (s *FileLinkerService) newDecrypter() *decrypter {
+	return &decrypter{s: s}
+}
+
+// decrypt returns the plaintext of the encrypted source. Both binary and ASCII armored files are accepted.
+func (d *decrypter) decrypt(source string) (string, error) {
+	if d.identities == nil {
+		identities, err := d.s.loadIdentities()
+		if err != nil {
+			return "", err
+		}
+		d.identities = identities
+	}
+
+	content, err := d.s.fs.ReadFile(source)
+	if err != nil {
+		return "", fmt.Errorf("failed to read encrypted file %s: %w", source, err)
+	}
+	var ciphertext io.Reader = bytes.NewReader(content)
+	if bytes.HasPrefix(bytes.TrimSpace(content), []byte(armor.Header)) {
+		ciphertext = armor.NewReader(bufio.NewReader(ciphertext))
+	}
+	plaintext, err := age.Decrypt(ciphertext, d.identities...)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt %s with %s: %w", source, d.s.identityPath, err)
+	}
+	decrypted, err := io.ReadAll(plaintext)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt %s: %w", source, err)
+	}
+	return string(decrypted), nil
+}
+
+// markEncrypted marks the entries whose source is encrypted and removes the suffix from their target.
+func (s *FileLinkerService) markEncrypted(entries []linkEntry) {
+	for i := range entries {
+		name := filepath.Base(entries[i].target)
+		if !strings.HasSuffix(name, encryptedSuffix) || name == encryptedSuffix || s.fs.DirectoryExists(entries[i].source) {
+			continue
+		}
+		entries[i].encrypted = true
+		entries[i].target = strings.TrimSuffix(entries[i].target, encryptedSuffix)
+	}
+}
+
+// Encrypt moves a plaintext file into the repository in encrypted form, to the path Adopt would use with the
+// encrypted suffix. The file is encrypted to the identities of the age identity file and stays in place as the
+// decrypted target, readable only by its owner and recorded in the manifest like a linked file.
+// repoRoot: The root directory of the dotfiles repository.
+// userHome: The user's home directory path.
+// path: The absolute path of the file to encrypt.
+// dryRun: If true, only shows what would be done without writing anything.
+// Returns the path of the encrypted file in the repository.
+func (s *FileLinkerService) Encrypt(repoRoot string, userHome string, path string, dryRun bool) (string, error) {
+	if s.fs.GetLinkTarget(path) != "" {
+		return "", fmt.Errorf("'%s' is a symbolic link", path)
+	}
+	if s.fs.DirectoryExists(path) {
+		return "", fmt.Errorf("'%s' is a directory; only files can be encrypted", path)
+	}
+	if !s.fs.FileExists(path) {
+		return "", fmt.Errorf("'%s' does not exist", path)
+	}
+
+	plainPath, err := s.adoptDestination(repoRoot, userHome, path, false)
+	if err != nil {
+		return "", err
+	}
+	repoPath := plainPath + encryptedSuffix
+	for _, existing := range []string{plainPath, repoPath} {
+		if s.fs.FileExists(existing) || s.fs.DirectoryExists(existing) {
+			return "", fmt.Errorf("'%s' already exists in the repository", existing)
+		}
+	}
+
+	identities, err := s.loadIdentities()
+	if err != nil {
+		return "", err
+	}
+	var recipients []age.Recipient
+	for _, identity := range identities {
+		if x25519, ok := identity.(*age.X25519Identity); ok {
+			recipients = append(recipients, x25519.Recipient())
+		}
+	}
+	if len(recipients) == 0 {
+		return "", fmt.Errorf("age identity %s holds no X25519 identity to encrypt to", s.identityPath)
+	}
+
+	plaintext, err := s.fs.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read '%s': %w", path, err)
+	}
+	var ciphertext bytes.Buffer
+	writer, err := age.Encrypt(&ciphertext, recipients...)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt '%s': %w", path, err)
+	}
+	if _, err := writer.Write(plaintext); err != nil {
+		return "", fmt.Errorf("failed to encrypt '%s': %w", path, err)
+	}
+	if err := writer.Close(); err != nil {
+		return "", fmt.Errorf("failed to encrypt '%s': %w", path, err)
+	}
+
+	if dryRun {
+		s.logger.Success(fmt.Sprintf("[DRY-RUN] Would encrypt %s to %s", path, repoPath))
+		return repoPath, nil
+	}
+
+	if err := s.fs.EnsureDirectory(filepath.Dir(repoPath)); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+	s.logger.Success(fmt.Sprintf("Encrypting %s to %s", path, repoPath))
+	if err := s.fs.WriteFile(repoPath, ciphertext.Bytes()); err != nil {
+		return "", fmt.Errorf("failed to write '%s': %w", repoPath, err)
+	}
+
+	s.logger.Verbose(fmt.Sprintf("Restricting %s to its owner", path))
+	if err := s.fs.SetMode(path, encryptedMode); err != nil {
+		if deleteErr := s.fs.Delete(repoPath); deleteErr != nil {
+			return "", fmt.Errorf("failed to restrict '%s' (%v) and failed to remove '%s': %w", path, err, repoPath, deleteErr)
+		}
+		return "", fmt.Errorf("failed to restrict '%s': %w", path, err)
+	}
+
+	plan := &Plan{RepoRoot: repoRoot, UserHome: userHome, Options: LinkOptions{RunID: s.newRunID()}}
+	plan.Actions = append(plan.Actions, Action{
+		Kind:      ActionSkip,
+		Source:    repoPath,
+		Target:    path,
+		Encrypted: true,
+		Content:   string(plaintext),
+		Reason:    "decrypted file is up to date",
+	})
+	if err := s.recordPlan(plan); err != nil {
+		return repoPath, fmt.Errorf("'%s' was encrypted but the manifest could not be updated: %w", path, err)
+	}
+	return repoPath, nil
+}
@@ -0,0 +1,416 @@
+package service
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+
+	"github.com/guitarrapc/dotfileslinker-go/internal/infrastructure"
+)
+
+// encryptForTest encrypts plaintext to the identity, optionally ASCII armored
+func encryptForTest(t *testing.T, identity *age.X25519Identity, plaintext string, armored bool) string {
+	t.Helper()
+	var out bytes.Buffer
+	var dst io.WriteCloser = nopWriteCloser{&out}
+	if armored {
+		dst = armor.NewWriter(&out)
+	}
+	writer, err := age.Encrypt(dst, identity.Recipient())
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	if _, err := io.WriteString(writer, plaintext); err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	if err := dst.Close(); err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	return out.String()
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestFileLinkerService_Encrypted(t *testing.T) {
+	repoRoot := "/repo"
+	userHome := "/home/user"
+	ignoreFileName := ".ignore"
+	manifestPath := "/state/dotfileslinker/manifest.json"
+	identityPath := "/config/dotfileslinker/identity.txt"
+	source := filepath.Join(repoRoot, ".netrc.age")
+	target := filepath.Join(userHome, ".netrc")
+	secret := "machine api.example.com password hunter2\n"
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("Failed to generate identity: %v", err)
+	}
+
+	t.Run("Encrypted file is decrypted without its suffix", func(t *testing.T) {
+		// Repository with a single encrypted file and the identity that decrypts it
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, encryptForTest(t, identity, secret, false))
+		fs.AddFile(identityPath, "# created: today\n"+identity.String()+"\n")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		service.SetIdentityPath(identityPath)
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if fs.Files[target] != secret {
+			t.Errorf("Decrypted file has unexpected content %q", fs.Files[target])
+		}
+		if fs.Modes[target] != encryptedMode {
+			t.Errorf("Expected mode 0600, got %04o", fs.Modes[target])
+		}
+		if fs.GetLinkTarget(target) != "" || fs.FileExists(target+encryptedSuffix) {
+			t.Error("Encrypted file was linked instead of decrypted")
+		}
+
+		manifest, _ := service.LoadManifest()
+		record := manifest.Repository(repoRoot).Link(target)
+		if record == nil || record.Kind != LinkKindEncrypted || record.Hash != contentHash(secret) {
+			t.Errorf("Decrypted file was not recorded with its hash: %+v", record)
+		}
+		statuses, err := service.Status(repoRoot, userHome, ignoreFileName)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(statuses) != 1 || statuses[0].State != LinkStateLinked {
+			t.Errorf("Expected the decrypted file to be linked, got %+v", statuses)
+		}
+	})
+
+	t.Run("Armored file is decrypted", func(t *testing.T) {
+		// Repository with a single encrypted file and the identity that decrypts it
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, encryptForTest(t, identity, secret, false))
+		fs.AddFile(identityPath, "# created: today\n"+identity.String()+"\n")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		service.SetIdentityPath(identityPath)
+		fs.AddFile(source, encryptForTest(t, identity, secret, true))
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.Files[target] != secret {
+			t.Errorf("Decrypted file has unexpected content %q", fs.Files[target])
+		}
+	})
+
+	t.Run("Encrypted template is decrypted, then rendered", func(t *testing.T) {
+		// Repository with a single encrypted file and the identity that decrypts it
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, encryptForTest(t, identity, secret, false))
+		fs.AddFile(identityPath, "# created: today\n"+identity.String()+"\n")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		service.SetIdentityPath(identityPath)
+		templateSource := filepath.Join(repoRoot, ".netrc.tmpl.age")
+		fs.AddFile(templateSource, encryptForTest(t, identity, "machine {{ .Hostname }} password hunter2\n", false))
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{templateSource})
+		service.host = func() HostInfo { return HostInfo{Hostname: "api.example.com"} }
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.Files[target] != secret {
+			t.Errorf("Encrypted template has unexpected content %q", fs.Files[target])
+		}
+		if fs.Modes[target] != encryptedMode {
+			t.Errorf("Expected mode 0600, got %04o", fs.Modes[target])
+		}
+		manifest, _ := service.LoadManifest()
+		if record := manifest.Repository(repoRoot).Link(target); record == nil || record.Kind != LinkKindEncrypted {
+			t.Errorf("Encrypted template was not recorded as encrypted: %+v", record)
+		}
+		statuses, err := service.Status(repoRoot, userHome, ignoreFileName)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(statuses) != 1 || statuses[0].State != LinkStateLinked {
+			t.Errorf("Expected the encrypted template to be linked, got %+v", statuses)
+		}
+	})
+
+	t.Run("Changed source is rewritten and local edits conflict", func(t *testing.T) {
+		// Repository with a single encrypted file and the identity that decrypts it
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, encryptForTest(t, identity, secret, false))
+		fs.AddFile(identityPath, "# created: today\n"+identity.String()+"\n")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		service.SetIdentityPath(identityPath)
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		fs.AddFile(source, encryptForTest(t, identity, "machine new.example.com\n", false))
+
+		plan, err := service.Plan(repoRoot, userHome, ignoreFileName, LinkOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if plan.Actions[0].Kind != ActionReplace || plan.Actions[0].Reason != "encrypted source changed" {
+			t.Fatalf("Unexpected action: %+v", plan.Actions[0])
+		}
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.Files[target] != "machine new.example.com\n" || fs.Modes[target] != encryptedMode {
+			t.Errorf("Decrypted file was not rewritten privately: %q %04o", fs.Files[target], fs.Modes[target])
+		}
+
+		fs.AddFile(target, "# edited")
+		err = service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{})
+		if err == nil || !strings.Contains(err.Error(), "decrypted file changed locally") {
+			t.Fatalf("Expected a local change conflict, got %v", err)
+		}
+	})
+
+	t.Run("Missing identity is an error only with encrypted files", func(t *testing.T) {
+		// Repository with a single encrypted file and the identity that decrypts it
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, encryptForTest(t, identity, secret, false))
+		fs.AddFile(identityPath, "# created: today\n"+identity.String()+"\n")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		service.SetIdentityPath(identityPath)
+		delete(fs.Files, identityPath)
+
+		err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{})
+		if err == nil || !strings.Contains(err.Error(), "age-keygen") {
+			t.Fatalf("Expected a missing identity error, got %v", err)
+		}
+
+		plain := filepath.Join(repoRoot, ".bashrc")
+		fs.AddFile(plain, "# bashrc")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{plain})
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err != nil {
+			t.Fatalf("Unexpected error without encrypted files: %v", err)
+		}
+	})
+
+	t.Run("Other identity cannot decrypt", func(t *testing.T) {
+		// Repository with a single encrypted file and the identity that decrypts it
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, encryptForTest(t, identity, secret, false))
+		fs.AddFile(identityPath, "# created: today\n"+identity.String()+"\n")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		service.SetIdentityPath(identityPath)
+		other, _ := age.GenerateX25519Identity()
+		fs.AddFile(identityPath, other.String())
+
+		err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{})
+		if err == nil || !strings.Contains(err.Error(), source) {
+			t.Fatalf("Expected a decryption error naming the file, got %v", err)
+		}
+		if fs.FileExists(target) {
+			t.Error("Target was written despite the decryption error")
+		}
+	})
+
+	t.Run("Unlink removes the unchanged decrypted file", func(t *testing.T) {
+		// Repository with a single encrypted file and the identity that decrypts it
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, encryptForTest(t, identity, secret, false))
+		fs.AddFile(identityPath, "# created: today\n"+identity.String()+"\n")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		service.SetIdentityPath(identityPath)
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		result, err := service.UnlinkDotfiles(repoRoot, userHome, ignoreFileName, false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.FileExists(target) || len(result.Removed) != 1 {
+			t.Errorf("Decrypted file was not removed: %+v", result)
+		}
+	})
+
+	t.Run("Restore replaces the unchanged decrypted file with the original", func(t *testing.T) {
+		// Repository with a single encrypted file and the identity that decrypts it
+		backupDir := "/state/dotfileslinker/backups"
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, encryptForTest(t, identity, secret, false))
+		fs.AddFile(identityPath, "# created: today\n"+identity.String()+"\n")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		service.SetIdentityPath(identityPath)
+		fs.AddFile(target, "machine old.example.com\n")
+
+		opts := LinkOptions{Conflict: ConflictBackup, BackupDir: backupDir, RunID: "run1"}
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, opts); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.Files[target] != secret {
+			t.Fatalf("File was not decrypted over the backed up file: %q", fs.Files[target])
+		}
+
+		result, err := service.Restore(repoRoot, backupDir, "run1", false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(result.Restored) != 1 || fs.Files[target] != "machine old.example.com\n" {
+			t.Errorf("Original file was not restored over the decrypted file: %+v, %q", result, fs.Files[target])
+		}
+	})
+}
+
+func TestFileLinkerService_Encrypt(t *testing.T) {
+	repoRoot := "/repo"
+	userHome := "/home/user"
+	ignoreFileName := ".ignore"
+	identityPath := "/config/dotfileslinker/identity.txt"
+	path := filepath.Join(userHome, ".config", "gh", "hosts.yml")
+	repoPath := filepath.Join(repoRoot, "HOME", ".config", "gh", "hosts.yml.age")
+	secret := "github.com:\n  oauth_token: secret\n"
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("Failed to generate identity: %v", err)
+	}
+
+	t.Run("File is encrypted into the repository and stays managed", func(t *testing.T) {
+		// Plaintext file in the home directory and an identity to encrypt it to
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+		fs.AddFile(path, secret)
+		fs.AddFile(identityPath, identity.String())
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath("/state/dotfileslinker/manifest.json")
+		service.SetIdentityPath(identityPath)
+
+		result, err := service.Encrypt(repoRoot, userHome, path, false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result != repoPath {
+			t.Errorf("Expected %s, got %s", repoPath, result)
+		}
+		if strings.Contains(fs.Files[repoPath], "oauth_token") {
+			t.Error("Plaintext was written to the repository")
+		}
+		if fs.Files[path] != secret || fs.Modes[path] != encryptedMode {
+			t.Errorf("Plaintext was not kept private in place: %q %04o", fs.Files[path], fs.Modes[path])
+		}
+
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, []string{repoPath})
+		plan, err := service.Plan(repoRoot, userHome, ignoreFileName, LinkOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		last := plan.Actions[len(plan.Actions)-1]
+		if last.Kind != ActionSkip || last.Target != path {
+			t.Errorf("Expected the encrypted file to decrypt to the original, got %+v", last)
+		}
+		manifest, _ := service.LoadManifest()
+		if record := manifest.Repository(repoRoot).Link(path); record == nil || record.Kind != LinkKindEncrypted {
+			t.Errorf("Encrypted file was not recorded: %+v", record)
+		}
+	})
+
+	t.Run("Dry run writes nothing", func(t *testing.T) {
+		// Plaintext file in the home directory and an identity to encrypt it to
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+		fs.AddFile(path, secret)
+		fs.AddFile(identityPath, identity.String())
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath("/state/dotfileslinker/manifest.json")
+		service.SetIdentityPath(identityPath)
+
+		if _, err := service.Encrypt(repoRoot, userHome, path, true); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.FileExists(repoPath) || len(fs.Modes) != 0 {
+			t.Error("Dry run changed the file system")
+		}
+	})
+
+	t.Run("File already in the repository is an error", func(t *testing.T) {
+		// Plaintext file in the home directory and an identity to encrypt it to
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+		fs.AddFile(path, secret)
+		fs.AddFile(identityPath, identity.String())
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath("/state/dotfileslinker/manifest.json")
+		service.SetIdentityPath(identityPath)
+		fs.AddFile(strings.TrimSuffix(repoPath, encryptedSuffix), "plain")
+
+		if _, err := service.Encrypt(repoRoot, userHome, path, false); err == nil || !strings.Contains(err.Error(), "already exists") {
+			t.Fatalf("Expected an error, got %v", err)
+		}
+		if fs.FileExists(repoPath) {
+			t.Error("Encrypted file was written")
+		}
+	})
+
+	t.Run("Failed restriction removes the encrypted file", func(t *testing.T) {
+		// Plaintext file in the home directory and an identity to encrypt it to
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+		fs.AddFile(path, secret)
+		fs.AddFile(identityPath, identity.String())
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath("/state/dotfileslinker/manifest.json")
+		service.SetIdentityPath(identityPath)
+		fs.SetErrorForOperation("SetMode:"+path, errTest)
+
+		if _, err := service.Encrypt(repoRoot, userHome, path, false); err == nil {
+			t.Fatal("Expected error")
+		}
+		if fs.FileExists(repoPath) {
+			t.Error("Encrypted file was left in the repository")
+		}
+	})
+}
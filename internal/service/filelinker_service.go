@@ -2,18 +2,83 @@ package service
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
-	"runtime"
 	"strings"
+	"time"
 
 	"github.com/guitarrapc/dotfileslinker-go/internal/infrastructure"
-	"github.com/guitarrapc/dotfileslinker-go/internal/util"
 )
 
 // FileLinkerService provides functionality to link dotfiles from a repository to user's home directory or system root.
 type FileLinkerService struct {
-	fs     infrastructure.FileSystem
-	logger Logger
+	fs           infrastructure.FileSystem
+	logger       Logger
+	now          func() time.Time
+	host         func() HostInfo // Describes the machine templates are rendered on
+	environ      func() []string // Environment variables passed to templates, as "NAME=value"
+	manifestPath string          // Where created links are recorded; empty disables the manifest
+	identityPath string          // age identity file used for encrypted sources
+	profile      string          // Profile layered over HOME and ROOT; empty selects none
+}
+
+// ConflictStrategy determines what happens when a target already exists and is not the expected link.
+type ConflictStrategy int
+
+const (
+	// ConflictFail aborts linking with an error.
+	ConflictFail ConflictStrategy = iota
+	// ConflictOverwrite deletes the existing target.
+	ConflictOverwrite
+	// ConflictBackup moves the existing target into a backup directory that can be restored later.
+	ConflictBackup
+)
+
+// LinkMode determines how a source is deployed to its target.
+type LinkMode int
+
+const (
+	// ModeSymlink creates a symbolic link to the source.
+	ModeSymlink LinkMode = iota
+	// ModeCopy copies the source and records its hash to detect later changes.
+	ModeCopy
+	// ModeHardlink creates a hard link to the source; the source and target must be on the same file system.
+	ModeHardlink
+)
+
+// String returns the name of the mode as accepted by ParseLinkMode.
+func (m LinkMode) String() string {
+	switch m {
+	case ModeSymlink:
+		return "symlink"
+	case ModeCopy:
+		return "copy"
+	case ModeHardlink:
+		return "hardlink"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseLinkMode converts a mode name such as "copy" to a LinkMode.
+func ParseLinkMode(name string) (LinkMode, error) {
+	for _, mode := range []LinkMode{ModeSymlink, ModeCopy, ModeHardlink} {
+		if strings.EqualFold(name, mode.String()) {
+			return mode, nil
+		}
+	}
+	return ModeSymlink, fmt.Errorf("unknown mode %q, expected symlink, copy or hardlink", name)
+}
+
+// LinkOptions controls how LinkDotfilesWithOptions creates links.
+type LinkOptions struct {
+	Conflict  ConflictStrategy // How to handle existing targets
+	Mode      LinkMode         // How sources are deployed
+	Relative  bool             // Whether symbolic links point to their source by a path relative to the link's directory
+	Fold      bool             // Whether HOME and ROOT directories whose target does not exist are linked as a whole
+	BackupDir string           // Root directory of backups; each run is stored in a subdirectory named after RunID
+	RunID     string           // Identifier of the run; a timestamp is used when empty
+	DryRun    bool             // Only show what would be done
 }
 
 // defaultIgnorePatterns contains default patterns to ignore in all directories, common for all platforms
@@ -45,8 +110,11 @@ func NewFileLinkerService(fs infrastructure.FileSystem, logger Logger) *FileLink
 		logger = NewNullLogger()
 	}
 	return &FileLinkerService{
-		fs:     fs,
-		logger: logger,
+		fs:      fs,
+		logger:  logger,
+		now:     time.Now,
+		host:    currentHostInfo,
+		environ: os.Environ,
 	}
 }
 
@@ -57,46 +125,120 @@ func NewFileLinkerService(fs infrastructure.FileSystem, logger Logger) *FileLink
 // overwrite: Whether to overwrite existing files or directories.
 // dryRun: If true, only shows what would be done without actually creating links.
 func (s *FileLinkerService) LinkDotfiles(repoRoot string, userHome string, ignoreFileName string, overwrite bool, dryRun bool) error {
-	if dryRun {
-		s.logger.Info("DRY RUN MODE: No files will be actually linked")
+	opts := LinkOptions{DryRun: dryRun}
+	if overwrite {
+		opts.Conflict = ConflictOverwrite
 	}
+	return s.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, opts)
+}
 
-	s.logger.Info(fmt.Sprintf("Starting to link dotfiles from %s to %s", repoRoot, userHome))
-	s.logger.Info(fmt.Sprintf("Using ignore file: %s", ignoreFileName))
+// LinkDotfilesWithOptions links dotfiles like LinkDotfiles, with full control over conflict handling.
+// repoRoot: The root directory of the dotfiles repository.
+// userHome: The user's home directory path.
+// ignoreFileName: The name of the ignore file containing patterns to exclude.
+// opts: Options controlling conflict handling and dry-run mode.
+func (s *FileLinkerService) LinkDotfilesWithOptions(repoRoot string, userHome string, ignoreFileName string, opts LinkOptions) error {
+	if opts.RunID == "" {
+		opts.RunID = s.newRunID()
+	}
 
-	// Filter files in the root of the repository
-	ignorePath := filepath.Join(repoRoot, ignoreFileName)
-	userIgnore := s.loadIgnoreList(ignorePath)
-	s.logger.Verbose(fmt.Sprintf("Loaded %d user-defined ignore patterns from %s", len(userIgnore), ignorePath))
-	s.logger.Verbose(fmt.Sprintf("Using %d default ignore patterns", len(defaultIgnorePatterns)))
+	dryRun := opts.DryRun
+	if dryRun {
+		s.logger.Info("DRY RUN MODE: No files will be actually linked")
+	}
 
-	// Process each directory
-	if err := s.processRepositoryRoot(repoRoot, userHome, userIgnore, overwrite, dryRun); err != nil {
+	plan, err := s.Plan(repoRoot, userHome, ignoreFileName, opts)
+	if err != nil {
 		return err
 	}
 
-	if err := s.processHomeDirectory(repoRoot, userHome, userIgnore, overwrite, dryRun); err != nil {
-		return err
+	if dryRun {
+		s.PrintPlan(plan)
+		s.logger.Info("DRY RUN COMPLETED: No files were actually linked")
+		return nil
 	}
 
-	if err := s.processRootDirectory(repoRoot, userIgnore, overwrite, dryRun); err != nil {
+	if err := s.Apply(plan); err != nil {
 		return err
 	}
+	if err := s.recordPlan(plan); err != nil {
+		return fmt.Errorf("links were created but the manifest could not be updated: %w", err)
+	}
 
-	if dryRun {
-		s.logger.Info("DRY RUN COMPLETED: No files were actually linked")
-	} else {
-		s.logger.Info("Dotfiles linking completed")
+	if opts.Conflict == ConflictBackup {
+		s.reportBackups(opts)
 	}
+	s.logger.Info("Dotfiles linking completed")
 
 	return nil
 }
 
-// processRepositoryRoot processes and links files in the repository root.
-func (s *FileLinkerService) processRepositoryRoot(repoRoot string, userHome string, userIgnore map[string]bool, overwrite bool, dryRun bool) error {
+// linkEntry describes a file in the repository and the target path it is linked to.
+type linkEntry struct {
+	source    string
+	target    string
+	ignored   bool   // Whether the source matched an ignore pattern
+	root      string // Directory a HOME or ROOT entry was collected into; directories below it may be folded
+	layer     string // Repository directory the source was collected from, such as "HOME.linux"; empty for the repository root
+	overlay   bool   // Whether the layer overrides the entries of base directories and earlier overlays for the same target
+	profile   string // Profile whose directory the source was collected from, or empty
+	alternate bool   // Whether the source is named with conditions such as "##os.linux" that select it for this machine
+	unfolded  bool   // Whether the target is below a folded directory that is replaced by a real one
+	template  bool   // Whether the source is a template that is rendered to the target
+	encrypted bool   // Whether the source is encrypted with age and decrypted to the target
+	injected  bool   // Whether the target is a regular file that keeps the source in a managed block
+	include   string // Format of the include directive that references the source from the target, or empty to link it
+	rendered  string // Rendered content of a template or decrypted content of an encrypted source, once generated
+}
+
+// collectAll collects the entries of the repository root and the mapped directories with their overlays in processing order.
+// Alternates are resolved to the one that matches this machine, encrypted sources and templates target their path
+// without the suffix, and overlay files replace the entries of the same target; two remaining entries for one target
+// are an error. Entries whose target matches the inject or include file are then marked injected or included.
+// Entries matching ignore patterns are included with ignored set.
+func (s *FileLinkerService) collectAll(repoRoot string, userHome string, userIgnore map[string]bool) ([]linkEntry, error) {
+	rootEntries, err := s.collectRepositoryRoot(repoRoot, userHome, userIgnore)
+	if err != nil {
+		return nil, err
+	}
+
+	mappedEntries, err := s.collectMappings(repoRoot, userHome, userIgnore)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := append(rootEntries, mappedEntries...)
+	if err := s.resolveAlternates(repoRoot, entries); err != nil {
+		return nil, err
+	}
+	s.markEncrypted(entries)
+	s.markTemplates(entries)
+	entries = s.mergeOverlays(entries)
+	if err := checkDuplicateTargets(entries, s.host().OS); err != nil {
+		return nil, err
+	}
+
+	patterns, err := s.loadInjectPatterns(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	s.markInjected(entries, patterns, userHome)
+
+	includes, err := s.loadIncludeRules(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.markIncluded(entries, includes, userHome); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// collectRepositoryRoot collects dotfiles in the repository root, which are linked directly to the user's home directory.
+func (s *FileLinkerService) collectRepositoryRoot(repoRoot string, userHome string, userIgnore map[string]bool) ([]linkEntry, error) {
 	files, err := s.fs.EnumerateFiles(repoRoot, ".*", false)
 	if err != nil {
-		return fmt.Errorf("failed to enumerate files in repository root: %w", err)
+		return nil, fmt.Errorf("failed to enumerate files in repository root: %w", err)
 	}
 	var validFiles []string
 	var ignoredFiles []string
@@ -126,44 +268,29 @@ func (s *FileLinkerService) processRepositoryRoot(repoRoot string, userHome stri
 
 	s.logger.Info(fmt.Sprintf("Found %d files to link from repository root directory to %s", len(validFiles), userHome))
 
+	entries := make([]linkEntry, 0, len(files))
 	for _, src := range validFiles {
-		dst := filepath.Join(userHome, filepath.Base(src))
-		s.logger.Verbose(fmt.Sprintf("Linking %s to %s", src, dst))
-		if err := s.linkFile(src, dst, overwrite, dryRun); err != nil {
-			return err
-		}
+		entries = append(entries, linkEntry{source: src, target: filepath.Join(userHome, filepath.Base(src))})
 	}
-
-	return nil
-}
-
-// processHomeDirectory processes and links files in the HOME directory.
-func (s *FileLinkerService) processHomeDirectory(repoRoot string, userHome string, userIgnore map[string]bool, overwrite bool, dryRun bool) error {
-	return s.processDirectory(repoRoot, "HOME", userHome, userIgnore, overwrite, dryRun)
-}
-
-// processRootDirectory processes and links files in the ROOT directory (Linux/macOS only).
-func (s *FileLinkerService) processRootDirectory(repoRoot string, userIgnore map[string]bool, overwrite bool, dryRun bool) error {
-	// Goの場合、ランタイムでOSを確認するのがより明確
-	if runtime.GOOS == "windows" {
-		s.logger.Info("Skipping ROOT directory processing on non-Unix platforms")
-		return nil
+	for _, src := range ignoredFiles {
+		entries = append(entries, linkEntry{source: src, target: filepath.Join(userHome, filepath.Base(src)), ignored: true})
 	}
-	return s.processDirectory(repoRoot, "ROOT", "/", userIgnore, overwrite, dryRun)
+	return entries, nil
 }
 
-// processDirectory processes and links files in the specified directory.
-func (s *FileLinkerService) processDirectory(repoRoot string, srcDir string, destDir string, userIgnore map[string]bool, overwrite bool, dryRun bool) error {
+// collectDirectory collects files in the specified directory and maps them to the same relative path under destDir.
+// Unless recursive is set, only the files directly in the directory are collected.
+func (s *FileLinkerService) collectDirectory(repoRoot string, srcDir string, destDir string, recursive bool, userIgnore map[string]bool) ([]linkEntry, error) {
 	srcPath := filepath.Join(repoRoot, srcDir)
 	if !s.fs.DirectoryExists(srcPath) {
 		s.logger.Info(fmt.Sprintf("%s directory not found: %s", srcDir, srcPath))
-		return nil
+		return nil, nil
 	}
 
 	s.logger.Info(fmt.Sprintf("Processing %s directory: %s", srcDir, srcPath))
-	allFiles, err := s.fs.EnumerateFiles(srcPath, "*", true)
+	allFiles, err := s.fs.EnumerateFiles(srcPath, "*", recursive)
 	if err != nil {
-		return fmt.Errorf("failed to enumerate files in %s: %w", srcDir, err)
+		return nil, fmt.Errorf("failed to enumerate files in %s: %w", srcDir, err)
 	}
 
 	// Filter files based on ignore patterns
@@ -195,92 +322,37 @@ func (s *FileLinkerService) processDirectory(repoRoot string, srcDir string, des
 
 	s.logger.Info(fmt.Sprintf("Found %d files to link from %s directory to %s", len(files), srcDir, destDir))
 
+	entries := make([]linkEntry, 0, len(allFiles))
 	for _, file := range files {
-		rel, err := filepath.Rel(srcPath, file)
+		entry, err := newDirectoryEntry(srcPath, destDir, file, false)
 		if err != nil {
-			return fmt.Errorf("failed to get relative path: %w", err)
-		}
-		dst := filepath.Join(destDir, rel)
-
-		dstDir := filepath.Dir(dst)
-		s.logger.Verbose(fmt.Sprintf("Ensuring directory exists: %s", dstDir))
-
-		// Only actually create the directory if not in dry-run mode
-		if !dryRun {
-			if err := s.fs.EnsureDirectory(dstDir); err != nil {
-				return fmt.Errorf("failed to create directory: %w", err)
-			}
-		}
-
-		s.logger.Verbose(fmt.Sprintf("Linking %s to %s", file, dst))
-		if err := s.linkFile(file, dst, overwrite, dryRun); err != nil {
-			return err
+			return nil, err
 		}
+		entries = append(entries, entry)
 	}
-
-	return nil
-}
-
-// linkFile creates a symbolic link from the source to the target path.
-func (s *FileLinkerService) linkFile(source string, target string, overwrite bool, dryRun bool) error {
-	fileExists := s.fs.FileExists(target)
-	dirExists := s.fs.DirectoryExists(target)
-	exists := fileExists || dirExists
-
-	if exists {
-		currentLinkTarget := s.fs.GetLinkTarget(target)
-
-		// If the target is a symlink and points to the same file, do nothing
-		if currentLinkTarget != "" && util.PathEquals(currentLinkTarget, source) {
-			if dryRun {
-				s.logger.Success(fmt.Sprintf("[DRY-RUN] Would skip already linked: %s -> %s", target, source))
-			} else {
-				s.logger.Success(fmt.Sprintf("Skipping already linked: %s -> %s", target, source))
-			}
-			return nil
-		}
-
-		if !overwrite {
-			s.logger.Verbose(fmt.Sprintf("Target %s exists and overwrite=false, aborting", target))
-			return fmt.Errorf("'%s' already exists; use --force=y to overwrite", target)
-		}
-
-		if dryRun {
-			s.logger.Verbose(fmt.Sprintf("[DRY-RUN] Would delete existing target: %s", target))
-		} else {
-			s.logger.Verbose(fmt.Sprintf("Deleting existing target: %s", target))
-			if err := s.fs.Delete(target); err != nil {
-				return fmt.Errorf("failed to delete existing target: %w", err)
-			}
-		}
-	}
-
-	// Create the link (or just log what would happen in dry-run mode)
-	var err error
-	if s.fs.DirectoryExists(source) {
-		if dryRun {
-			s.logger.Success(fmt.Sprintf("[DRY-RUN] Would create directory symlink: %s -> %s", target, source))
-			return nil
-		} else {
-			s.logger.Success(fmt.Sprintf("Creating directory symlink: %s -> %s", target, source))
-			err = s.fs.CreateDirectorySymlink(target, source)
-		}
-	} else {
-		if dryRun {
-			s.logger.Success(fmt.Sprintf("[DRY-RUN] Would create file symlink: %s -> %s", target, source))
-			return nil
-		} else {
-			s.logger.Success(fmt.Sprintf("Creating file symlink: %s -> %s", target, source))
-			err = s.fs.CreateFileSymlink(target, source)
+	for _, file := range ignoredFiles {
+		entry, err := newDirectoryEntry(srcPath, destDir, file, true)
+		if err != nil {
+			return nil, err
 		}
+		entries = append(entries, entry)
 	}
+	return entries, nil
+}
 
+// newDirectoryEntry maps a file below srcPath to the same relative path below destDir.
+func newDirectoryEntry(srcPath string, destDir string, file string, ignored bool) (linkEntry, error) {
+	rel, err := filepath.Rel(srcPath, file)
 	if err != nil {
-		s.logger.Error(fmt.Sprintf("Failed to create symlink from %s to %s: %s", source, target, err))
-		return err
+		return linkEntry{}, fmt.Errorf("failed to get relative path: %w", err)
 	}
+	return linkEntry{source: file, target: filepath.Join(destDir, rel), ignored: ignored, root: filepath.Clean(destDir)}, nil
+}
 
-	return nil
+// newRunID creates an identifier for a run based on the current time, such as "20250421-103000.123456".
+// Microseconds keep two runs started within the same second from sharing a backup directory.
+func (s *FileLinkerService) newRunID() string {
+	return s.now().Format("20060102-150405.000000")
 }
 
 // shouldIgnoreFileEnhanced determines whether a file should be ignored based on patterns.
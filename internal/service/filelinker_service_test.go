@@ -1,6 +1,7 @@
 package service
 
 import (
+	"errors"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -8,6 +9,9 @@ import (
 	"github.com/guitarrapc/dotfileslinker-go/internal/infrastructure"
 )
 
+// errTest is a generic error injected into the mock file system
+var errTest = errors.New("test error")
+
 // Mock logger for testing
 type MockLogger struct {
 	SuccessLogs []string
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/guitarrapc/dotfileslinker-go/internal/util"
+)
+
+// foldPolicy determines which directories foldEntries links as a whole.
+type foldPolicy int
+
+const (
+	// foldExisting keeps directories that are already linked as a whole.
+	foldExisting foldPolicy = iota
+	// foldNew also links directories whose target does not exist yet as a whole.
+	foldNew
+	// foldNone links nothing as a whole and unfolds directories that are.
+	foldNone
+)
+
+// foldPolicyFor returns the fold policy for a run with the given options.
+// Only symbolic links can fold; copies and hard links are always made per file.
+func foldPolicyFor(opts LinkOptions) foldPolicy {
+	switch {
+	case opts.Mode != ModeSymlink:
+		return foldNone
+	case opts.Fold:
+		return foldNew
+	default:
+		return foldExisting
+	}
+}
+
+// foldCandidate is a target directory that may be linked as a whole to a directory in the repository.
+type foldCandidate struct {
+	source   string // Directory in the repository the target would link to
+	target   string // Directory below the root of its entries
+	root     string // Directory the entries below the target were collected into
+	shared   bool   // Whether other sources also link into the target, or link to the target itself
+	exposing bool   // Whether linking the target would expose files that are not linked, such as ignored or template files
+}
+
+// foldEntries applies GNU Stow style folding to the entries collected from HOME and ROOT.
+// A directory below the root of its entries is linked as a whole when every entry below it comes
+// from the same directory in the repository, all of them are linked under their own name rather than
+// ignored, alternates, generated, injected or included, and its target is already a symbolic link to
+// that directory or, with foldNew, does not exist yet. Folding happens at the outermost possible level,
+// and the entries below a folded directory are replaced by a single entry.
+//
+// Directories that are linked as a whole but can no longer be are returned as unfold actions,
+// outermost first. The entries below them, including directories folded below them, are marked unfolded,
+// since their targets only appear to exist through the link that the unfold action replaces with a real directory.
+func (s *FileLinkerService) foldEntries(entries []linkEntry, policy foldPolicy) ([]linkEntry, []Action) {
+	candidates := make(map[string]*foldCandidate)
+	var order []string
+	for _, entry := range entries {
+		if entry.root == "" {
+			continue
+		}
+		source, target := filepath.Dir(entry.source), filepath.Dir(entry.target)
+		for util.IsSubPath(target, entry.root) && !util.PathEquals(target, entry.root) {
+			candidate, exists := candidates[target]
+			if !exists {
+				candidate = &foldCandidate{source: source, target: target, root: entry.root}
+				candidates[target] = candidate
+				order = append(order, target)
+			} else if !util.PathEquals(candidate.source, source) {
+				candidate.shared = true
+			}
+			if entry.ignored || entry.alternate || entry.template || entry.encrypted || entry.injected || entry.include != "" {
+				candidate.exposing = true
+			}
+			source, target = filepath.Dir(source), filepath.Dir(target)
+		}
+	}
+
+	// Entries from outside HOME and ROOT cannot be part of a folded directory
+	for _, entry := range entries {
+		if candidate, exists := candidates[entry.target]; exists {
+			candidate.shared = true
+		}
+		if entry.root != "" {
+			continue
+		}
+		for dir := filepath.Dir(entry.target); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+			if candidate, exists := candidates[dir]; exists {
+				candidate.shared = true
+			}
+		}
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return strings.Count(order[i], string(filepath.Separator)) < strings.Count(order[j], string(filepath.Separator))
+	})
+
+	folded := make(map[string]bool)
+	unfolded := make(map[string]bool)
+	var unfold []Action
+	for _, target := range order {
+		if ancestorIn(target, folded) != "" {
+			continue
+		}
+		candidate := candidates[target]
+
+		// Below an unfolded directory, paths only appear to exist through the link being replaced
+		absent, linked := true, false
+		if ancestorIn(target, unfolded) == "" {
+			linkTarget := s.fs.GetLinkTarget(target)
+			absent = linkTarget == "" && !s.fs.FileExists(target) && !s.fs.DirectoryExists(target)
+			linked = linkTarget != "" && util.PathEquals(util.ResolveLinkTarget(target, linkTarget), candidate.source)
+		}
+
+		reason := ""
+		switch {
+		case policy == foldNone:
+			reason = "links are created per file in this mode"
+		case candidate.shared:
+			reason = "other sources link into the directory"
+		case candidate.exposing:
+			reason = "the directory contains files that are not linked"
+		}
+
+		switch {
+		case reason == "" && (linked || (policy == foldNew && absent)):
+			folded[target] = true
+		case linked:
+			s.logger.Verbose(fmt.Sprintf("Unfolding %s: %s", target, reason))
+			unfolded[target] = true
+			unfold = append(unfold, Action{Kind: ActionUnfold, Source: candidate.source, Target: target, IsDir: true, Reason: reason})
+		}
+	}
+
+	result := make([]linkEntry, 0, len(entries))
+	for _, entry := range entries {
+		if dir := ancestorIn(entry.target, folded); dir != "" {
+			if folded[dir] {
+				folded[dir] = false
+				candidate := candidates[dir]
+				result = append(result, linkEntry{
+					source:   candidate.source,
+					target:   dir,
+					root:     candidate.root,
+					layer:    entry.layer,
+					overlay:  entry.overlay,
+					profile:  entry.profile,
+					unfolded: ancestorIn(dir, unfolded) != "",
+				})
+			}
+			continue
+		}
+		entry.unfolded = ancestorIn(entry.target, unfolded) != ""
+		result = append(result, entry)
+	}
+	return result, unfold
+}
+
+// ancestorIn returns the nearest directory above path that is a key of dirs, or an empty string.
+// Only the presence of a key matters, not its value.
+func ancestorIn(path string, dirs map[string]bool) string {
+	for dir := filepath.Dir(path); dir != path; path, dir = dir, filepath.Dir(dir) {
+		if _, exists := dirs[dir]; exists {
+			return dir
+		}
+	}
+	return ""
+}
@@ -0,0 +1,382 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/guitarrapc/dotfileslinker-go/internal/infrastructure"
+)
+
+func TestFileLinkerService_Fold(t *testing.T) {
+	repoRoot := "/repo"
+	userHome := "/home/user"
+	ignoreFileName := ".ignore"
+	manifestPath := "/state/dotfileslinker/manifest.json"
+	nvimSource := filepath.Join(repoRoot, "HOME", ".config", "nvim")
+	nvimTarget := filepath.Join(userHome, ".config", "nvim")
+	files := []string{
+		filepath.Join(nvimSource, "init.vim"),
+		filepath.Join(nvimSource, "lua", "plugins.lua"),
+	}
+
+	t.Run("Missing directory is linked as a whole", func(t *testing.T) {
+		// Repository with a neovim configuration tree and an existing ~/.config
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(filepath.Join(userHome, ".config"))
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+		for _, file := range files {
+			fs.AddFile(file, "-- "+filepath.Base(file))
+		}
+		fs.AddDirectory(nvimSource)
+		fs.AddDirectory(filepath.Join(nvimSource, "lua"))
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, files)
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{Fold: true}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if fs.GetLinkTarget(nvimTarget) != nvimSource {
+			t.Errorf("Expected %s to link to %s, got %q", nvimTarget, nvimSource, fs.GetLinkTarget(nvimTarget))
+		}
+		if len(fs.SymLinks) != 1 {
+			t.Errorf("Expected a single link, got %v", fs.SymLinks)
+		}
+
+		manifest, _ := service.LoadManifest()
+		if record := manifest.Repository(repoRoot).Link(nvimTarget); record == nil || record.Kind != LinkKindDirectorySymlink {
+			t.Errorf("Folded directory was not recorded: %+v", record)
+		}
+	})
+
+	t.Run("Without fold every file is linked", func(t *testing.T) {
+		// Repository with a neovim configuration tree and an existing ~/.config
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(filepath.Join(userHome, ".config"))
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+		for _, file := range files {
+			fs.AddFile(file, "-- "+filepath.Base(file))
+		}
+		fs.AddDirectory(nvimSource)
+		fs.AddDirectory(filepath.Join(nvimSource, "lua"))
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, files)
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(fs.SymLinks) != len(files) || fs.GetLinkTarget(nvimTarget) != "" {
+			t.Errorf("Expected per-file links, got %v", fs.SymLinks)
+		}
+	})
+
+	t.Run("Existing directory gets per-file links", func(t *testing.T) {
+		// Repository with a neovim configuration tree and an existing ~/.config
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(filepath.Join(userHome, ".config"))
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+		for _, file := range files {
+			fs.AddFile(file, "-- "+filepath.Base(file))
+		}
+		fs.AddDirectory(nvimSource)
+		fs.AddDirectory(filepath.Join(nvimSource, "lua"))
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, files)
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		fs.AddDirectory(nvimTarget)
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{Fold: true}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		// The lua directory does not exist yet, so it is folded below the existing directory
+		expected := map[string]string{
+			filepath.Join(nvimTarget, "init.vim"): filepath.Join(nvimSource, "init.vim"),
+			filepath.Join(nvimTarget, "lua"):      filepath.Join(nvimSource, "lua"),
+		}
+		for target, source := range expected {
+			if fs.GetLinkTarget(target) != source {
+				t.Errorf("Expected %s to link to %s, got %q", target, source, fs.GetLinkTarget(target))
+			}
+		}
+		if len(fs.SymLinks) != len(expected) {
+			t.Errorf("Unexpected links: %v", fs.SymLinks)
+		}
+	})
+
+	t.Run("Folded directory is kept without fold", func(t *testing.T) {
+		// Repository with a neovim configuration tree and an existing ~/.config
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(filepath.Join(userHome, ".config"))
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+		for _, file := range files {
+			fs.AddFile(file, "-- "+filepath.Base(file))
+		}
+		fs.AddDirectory(nvimSource)
+		fs.AddDirectory(filepath.Join(nvimSource, "lua"))
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, files)
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		fs.SymLinks[nvimTarget] = nvimSource
+
+		plan, err := service.Plan(repoRoot, userHome, ignoreFileName, LinkOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(plan.Actions) != 1 || plan.Actions[0].Kind != ActionSkip || plan.Actions[0].Target != nvimTarget {
+			t.Errorf("Expected the folded directory to be skipped, got %+v", plan.Actions)
+		}
+
+		statuses, err := service.Status(repoRoot, userHome, ignoreFileName)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(statuses) != 1 || statuses[0].State != LinkStateLinked {
+			t.Errorf("Expected the folded directory to be linked, got %+v", statuses)
+		}
+	})
+
+	t.Run("Folded directory with ignored files is unfolded", func(t *testing.T) {
+		// Repository with a neovim configuration tree and an existing ~/.config
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(filepath.Join(userHome, ".config"))
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+		for _, file := range files {
+			fs.AddFile(file, "-- "+filepath.Base(file))
+		}
+		fs.AddDirectory(nvimSource)
+		fs.AddDirectory(filepath.Join(nvimSource, "lua"))
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, files)
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		fs.SymLinks[nvimTarget] = nvimSource
+		fs.AddFile(filepath.Join(repoRoot, ignoreFileName), "*.log")
+		withLog := append([]string{filepath.Join(nvimSource, "debug.log")}, files...)
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, withLog)
+
+		plan, err := service.Plan(repoRoot, userHome, ignoreFileName, LinkOptions{Fold: true})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if plan.Actions[0].Kind != ActionUnfold || plan.Actions[0].Target != nvimTarget {
+			t.Fatalf("Expected the directory to be unfolded first, got %+v", plan.Actions[0])
+		}
+
+		if err := service.Apply(plan); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.GetLinkTarget(nvimTarget) != "" || !fs.DirectoryExists(nvimTarget) {
+			t.Error("Folded directory was not replaced by a real directory")
+		}
+		if fs.GetLinkTarget(filepath.Join(nvimTarget, "init.vim")) != filepath.Join(nvimSource, "init.vim") {
+			t.Error("File in the unfolded directory was not linked")
+		}
+		if fs.GetLinkTarget(filepath.Join(nvimTarget, "debug.log")) != "" {
+			t.Error("Ignored file was linked")
+		}
+	})
+
+	t.Run("Subdirectory below an unfolded directory is folded as a new link", func(t *testing.T) {
+		// Repository with a neovim configuration tree whose whole ~/.config is folded
+		configTarget := filepath.Join(userHome, ".config")
+		configSource := filepath.Join(repoRoot, "HOME", ".config")
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+		for _, file := range files {
+			fs.AddFile(file, "-- "+filepath.Base(file))
+		}
+		fs.AddDirectory(configSource)
+		fs.AddDirectory(nvimSource)
+		fs.AddDirectory(filepath.Join(nvimSource, "lua"))
+		fs.AddFile(filepath.Join(repoRoot, ignoreFileName), "*.tmp")
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, append([]string{filepath.Join(nvimSource, "foo.tmp")}, files...))
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		fs.SymLinks[configTarget] = configSource
+		// Through the folded ~/.config, the neovim directories appear to exist
+		fs.AddDirectory(nvimTarget)
+		fs.AddDirectory(filepath.Join(nvimTarget, "lua"))
+
+		plan, err := service.Plan(repoRoot, userHome, ignoreFileName, LinkOptions{Fold: true})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if plan.Actions[0].Kind != ActionUnfold || plan.Actions[0].Target != configTarget {
+			t.Fatalf("Expected ~/.config to be unfolded first, got %+v", plan.Actions[0])
+		}
+		var lua *Action
+		for i := range plan.Actions {
+			if plan.Actions[i].Target == filepath.Join(nvimTarget, "lua") {
+				lua = &plan.Actions[i]
+			}
+		}
+		if lua == nil || lua.Kind != ActionLink || lua.Source != filepath.Join(nvimSource, "lua") || !lua.IsDir {
+			t.Errorf("Expected the lua directory to be linked as a whole, got %+v", lua)
+		}
+		if plan.Count(ActionReplace) != 0 {
+			t.Errorf("Paths below the unfolded directory were treated as existing: %+v", plan.Actions)
+		}
+	})
+
+	t.Run("Copy mode unfolds folded directories", func(t *testing.T) {
+		// Repository with a neovim configuration tree and an existing ~/.config
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(filepath.Join(userHome, ".config"))
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+		for _, file := range files {
+			fs.AddFile(file, "-- "+filepath.Base(file))
+		}
+		fs.AddDirectory(nvimSource)
+		fs.AddDirectory(filepath.Join(nvimSource, "lua"))
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, files)
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		fs.SymLinks[nvimTarget] = nvimSource
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{Mode: ModeCopy}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.GetLinkTarget(nvimTarget) != "" {
+			t.Error("Folded directory was kept in copy mode")
+		}
+		if fs.Files[filepath.Join(nvimTarget, "lua", "plugins.lua")] != "-- plugins.lua" {
+			t.Error("File in the unfolded directory was not copied")
+		}
+	})
+
+	t.Run("Failed unfold is rolled back", func(t *testing.T) {
+		// Repository with a neovim configuration tree and an existing ~/.config
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(filepath.Join(userHome, ".config"))
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+		for _, file := range files {
+			fs.AddFile(file, "-- "+filepath.Base(file))
+		}
+		fs.AddDirectory(nvimSource)
+		fs.AddDirectory(filepath.Join(nvimSource, "lua"))
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, files)
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		fs.SymLinks[nvimTarget] = nvimSource
+		fs.SetErrorForOperation("CreateFileSymlink:"+filepath.Join(nvimTarget, "init.vim"), errTest)
+		fs.AddFile(filepath.Join(repoRoot, ignoreFileName), "*.log")
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, append([]string{filepath.Join(nvimSource, "debug.log")}, files...))
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{Fold: true}); err == nil {
+			t.Fatal("Expected error")
+		}
+		if fs.GetLinkTarget(nvimTarget) != nvimSource {
+			t.Errorf("Folded directory was not restored, got %q", fs.GetLinkTarget(nvimTarget))
+		}
+	})
+
+	t.Run("Unlink removes the folded directory link", func(t *testing.T) {
+		// Repository with a neovim configuration tree and an existing ~/.config
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(filepath.Join(userHome, ".config"))
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+		for _, file := range files {
+			fs.AddFile(file, "-- "+filepath.Base(file))
+		}
+		fs.AddDirectory(nvimSource)
+		fs.AddDirectory(filepath.Join(nvimSource, "lua"))
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, files)
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{Fold: true}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		result, err := service.UnlinkDotfiles(repoRoot, userHome, ignoreFileName, false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(result.Removed) != 1 || len(fs.SymLinks) != 0 {
+			t.Errorf("Folded directory link was not removed: %+v, %v", result, fs.SymLinks)
+		}
+	})
+}
+
+func TestFileLinkerService_FoldEntries(t *testing.T) {
+	userHome := "/home/user"
+	target := filepath.Join(userHome, ".config", "nvim")
+	base := linkEntry{
+		source: "/repo/HOME/.config/nvim/init.vim",
+		target: filepath.Join(target, "init.vim"),
+		root:   userHome,
+	}
+	// overlay contributes to the same directory from another source, as a platform layer would
+	overlay := linkEntry{
+		source: "/repo/HOME.linux/.config/nvim/lua/linux.lua",
+		target: filepath.Join(target, "lua", "linux.lua"),
+		root:   userHome,
+	}
+
+	t.Run("Directory with several sources is not folded", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(filepath.Join(userHome, ".config"))
+		service := NewFileLinkerService(fs, NewMockLogger())
+
+		entries, unfold := service.foldEntries([]linkEntry{base, overlay}, foldNew)
+
+		// The lua directory only has one source and does not exist, so it is folded on its own
+		if len(unfold) != 0 || len(entries) != 2 {
+			t.Fatalf("Unexpected result: %+v, %+v", entries, unfold)
+		}
+		if entries[0] != base {
+			t.Errorf("Expected %+v, got %+v", base, entries[0])
+		}
+		if entries[1].target != filepath.Join(target, "lua") || entries[1].source != "/repo/HOME.linux/.config/nvim/lua" {
+			t.Errorf("Expected the lua directory to be folded, got %+v", entries[1])
+		}
+	})
+
+	t.Run("Folded directory that gets another source is unfolded", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(filepath.Join(userHome, ".config"))
+		fs.SymLinks[target] = "/repo/HOME/.config/nvim"
+		service := NewFileLinkerService(fs, NewMockLogger())
+
+		entries, unfold := service.foldEntries([]linkEntry{base, overlay}, foldExisting)
+
+		if len(unfold) != 1 || unfold[0].Kind != ActionUnfold || unfold[0].Target != target {
+			t.Fatalf("Expected %s to be unfolded, got %+v", target, unfold)
+		}
+		for _, entry := range entries {
+			if !entry.unfolded {
+				t.Errorf("Entry below the unfolded directory is not marked: %+v", entry)
+			}
+		}
+	})
+
+	t.Run("Entries from the repository root are never folded", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		service := NewFileLinkerService(fs, NewMockLogger())
+		entry := linkEntry{source: "/repo/.bashrc", target: filepath.Join(userHome, ".bashrc")}
+
+		entries, _ := service.foldEntries([]linkEntry{entry}, foldNew)
+		if len(entries) != 1 || entries[0] != entry {
+			t.Errorf("Unexpected entries: %+v", entries)
+		}
+	})
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// planHardlink decides how a single entry is deployed in hard link mode.
+// A target that is already the same file as the source, compared by inode, is left alone.
+func (s *FileLinkerService) planHardlink(action Action, opts LinkOptions) (Action, error) {
+	if action.IsDir {
+		return action, fmt.Errorf("'%s' is a directory; hard links can only be created to files", action.Source)
+	}
+
+	// Hard links cannot cross file systems, so compare the source with the directory the link would be created in
+	dir := s.nearestExistingDirectory(filepath.Dir(action.Target))
+	sameDevice, err := s.fs.SameDevice(action.Source, dir)
+	if err != nil {
+		return action, fmt.Errorf("failed to compare the devices of %s and %s: %w", action.Source, dir, err)
+	}
+	if !sameDevice {
+		return action, fmt.Errorf("'%s' and '%s' are on different file systems and cannot be hard linked; use --mode=copy or --mode=symlink instead", action.Source, action.Target)
+	}
+
+	isRegularFile := s.fs.GetLinkTarget(action.Target) == "" && s.fs.FileExists(action.Target)
+	if !isRegularFile {
+		if s.fs.GetLinkTarget(action.Target) == "" && !s.fs.DirectoryExists(action.Target) {
+			action.Kind = ActionLink
+			action.Reason = "target does not exist"
+			return action, nil
+		}
+		return s.planConflict(action, s.describeExisting(action.Target), opts)
+	}
+
+	same, err := s.fs.SameFile(action.Source, action.Target)
+	if err != nil {
+		return action, fmt.Errorf("failed to compare %s and %s: %w", action.Source, action.Target, err)
+	}
+	if same {
+		action.Kind = ActionSkip
+		action.Reason = "already hard linked"
+		return action, nil
+	}
+	return s.planConflict(action, "file", opts)
+}
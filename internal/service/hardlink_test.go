@@ -0,0 +1,193 @@
+package service
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/guitarrapc/dotfileslinker-go/internal/infrastructure"
+)
+
+func TestFileLinkerService_HardlinkMode(t *testing.T) {
+	repoRoot := "/repo"
+	userHome := "/home/user"
+	ignoreFileName := ".ignore"
+	manifestPath := "/state/dotfileslinker/manifest.json"
+	source := filepath.Join(repoRoot, ".bashrc")
+	target := filepath.Join(userHome, ".bashrc")
+
+	t.Run("Creates a hard link and records it", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "# bashrc")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{Mode: ModeHardlink}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if same, err := fs.SameFile(source, target); err != nil || !same {
+			t.Errorf("Target is not hard linked to the source: %v, %v", same, err)
+		}
+		if fs.GetLinkTarget(target) != "" {
+			t.Error("A symlink was created in hard link mode")
+		}
+
+		manifest, _ := service.LoadManifest()
+		if record := manifest.Repository(repoRoot).Link(target); record == nil || record.Kind != LinkKindHardlink {
+			t.Errorf("Hard link was not recorded: %+v", record)
+		}
+	})
+
+	t.Run("Existing hard link is recognized as already linked", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "# bashrc")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		if err := fs.CreateHardLink(target, source); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		plan, err := service.Plan(repoRoot, userHome, ignoreFileName, LinkOptions{Mode: ModeHardlink})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if plan.Actions[0].Kind != ActionSkip {
+			t.Errorf("Expected skip, got %+v", plan.Actions[0])
+		}
+	})
+
+	t.Run("File with the same content but another inode is a conflict", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "# bashrc")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		fs.AddFile(target, "# bashrc")
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{Mode: ModeHardlink}); err == nil {
+			t.Fatal("Expected error for a separate file at the target")
+		}
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{Mode: ModeHardlink, Conflict: ConflictOverwrite}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if same, _ := fs.SameFile(source, target); !same {
+			t.Error("Target was not replaced by a hard link")
+		}
+	})
+
+	t.Run("Different devices are an error", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "# bashrc")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		fs.Devices[userHome] = "home-volume"
+
+		err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{Mode: ModeHardlink})
+		if err == nil || !strings.Contains(err.Error(), "different file systems") {
+			t.Fatalf("Expected a cross-device error, got %v", err)
+		}
+		if fs.FileExists(target) {
+			t.Error("Target was created across devices")
+		}
+	})
+
+	t.Run("Directory source is an error", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(filepath.Join(repoRoot, ".config"))
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{filepath.Join(repoRoot, ".config")})
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{Mode: ModeHardlink}); err == nil {
+			t.Fatal("Expected error for a directory in hard link mode")
+		}
+	})
+
+	t.Run("Status reports a hard link as linked", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "# bashrc")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{Mode: ModeHardlink}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		statuses, err := service.Status(repoRoot, userHome, ignoreFileName)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(statuses) != 1 || statuses[0].State != LinkStateLinked {
+			t.Errorf("Expected linked, got %+v", statuses)
+		}
+	})
+
+	t.Run("Unlink removes hard links and keeps broken ones", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "# bashrc")
+		other := filepath.Join(repoRoot, ".vimrc")
+		fs.AddFile(other, "# vimrc")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source, other})
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{Mode: ModeHardlink}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		// An editor that saves by rename replaces the hard link with a new file
+		fs.AddFile(filepath.Join(userHome, ".vimrc"), "# edited")
+
+		result, err := service.UnlinkDotfiles(repoRoot, userHome, ignoreFileName, false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if fs.FileExists(target) {
+			t.Error("Hard link was not removed")
+		}
+		if !fs.FileExists(filepath.Join(userHome, ".vimrc")) {
+			t.Error("Broken hard link was removed")
+		}
+		if len(result.Removed) != 1 || len(result.Modified) != 1 {
+			t.Errorf("Unexpected result: %+v", result)
+		}
+	})
+
+	t.Run("Restore replaces the hard link with the original", func(t *testing.T) {
+		backupDir := "/state/dotfileslinker/backups"
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "# bashrc")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+		fs.AddFile(target, "# user bashrc")
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+
+		opts := LinkOptions{Mode: ModeHardlink, Conflict: ConflictBackup, BackupDir: backupDir, RunID: "run1"}
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, opts); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		result, err := service.Restore(repoRoot, backupDir, "run1", false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(result.Restored) != 1 || fs.Files[target] != "# user bashrc" {
+			t.Errorf("Original file was not restored over the hard link: %+v, %q", result, fs.Files[target])
+		}
+		if fs.Files[source] != "# bashrc" {
+			t.Error("Source was changed by the restore")
+		}
+	})
+}
@@ -0,0 +1,342 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// IncludeFileName is the name of the file in the repository root that lists the targets managed by include directives.
+// Each line holds a target pattern such as "~/.gitconfig", optionally followed by the format of the file.
+// Instead of being linked, these targets stay regular files that reference their source with the native
+// include mechanism of the format, so the settings other tools write to the same file survive.
+const IncludeFileName = "dotfiles_include"
+
+// includeFormat writes and recognizes the include directive of a configuration file format.
+type includeFormat struct {
+	directive func(source string) []string          // Lines that include source
+	matches   func(line string, source string) bool // Whether line is a directive that includes source
+	first     bool                                  // Whether the directive must precede other content
+}
+
+// includeFormats are the supported formats by name.
+var includeFormats = map[string]includeFormat{
+	"git": {
+		// Later includes override earlier settings, so the directive goes last and local settings stay first
+		// Git reads backslashes as escapes, so Windows paths are written with forward slashes
+		directive: func(source string) []string {
+			return []string{"[include]", "\tpath = " + quoteIncludePath(filepath.ToSlash(source))}
+		},
+		matches: func(line string, source string) bool {
+			key, value, found := strings.Cut(line, "=")
+			if !found || strings.TrimSpace(key) != "path" {
+				return false
+			}
+			value = unquoteIncludePath(value)
+			return value == filepath.ToSlash(source) || value == source || value == strings.ReplaceAll(source, `\`, `\\`)
+		},
+	},
+	"ssh": {
+		// An Include after a Host line only applies to that host, so the directive goes first
+		directive: func(source string) []string {
+			return []string{"Include " + quoteIncludePath(source)}
+		},
+		matches: func(line string, source string) bool {
+			keyword, value := splitDirective(line)
+			return strings.EqualFold(keyword, "Include") && unquoteIncludePath(value) == source
+		},
+		first: true,
+	},
+	"vim": {
+		directive: func(source string) []string {
+			return []string{"source " + strings.ReplaceAll(source, " ", `\ `)}
+		},
+		matches: func(line string, source string) bool {
+			keyword, value := splitDirective(line)
+			return (keyword == "source" || keyword == "so") && strings.ReplaceAll(value, `\ `, " ") == source
+		},
+	},
+	"tmux": {
+		directive: func(source string) []string {
+			return []string{"source-file " + quoteIncludePath(source)}
+		},
+		matches: func(line string, source string) bool {
+			keyword, value := splitDirective(line)
+			value = strings.TrimSpace(strings.TrimPrefix(value, "-q "))
+			return (keyword == "source-file" || keyword == "source") && unquoteIncludePath(value) == source
+		},
+	},
+}
+
+// detectIncludeFormat returns the format of the target path from its well-known name, or an empty string.
+func detectIncludeFormat(target string) string {
+	slashed := filepath.ToSlash(target)
+	switch {
+	case strings.HasSuffix(slashed, "/.gitconfig") || strings.HasSuffix(slashed, "/git/config"):
+		return "git"
+	case strings.HasSuffix(slashed, "/.ssh/config") || strings.HasSuffix(slashed, "/ssh/ssh_config"):
+		return "ssh"
+	case strings.HasSuffix(slashed, "/.vimrc") || strings.HasSuffix(slashed, "/.gvimrc") || strings.HasSuffix(slashed, "/init.vim"):
+		return "vim"
+	case strings.HasSuffix(slashed, "/.tmux.conf") || strings.HasSuffix(slashed, "/tmux/tmux.conf"):
+		return "tmux"
+	}
+	return ""
+}
+
+// includeRule selects targets by pattern and optionally names their format.
+type includeRule struct {
+	pattern targetPattern
+	format  string // Name of the format; empty to detect it from the target name
+}
+
+// loadIncludeRules reads the include file of the repository. A missing file selects nothing.
+// Blank lines and lines starting with '#' are skipped.
+func (s *FileLinkerService) loadIncludeRules(repoRoot string) ([]includeRule, error) {
+	path := filepath.Join(repoRoot, IncludeFileName)
+	if !s.fs.FileExists(path) {
+		return nil, nil
+	}
+	lines, err := s.fs.ReadAllLines(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var rules []includeRule
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("invalid %s: line %d: expected a pattern and an optional format", path, i+1)
+		}
+		pattern, err := parseTargetPattern(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: line %d: %w", path, i+1, err)
+		}
+		rule := includeRule{pattern: pattern}
+		if len(fields) == 2 {
+			if _, ok := includeFormats[fields[1]]; !ok {
+				return nil, fmt.Errorf("invalid %s: line %d: unknown format %q (expected %s)", path, i+1, fields[1], strings.Join(includeFormatNames(), ", "))
+			}
+			rule.format = fields[1]
+		}
+		rules = append(rules, rule)
+	}
+	s.logger.Verbose(fmt.Sprintf("Loaded %d include patterns from %s", len(rules), path))
+	return rules, nil
+}
+
+// includeFormatNames returns the names of the supported formats in order.
+func includeFormatNames() []string {
+	names := make([]string, 0, len(includeFormats))
+	for name := range includeFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// markIncluded sets the include format of the file entries whose target matches an include rule.
+// Only plain sources can be included, since the directive references the source in the repository.
+func (s *FileLinkerService) markIncluded(entries []linkEntry, rules []includeRule, userHome string) error {
+	for i := range entries {
+		if s.fs.DirectoryExists(entries[i].source) {
+			continue
+		}
+		for _, rule := range rules {
+			if !rule.pattern.matches(entries[i].target, userHome) {
+				continue
+			}
+			format := rule.format
+			if format == "" {
+				format = detectIncludeFormat(entries[i].target)
+			}
+			switch {
+			case format == "":
+				return fmt.Errorf("cannot detect the include format of %s; add one of %s after its pattern in %s", entries[i].target, strings.Join(includeFormatNames(), ", "), IncludeFileName)
+			case entries[i].template || entries[i].encrypted || entries[i].injected:
+				return fmt.Errorf("%s cannot be included: only plain sources can be referenced by an include directive", entries[i].source)
+			}
+			entries[i].include = format
+			break
+		}
+	}
+	return nil
+}
+
+// hasInclude reports whether content holds the directive that includes source.
+func hasInclude(content string, format includeFormat, source string) bool {
+	for _, line := range strings.Split(content, "\n") {
+		if format.matches(strings.TrimSpace(line), source) {
+			return true
+		}
+	}
+	return false
+}
+
+// addInclude returns content with the directive that includes source, unless it already holds it.
+func addInclude(content string, format includeFormat, source string) string {
+	if hasInclude(content, format, source) {
+		return content
+	}
+	directive := strings.Join(format.directive(source), "\n") + "\n"
+	switch {
+	case format.first:
+		return directive + content
+	case content == "" || strings.HasSuffix(content, "\n"):
+		return content + directive
+	default:
+		return content + "\n" + directive
+	}
+}
+
+// removeInclude returns content without the directives that include source.
+// A git [include] section left empty is removed too.
+func removeInclude(content string, format includeFormat, source string) string {
+	lines := strings.SplitAfter(content, "\n")
+	kept := make([]string, 0, len(lines))
+	for i, line := range lines {
+		if !format.matches(strings.TrimSpace(line), source) {
+			kept = append(kept, line)
+			continue
+		}
+		last := len(kept) - 1
+		if last >= 0 && strings.TrimSpace(kept[last]) == "[include]" && (i+1 == len(lines) || sectionStart(lines[i+1])) {
+			kept = kept[:last]
+		}
+	}
+	return strings.Join(kept, "")
+}
+
+// sectionStart reports whether line starts a git configuration section or ends the content.
+func sectionStart(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed == "" || strings.HasPrefix(trimmed, "[")
+}
+
+// splitDirective splits a configuration line into its keyword and the rest of the line.
+func splitDirective(line string) (string, string) {
+	fields := strings.SplitN(strings.TrimSpace(line), " ", 2)
+	if len(fields) < 2 {
+		return fields[0], ""
+	}
+	return fields[0], strings.TrimSpace(fields[1])
+}
+
+// quoteIncludePath quotes path when it contains spaces.
+func quoteIncludePath(path string) string {
+	if strings.ContainsAny(path, " \t") {
+		return `"` + path + `"`
+	}
+	return path
+}
+
+// unquoteIncludePath returns the path of a directive value without surrounding quotes.
+func unquoteIncludePath(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// planIncluded decides how the include directive of a target is written.
+// The existing content of the target is kept and the directive is only added when it is missing.
+func (s *FileLinkerService) planIncluded(action Action, opts LinkOptions) (Action, error) {
+	format := includeFormats[action.Include]
+	action.Content = addInclude("", format, action.Source)
+	if s.fs.GetLinkTarget(action.Target) != "" || s.fs.DirectoryExists(action.Target) {
+		return s.planConflict(action, s.describeExisting(action.Target), opts)
+	}
+	if !s.fs.FileExists(action.Target) {
+		action.Kind = ActionLink
+		action.Reason = "target does not exist"
+		return action, nil
+	}
+
+	existing, err := s.fs.ReadFile(action.Target)
+	if err != nil {
+		return action, fmt.Errorf("failed to read %s: %w", action.Target, err)
+	}
+	if hasInclude(string(existing), format, action.Source) {
+		action.Kind = ActionSkip
+		action.Reason = "include directive is present"
+		return action, nil
+	}
+	action.Kind = ActionReplace
+	action.Reason = "include directive is added"
+	action.Content = addInclude(string(existing), format, action.Source)
+	return action, nil
+}
+
+// classifyIncluded determines the state of a target that includes its source.
+// A regular file without the directive is missing it.
+func (s *FileLinkerService) classifyIncluded(entry linkEntry) LinkStatus {
+	status := s.classifyTarget(entry)
+	if status.State != LinkStateConflict || s.fs.DirectoryExists(entry.target) {
+		return status
+	}
+
+	content, err := s.fs.ReadFile(entry.target)
+	if err != nil {
+		s.logger.Verbose(fmt.Sprintf("Cannot read %s: %s", entry.target, err))
+		return status
+	}
+	if hasInclude(string(content), includeFormats[entry.include], entry.source) {
+		status.State = LinkStateLinked
+	} else {
+		status.State = LinkStateMissing
+	}
+	return status
+}
+
+// unlinkIncluded removes the include directive of the source from a target.
+// The rest of the file is kept; a file left empty is removed.
+func (s *FileLinkerService) unlinkIncluded(record *ManifestLink, state *RepositoryState, result *UnlinkResult, dryRun bool) error {
+	target := record.Target
+	format, known := includeFormats[record.Format]
+	if s.fs.GetLinkTarget(target) != "" || !s.fs.FileExists(target) || !known {
+		s.logger.Verbose(fmt.Sprintf("Skipping %s: including file no longer exists", target))
+		result.NotLinked = append(result.NotLinked, target)
+		if !dryRun {
+			state.removeLink(target)
+		}
+		return nil
+	}
+
+	content, err := s.fs.ReadFile(target)
+	if err != nil {
+		return fmt.Errorf("failed to read including file %s: %w", target, err)
+	}
+	if !hasInclude(string(content), format, record.Source) {
+		s.logger.Verbose(fmt.Sprintf("Skipping %s: include directive no longer exists", target))
+		result.NotLinked = append(result.NotLinked, target)
+		if !dryRun {
+			state.removeLink(target)
+		}
+		return nil
+	}
+
+	remaining := removeInclude(string(content), format, record.Source)
+	if dryRun {
+		s.logger.Success(fmt.Sprintf("[DRY-RUN] Would remove include directive from %s", target))
+		result.Removed = append(result.Removed, target)
+		return nil
+	}
+	if strings.TrimSpace(remaining) == "" {
+		s.logger.Success(fmt.Sprintf("Removing including file: %s", target))
+		err = s.fs.Delete(target)
+	} else {
+		s.logger.Success(fmt.Sprintf("Removing include directive from %s", target))
+		err = s.fs.UpdateFile(target, []byte(remaining))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to remove include directive from %s: %w", target, err)
+	}
+	state.removeLink(target)
+	result.Removed = append(result.Removed, target)
+	return nil
+}
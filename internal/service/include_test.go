@@ -0,0 +1,293 @@
+package service
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/guitarrapc/dotfileslinker-go/internal/infrastructure"
+)
+
+func TestIncludeFormats(t *testing.T) {
+	source := "/repo/my dotfiles/config"
+
+	tests := map[string]struct {
+		content  string
+		expected string
+	}{
+		"git":  {"[user]\n\tname = me\n", "[user]\n\tname = me\n[include]\n\tpath = \"" + source + "\"\n"},
+		"ssh":  {"Host *\n  ForwardAgent no\n", "Include \"" + source + "\"\nHost *\n  ForwardAgent no\n"},
+		"vim":  {"set number", "set number\nsource /repo/my\\ dotfiles/config\n"},
+		"tmux": {"", "source-file \"" + source + "\"\n"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			format := includeFormats[name]
+			result := addInclude(tt.content, format, source)
+			if result != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result)
+			}
+			if !hasInclude(result, format, source) || addInclude(result, format, source) != result {
+				t.Error("Directive was not recognized after it was added")
+			}
+			if removed := removeInclude(result, format, source); strings.TrimSuffix(removed, "\n") != strings.TrimSuffix(tt.content, "\n") {
+				t.Errorf("Expected %q after removal, got %q", tt.content, removed)
+			}
+		})
+	}
+
+	t.Run("Existing directives written by hand are recognized", func(t *testing.T) {
+		lines := map[string]string{
+			"git":  "[include]\n  path=/repo/x\n",
+			"ssh":  "include /repo/x\n",
+			"vim":  "so /repo/x\n",
+			"tmux": "source-file -q /repo/x\n",
+		}
+		for name, content := range lines {
+			if !hasInclude(content, includeFormats[name], "/repo/x") {
+				t.Errorf("%s directive %q was not recognized", name, content)
+			}
+		}
+	})
+
+	t.Run("Git paths are written with forward slashes", func(t *testing.T) {
+		source := filepath.FromSlash("C:/Users/me/dotfiles/.gitconfig")
+		format := includeFormats["git"]
+
+		if result := addInclude("", format, source); result != "[include]\n\tpath = C:/Users/me/dotfiles/.gitconfig\n" {
+			t.Errorf("Unexpected directive %q", result)
+		}
+		escaped := strings.ReplaceAll(source, `\`, `\\`)
+		for _, path := range []string{"C:/Users/me/dotfiles/.gitconfig", escaped} {
+			if !hasInclude("[include]\n\tpath = "+path+"\n", format, source) {
+				t.Errorf("Directive with path %q was not recognized", path)
+			}
+		}
+	})
+
+	t.Run("Format is detected from the target name", func(t *testing.T) {
+		targets := map[string]string{
+			"/home/user/.gitconfig":         "git",
+			"/home/user/.config/git/config": "git",
+			"/home/user/.ssh/config":        "ssh",
+			"/home/user/.vimrc":             "vim",
+			"/home/user/.tmux.conf":         "tmux",
+			"/home/user/.bashrc":            "",
+		}
+		for target, expected := range targets {
+			if format := detectIncludeFormat(target); format != expected {
+				t.Errorf("Expected %q for %s, got %q", expected, target, format)
+			}
+		}
+	})
+}
+
+func TestFileLinkerService_Include(t *testing.T) {
+	repoRoot := "/repo"
+	userHome := "/home/user"
+	ignoreFileName := ".ignore"
+	manifestPath := "/state/dotfileslinker/manifest.json"
+	source := filepath.Join(repoRoot, ".gitconfig")
+	target := filepath.Join(userHome, ".gitconfig")
+	local := "[credential]\n\thelper = store\n"
+	directive := "[include]\n\tpath = " + source + "\n"
+
+	t.Run("Directive is added and the existing content is kept", func(t *testing.T) {
+		// Repository whose .gitconfig is included from the existing file
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "[alias]\n\tst = status\n")
+		fs.AddFile(filepath.Join(repoRoot, IncludeFileName), "~/.gitconfig\n")
+		fs.AddFile(target, local)
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.Files[target] != local+directive {
+			t.Errorf("Unexpected content %q", fs.Files[target])
+		}
+		manifest, _ := service.LoadManifest()
+		record := manifest.Repository(repoRoot).Link(target)
+		if record == nil || record.Kind != LinkKindIncluded || record.Format != "git" {
+			t.Errorf("Include was not recorded: %+v", record)
+		}
+		statuses, err := service.Status(repoRoot, userHome, ignoreFileName)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(statuses) != 1 || statuses[0].State != LinkStateLinked {
+			t.Errorf("Expected linked, got %+v", statuses)
+		}
+	})
+
+	t.Run("Present directive is not added again", func(t *testing.T) {
+		// Repository whose .gitconfig is included from the existing file
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "[alias]\n\tst = status\n")
+		fs.AddFile(filepath.Join(repoRoot, IncludeFileName), "~/.gitconfig\n")
+		fs.AddFile(target, local)
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		fs.AddFile(target, directive+local)
+
+		plan, err := service.Plan(repoRoot, userHome, ignoreFileName, LinkOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if plan.Actions[0].Kind != ActionSkip {
+			t.Errorf("Expected skip, got %+v", plan.Actions[0])
+		}
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.Files[target] != directive+local {
+			t.Errorf("Content was changed to %q", fs.Files[target])
+		}
+	})
+
+	t.Run("Symbolic link target is a conflict", func(t *testing.T) {
+		// Repository whose .gitconfig is included from the existing file
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "[alias]\n\tst = status\n")
+		fs.AddFile(filepath.Join(repoRoot, IncludeFileName), "~/.gitconfig\n")
+		fs.AddFile(target, local)
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		delete(fs.Files, target)
+		fs.SymLinks[target] = source
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err == nil || !strings.Contains(err.Error(), "already exists") {
+			t.Fatalf("Expected a conflict, got %v", err)
+		}
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{Conflict: ConflictOverwrite}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.GetLinkTarget(target) != "" || fs.Files[target] != directive {
+			t.Errorf("Link was not replaced with an including file: %q", fs.Files[target])
+		}
+	})
+
+	t.Run("Mode and owner of the target are kept", func(t *testing.T) {
+		// Repository whose .gitconfig is included from the existing file
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "[alias]\n\tst = status\n")
+		fs.AddFile(filepath.Join(repoRoot, IncludeFileName), "~/.gitconfig\n")
+		fs.AddFile(target, local)
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		fs.Modes[target] = 0600
+		fs.Owners[target] = "alice:staff"
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.Modes[target] != 0600 || fs.Owners[target] != "alice:staff" {
+			t.Errorf("Adding the directive changed the target to %04o %s", fs.Modes[target], fs.Owners[target])
+		}
+
+		if _, err := service.UnlinkDotfiles(repoRoot, userHome, ignoreFileName, false); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.Files[target] != local || fs.Modes[target] != 0600 || fs.Owners[target] != "alice:staff" {
+			t.Errorf("Removing the directive changed the target to %04o %s", fs.Modes[target], fs.Owners[target])
+		}
+	})
+
+	t.Run("Unlink removes only the directive", func(t *testing.T) {
+		// Repository whose .gitconfig is included from the existing file
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "[alias]\n\tst = status\n")
+		fs.AddFile(filepath.Join(repoRoot, IncludeFileName), "~/.gitconfig\n")
+		fs.AddFile(target, local)
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		result, err := service.UnlinkDotfiles(repoRoot, userHome, ignoreFileName, false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.Files[target] != local || len(result.Removed) != 1 {
+			t.Errorf("Expected the original content, got %q (%+v)", fs.Files[target], result)
+		}
+	})
+
+	t.Run("Restore puts back the backed up content in place", func(t *testing.T) {
+		// Repository whose .gitconfig is included from the existing file
+		backupDir := "/state/dotfileslinker/backups"
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "[alias]\n\tst = status\n")
+		fs.AddFile(filepath.Join(repoRoot, IncludeFileName), "~/.gitconfig\n")
+		fs.AddFile(target, local)
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		fs.Owners[target] = "alice:staff"
+
+		opts := LinkOptions{Conflict: ConflictBackup, BackupDir: backupDir, RunID: "run1"}
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, opts); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.Files[target] != local+directive {
+			t.Fatalf("Directive was not added: %q", fs.Files[target])
+		}
+
+		result, err := service.Restore(repoRoot, backupDir, "run1", false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(result.Restored) != 1 || fs.Files[target] != local || fs.Owners[target] != "alice:staff" {
+			t.Errorf("Original content was not restored in place: %+v, %q %s", result, fs.Files[target], fs.Owners[target])
+		}
+		manifest, _ := service.LoadManifest()
+		if manifest.Repository(repoRoot).Link(target) != nil {
+			t.Error("Restored target is still recorded")
+		}
+	})
+
+	t.Run("Undetectable format is an error", func(t *testing.T) {
+		// Repository whose .gitconfig is included from the existing file
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "[alias]\n\tst = status\n")
+		fs.AddFile(filepath.Join(repoRoot, IncludeFileName), "~/.gitconfig\n")
+		fs.AddFile(target, local)
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		bashrc := filepath.Join(repoRoot, ".bashrc")
+		fs.AddFile(bashrc, "# bashrc")
+		fs.AddFile(filepath.Join(repoRoot, IncludeFileName), "~/.*\n")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source, bashrc})
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err == nil || !strings.Contains(err.Error(), "cannot detect") {
+			t.Fatalf("Expected a format error, got %v", err)
+		}
+
+		fs.AddFile(filepath.Join(repoRoot, IncludeFileName), "~/.bashrc sh\n")
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err == nil || !strings.Contains(err.Error(), "unknown format") {
+			t.Fatalf("Expected an unknown format error, got %v", err)
+		}
+	})
+}
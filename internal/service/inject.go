@@ -0,0 +1,306 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// InjectFileName is the name of the file in the repository root that lists the targets managed by injection.
+// Each line holds a target pattern such as "~/.bashrc" or "/etc/profile.d/*". Instead of being linked,
+// these targets stay regular files and the content of their source is kept in a delimited block inside them,
+// so content other tools put in the same file survives.
+const InjectFileName = "dotfiles_inject"
+
+const (
+	// injectBegin is the line that starts the managed block in an injected target.
+	injectBegin = "# >>> dotfileslinker >>>"
+	// injectEnd is the line that ends the managed block in an injected target.
+	injectEnd = "# <<< dotfileslinker <<<"
+)
+
+// loadInjectPatterns reads the inject file of the repository. A missing file selects nothing.
+// Blank lines and lines starting with '#' are skipped.
+func (s *FileLinkerService) loadInjectPatterns(repoRoot string) ([]targetPattern, error) {
+	path := filepath.Join(repoRoot, InjectFileName)
+	if !s.fs.FileExists(path) {
+		return nil, nil
+	}
+	lines, err := s.fs.ReadAllLines(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var patterns []targetPattern
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pattern, err := parseTargetPattern(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: line %d: %w", path, i+1, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	s.logger.Verbose(fmt.Sprintf("Loaded %d inject patterns from %s", len(patterns), path))
+	return patterns, nil
+}
+
+// markInjected marks the file entries whose target matches an inject pattern.
+func (s *FileLinkerService) markInjected(entries []linkEntry, patterns []targetPattern, userHome string) {
+	for i := range entries {
+		if s.fs.DirectoryExists(entries[i].source) {
+			continue
+		}
+		for _, pattern := range patterns {
+			if pattern.matches(entries[i].target, userHome) {
+				entries[i].injected = true
+				break
+			}
+		}
+	}
+}
+
+// blockRange is the position of the managed block in the content of an injected target.
+type blockRange struct {
+	begin     int // Start of the begin marker line
+	bodyStart int // Start of the first line after the begin marker
+	bodyEnd   int // Start of the end marker line
+	end       int // End of the end marker line, including its line break
+}
+
+// findBlock locates the first complete managed block in content.
+func findBlock(content string) (blockRange, bool) {
+	var block blockRange
+	begin, beginEnd := markerLine(content, injectBegin, 0)
+	if begin < 0 {
+		return block, false
+	}
+	end, endEnd := markerLine(content, injectEnd, beginEnd)
+	if end < 0 {
+		return block, false
+	}
+	return blockRange{begin: begin, bodyStart: beginEnd, bodyEnd: end, end: endEnd}, true
+}
+
+// markerLine returns the start and end of the first line at or after from that consists of marker,
+// the end including the line break. The start is -1 when there is no such line.
+func markerLine(content string, marker string, from int) (int, int) {
+	for offset := from; offset < len(content); {
+		line, _, hasBreak := strings.Cut(content[offset:], "\n")
+		next := offset + len(line) + 1
+		if !hasBreak {
+			next = len(content)
+		}
+		if strings.TrimSpace(line) == marker {
+			return offset, next
+		}
+		offset = next
+	}
+	return -1, -1
+}
+
+// extractBlock returns the content between the managed block markers of content,
+// and whether content holds a complete block.
+func extractBlock(content string) (string, bool) {
+	block, found := findBlock(content)
+	if !found {
+		return "", false
+	}
+	return content[block.bodyStart:block.bodyEnd], true
+}
+
+// injectBlock returns content with its managed block holding body. An existing block is replaced in place;
+// otherwise the block is appended after the existing content.
+func injectBlock(content string, body string) string {
+	block := injectBegin + "\n" + normalizeBody(body) + injectEnd + "\n"
+
+	if existing, found := findBlock(content); found {
+		return content[:existing.begin] + block + content[existing.end:]
+	}
+	switch {
+	case content == "":
+		return block
+	case strings.HasSuffix(content, "\n"):
+		return content + "\n" + block
+	default:
+		return content + "\n\n" + block
+	}
+}
+
+// removeBlock returns content without its managed block and the blank line injectBlock put before it.
+func removeBlock(content string) string {
+	block, found := findBlock(content)
+	if !found {
+		return content
+	}
+	before := content[:block.begin]
+	if strings.HasSuffix(before, "\n\n") {
+		before = strings.TrimSuffix(before, "\n")
+	}
+	return before + content[block.end:]
+}
+
+// injectedBody returns the content an injected entry keeps in its managed block:
+// the generated content of templates and encrypted sources, otherwise the source itself.
+func (s *FileLinkerService) injectedBody(entry linkEntry) (string, error) {
+	if entry.template || entry.encrypted {
+		return entry.rendered, nil
+	}
+	content, err := s.fs.ReadFile(entry.source)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", entry.source, err)
+	}
+	return string(content), nil
+}
+
+// planInjected decides how the managed block of an injected target is written.
+// A block that only changed in the repository is rewritten; a block edited locally is a conflict, like an edited copy.
+// action.Content holds the body of the block and is replaced by the full content of the target.
+func (s *FileLinkerService) planInjected(action Action, opts LinkOptions, state *RepositoryState) (Action, error) {
+	body := action.Content
+	action.Content = injectBlock("", body)
+	if s.fs.GetLinkTarget(action.Target) != "" || s.fs.DirectoryExists(action.Target) {
+		return s.planConflict(action, s.describeExisting(action.Target), opts)
+	}
+	if !s.fs.FileExists(action.Target) {
+		action.Kind = ActionLink
+		action.Reason = "target does not exist"
+		return action, nil
+	}
+
+	existing, err := s.fs.ReadFile(action.Target)
+	if err != nil {
+		return action, fmt.Errorf("failed to read %s: %w", action.Target, err)
+	}
+	action.Content = injectBlock(string(existing), body)
+	current, found := extractBlock(string(existing))
+	switch {
+	case !found:
+		action.Kind = ActionReplace
+		action.Reason = "managed block is added"
+		return action, nil
+	case current == normalizeBody(body):
+		action.Kind = ActionSkip
+		action.Reason = "managed block is up to date"
+		return action, nil
+	}
+
+	var record *ManifestLink
+	if state != nil {
+		record = state.Link(action.Target)
+	}
+	if record == nil || record.Kind != LinkKindInjected || record.Hash == "" {
+		return s.planConflict(action, "managed block that differs from the source", opts)
+	}
+	drift := classifyDrift(record.Hash, contentHash(normalizeBody(body)), contentHash(current))
+	if drift == CopyChangedInRepo {
+		action.Kind = ActionReplace
+		action.Reason = "source changed"
+		return action, nil
+	}
+	s.logger.Verbose(fmt.Sprintf("%s: managed block %s", action.Target, drift))
+	return s.planConflict(action, fmt.Sprintf("managed block %s", drift), opts)
+}
+
+// normalizeBody returns body the way injectBlock writes it, ending with a line break.
+func normalizeBody(body string) string {
+	if body != "" && !strings.HasSuffix(body, "\n") {
+		return body + "\n"
+	}
+	return body
+}
+
+// blockHash returns the hash of the managed block in the file at path, or an empty string when it has none.
+func (s *FileLinkerService) blockHash(path string) (string, error) {
+	content, err := s.fs.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	body, found := extractBlock(string(content))
+	if !found {
+		return "", nil
+	}
+	return contentHash(body), nil
+}
+
+// classifyInjected determines the state of the managed block of an injected target.
+// A regular file without the block is missing it; a block that differs is compared with the recorded hash.
+func (s *FileLinkerService) classifyInjected(entry linkEntry, body string, state *RepositoryState) LinkStatus {
+	status := s.classifyTarget(entry)
+	if status.State != LinkStateConflict || s.fs.DirectoryExists(entry.target) {
+		return status
+	}
+
+	targetHash, err := s.blockHash(entry.target)
+	if err != nil {
+		s.logger.Verbose(fmt.Sprintf("Cannot compare managed block of %s: %s", entry.target, err))
+		return status
+	}
+	sourceHash := contentHash(normalizeBody(body))
+	switch {
+	case targetHash == "":
+		status.State = LinkStateMissing
+	case targetHash == sourceHash:
+		status.State = LinkStateLinked
+	case state != nil:
+		if record := state.Link(entry.target); record != nil && record.Kind == LinkKindInjected && record.Hash != "" {
+			status.State = driftState(classifyDrift(record.Hash, sourceHash, targetHash))
+		}
+	}
+	return status
+}
+
+// unlinkInjected removes the managed block from an injected target unless it was edited after it was written.
+// The rest of the file is kept; a file left empty is removed.
+func (s *FileLinkerService) unlinkInjected(record *ManifestLink, state *RepositoryState, result *UnlinkResult, dryRun bool) error {
+	target := record.Target
+	if s.fs.GetLinkTarget(target) != "" || !s.fs.FileExists(target) {
+		s.logger.Verbose(fmt.Sprintf("Skipping %s: injected file no longer exists", target))
+		result.NotLinked = append(result.NotLinked, target)
+		if !dryRun {
+			state.removeLink(target)
+		}
+		return nil
+	}
+
+	content, err := s.fs.ReadFile(target)
+	if err != nil {
+		return fmt.Errorf("failed to read injected file %s: %w", target, err)
+	}
+	body, found := extractBlock(string(content))
+	if !found {
+		s.logger.Verbose(fmt.Sprintf("Skipping %s: managed block no longer exists", target))
+		result.NotLinked = append(result.NotLinked, target)
+		if !dryRun {
+			state.removeLink(target)
+		}
+		return nil
+	}
+	if contentHash(body) != record.Hash {
+		s.logger.Error(fmt.Sprintf("Keeping %s: managed block was changed locally", target))
+		result.Modified = append(result.Modified, target)
+		return nil
+	}
+
+	remaining := removeBlock(string(content))
+	if dryRun {
+		s.logger.Success(fmt.Sprintf("[DRY-RUN] Would remove managed block from %s", target))
+		result.Removed = append(result.Removed, target)
+		return nil
+	}
+	if strings.TrimSpace(remaining) == "" {
+		s.logger.Success(fmt.Sprintf("Removing injected file: %s", target))
+		err = s.fs.Delete(target)
+	} else {
+		s.logger.Success(fmt.Sprintf("Removing managed block from %s", target))
+		err = s.fs.UpdateFile(target, []byte(remaining))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to remove managed block from %s: %w", target, err)
+	}
+	state.removeLink(target)
+	result.Removed = append(result.Removed, target)
+	return nil
+}
@@ -0,0 +1,337 @@
+package service
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/guitarrapc/dotfileslinker-go/internal/infrastructure"
+)
+
+func TestInjectBlock(t *testing.T) {
+	block := injectBegin + "\nalias ll='ls -l'\n" + injectEnd + "\n"
+
+	tests := map[string]struct {
+		content  string
+		expected string
+	}{
+		"empty file":                 {"", block},
+		"content with a line break":  {"# vendor\n", "# vendor\n\n" + block},
+		"content without line break": {"# vendor", "# vendor\n\n" + block},
+		"existing block": {
+			"# before\n" + injectBegin + "\nold\n" + injectEnd + "\n# after\n",
+			"# before\n" + block + "# after\n",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			result := injectBlock(tt.content, "alias ll='ls -l'")
+			if result != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result)
+			}
+			if injectBlock(result, "alias ll='ls -l'") != result {
+				t.Error("Injecting the same body again changed the content")
+			}
+		})
+	}
+
+	t.Run("Remove restores the original content", func(t *testing.T) {
+		for _, original := range []string{"# vendor\n", ""} {
+			if removed := removeBlock(injectBlock(original, "x")); removed != original {
+				t.Errorf("Expected %q after removal, got %q", original, removed)
+			}
+		}
+	})
+
+	t.Run("Incomplete block is not found", func(t *testing.T) {
+		if _, found := extractBlock("# x\n" + injectBegin + "\nbody\n"); found {
+			t.Error("Block without an end marker was found")
+		}
+	})
+}
+
+func TestFileLinkerService_Inject(t *testing.T) {
+	repoRoot := "/repo"
+	userHome := "/home/user"
+	ignoreFileName := ".ignore"
+	manifestPath := "/state/dotfileslinker/manifest.json"
+	source := filepath.Join(repoRoot, ".bashrc")
+	target := filepath.Join(userHome, ".bashrc")
+	vendor := "# added by installer\nexport PATH=$HOME/.tool/bin:$PATH\n"
+
+	t.Run("Block is appended and the existing content is kept", func(t *testing.T) {
+		// Repository whose .bashrc is injected into the existing file
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "alias ll='ls -l'\n")
+		fs.AddFile(filepath.Join(repoRoot, InjectFileName), "# shells\n~/.bashrc\n")
+		fs.AddFile(target, vendor)
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		if statuses, err := service.Status(repoRoot, userHome, ignoreFileName); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		} else if len(statuses) != 1 || statuses[0].State != LinkStateMissing {
+			t.Errorf("Expected a file without the block to be missing, got %+v", statuses)
+		}
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := vendor + "\n" + injectBegin + "\nalias ll='ls -l'\n" + injectEnd + "\n"
+		if fs.Files[target] != expected {
+			t.Errorf("Unexpected content %q", fs.Files[target])
+		}
+		if fs.GetLinkTarget(target) != "" {
+			t.Error("Injected target was replaced with a link")
+		}
+		manifest, _ := service.LoadManifest()
+		record := manifest.Repository(repoRoot).Link(target)
+		if record == nil || record.Kind != LinkKindInjected || record.Hash != contentHash("alias ll='ls -l'\n") {
+			t.Errorf("Block was not recorded with its hash: %+v", record)
+		}
+		if statuses, err := service.Status(repoRoot, userHome, ignoreFileName); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		} else if len(statuses) != 1 || statuses[0].State != LinkStateLinked {
+			t.Errorf("Expected linked, got %+v", statuses)
+		}
+	})
+
+	t.Run("Missing target is created with the block only", func(t *testing.T) {
+		// Repository whose .bashrc is injected into the existing file
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "alias ll='ls -l'\n")
+		fs.AddFile(filepath.Join(repoRoot, InjectFileName), "# shells\n~/.bashrc\n")
+		fs.AddFile(target, vendor)
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		delete(fs.Files, target)
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.Files[target] != injectBegin+"\nalias ll='ls -l'\n"+injectEnd+"\n" {
+			t.Errorf("Unexpected content %q", fs.Files[target])
+		}
+	})
+
+	t.Run("Second run changes nothing", func(t *testing.T) {
+		// Repository whose .bashrc is injected into the existing file
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "alias ll='ls -l'\n")
+		fs.AddFile(filepath.Join(repoRoot, InjectFileName), "# shells\n~/.bashrc\n")
+		fs.AddFile(target, vendor)
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		linked := fs.Files[target]
+
+		plan, err := service.Plan(repoRoot, userHome, ignoreFileName, LinkOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if plan.Actions[0].Kind != ActionSkip || plan.Actions[0].Reason != "managed block is up to date" {
+			t.Errorf("Unexpected action: %+v", plan.Actions[0])
+		}
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.Files[target] != linked {
+			t.Errorf("Second run changed the content to %q", fs.Files[target])
+		}
+	})
+
+	t.Run("Changed source rewrites the block and local edits conflict", func(t *testing.T) {
+		// Repository whose .bashrc is injected into the existing file
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "alias ll='ls -l'\n")
+		fs.AddFile(filepath.Join(repoRoot, InjectFileName), "# shells\n~/.bashrc\n")
+		fs.AddFile(target, vendor)
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		fs.AddFile(source, "alias la='ls -a'\n")
+		fs.Files[target] = "# prepended later\n" + fs.Files[target]
+
+		if statuses, err := service.Status(repoRoot, userHome, ignoreFileName); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		} else if len(statuses) != 1 || statuses[0].State != LinkStateOutdated {
+			t.Errorf("Expected outdated, got %+v", statuses)
+		}
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.HasPrefix(fs.Files[target], "# prepended later\n"+vendor) || !strings.Contains(fs.Files[target], "alias la='ls -a'") || strings.Contains(fs.Files[target], "alias ll") {
+			t.Errorf("Block was not rewritten in place: %q", fs.Files[target])
+		}
+
+		fs.Files[target] = strings.Replace(fs.Files[target], "alias la", "alias lx", 1)
+		if statuses, err := service.Status(repoRoot, userHome, ignoreFileName); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		} else if len(statuses) != 1 || statuses[0].State != LinkStateModified {
+			t.Errorf("Expected modified, got %+v", statuses)
+		}
+		err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{})
+		if err == nil || !strings.Contains(err.Error(), "managed block changed locally") {
+			t.Fatalf("Expected a local change conflict, got %v", err)
+		}
+	})
+
+	t.Run("Mode and owner of the target are kept", func(t *testing.T) {
+		// Repository whose .bashrc is injected into the existing file
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "alias ll='ls -l'\n")
+		fs.AddFile(filepath.Join(repoRoot, InjectFileName), "# shells\n~/.bashrc\n")
+		fs.AddFile(target, vendor)
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		fs.Modes[target] = 0600
+		fs.Owners[target] = "alice:staff"
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.Modes[target] != 0600 || fs.Owners[target] != "alice:staff" {
+			t.Errorf("Injecting changed the target to %04o %s", fs.Modes[target], fs.Owners[target])
+		}
+
+		if _, err := service.UnlinkDotfiles(repoRoot, userHome, ignoreFileName, false); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.Files[target] != vendor || fs.Modes[target] != 0600 || fs.Owners[target] != "alice:staff" {
+			t.Errorf("Removing the block changed the target to %04o %s", fs.Modes[target], fs.Owners[target])
+		}
+	})
+
+	t.Run("Unlink removes only the block", func(t *testing.T) {
+		// Repository whose .bashrc is injected into the existing file
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "alias ll='ls -l'\n")
+		fs.AddFile(filepath.Join(repoRoot, InjectFileName), "# shells\n~/.bashrc\n")
+		fs.AddFile(target, vendor)
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		result, err := service.UnlinkDotfiles(repoRoot, userHome, ignoreFileName, false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.Files[target] != vendor || len(result.Removed) != 1 {
+			t.Errorf("Expected the original content, got %q (%+v)", fs.Files[target], result)
+		}
+		manifest, _ := service.LoadManifest()
+		if state := manifest.Repository(repoRoot); state != nil && state.Link(target) != nil {
+			t.Error("Block is still recorded")
+		}
+	})
+
+	t.Run("Restore puts back the backed up content and keeps edited files", func(t *testing.T) {
+		// Repository whose .bashrc and .profile are injected into the existing files
+		backupDir := "/state/dotfileslinker/backups"
+		profileSource := filepath.Join(repoRoot, ".profile")
+		profile := filepath.Join(userHome, ".profile")
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "alias ll='ls -l'\n")
+		fs.AddFile(profileSource, "umask 022\n")
+		fs.AddFile(filepath.Join(repoRoot, InjectFileName), "# shells\n~/.bashrc\n~/.profile\n")
+		fs.AddFile(target, vendor)
+		fs.AddFile(profile, vendor)
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source, profileSource})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		fs.Modes[target] = 0600
+
+		opts := LinkOptions{Conflict: ConflictBackup, BackupDir: backupDir, RunID: "run1"}
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, opts); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		fs.AddFile(profile, "# edited\n"+fs.Files[profile])
+
+		result, err := service.Restore(repoRoot, backupDir, "run1", false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(result.Restored) != 1 || result.Restored[0] != target || len(result.Skipped) != 1 {
+			t.Errorf("Unexpected result: %+v", result)
+		}
+		if fs.Files[target] != vendor || fs.Modes[target] != 0600 {
+			t.Errorf("Original content was not restored in place: %q %04o", fs.Files[target], fs.Modes[target])
+		}
+		if !strings.HasPrefix(fs.Files[profile], "# edited\n") {
+			t.Error("File edited after the block was injected was restored")
+		}
+		manifest, _ := service.LoadManifest()
+		if manifest.Repository(repoRoot).Link(target) != nil || manifest.Repository(repoRoot).Link(profile) == nil {
+			t.Errorf("Unexpected records after the restore: %+v", manifest.Repository(repoRoot).Links)
+		}
+	})
+
+	t.Run("Unlink removes a file that only held the block", func(t *testing.T) {
+		// Repository whose .bashrc is injected into the existing file
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "alias ll='ls -l'\n")
+		fs.AddFile(filepath.Join(repoRoot, InjectFileName), "# shells\n~/.bashrc\n")
+		fs.AddFile(target, vendor)
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		delete(fs.Files, target)
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if _, err := service.UnlinkDotfiles(repoRoot, userHome, ignoreFileName, false); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.FileExists(target) {
+			t.Error("Empty injected file was kept")
+		}
+	})
+
+	t.Run("Invalid pattern is an error", func(t *testing.T) {
+		// Repository whose .bashrc is injected into the existing file
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "alias ll='ls -l'\n")
+		fs.AddFile(filepath.Join(repoRoot, InjectFileName), "# shells\n~/.bashrc\n")
+		fs.AddFile(target, vendor)
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		fs.AddFile(filepath.Join(repoRoot, InjectFileName), "~/.bashrc\n.profile\n")
+
+		err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{})
+		if err == nil || !strings.Contains(err.Error(), "line 2") {
+			t.Fatalf("Expected an error on line 2, got %v", err)
+		}
+	})
+}
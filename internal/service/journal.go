@@ -0,0 +1,134 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+// journalKind identifies the kind of mutation recorded in a journal.
+type journalKind int
+
+const (
+	// journalCreated records a directory or link created by Apply.
+	journalCreated journalKind = iota
+	// journalStaged records an existing target moved aside before being deleted.
+	journalStaged
+	// journalBackedUp records an existing target moved into the backup directory.
+	journalBackedUp
+	// journalAttributes records a path whose mode or owner was changed.
+	journalAttributes
+	// journalRewritten records an existing file whose content was rewritten in place.
+	journalRewritten
+)
+
+// journalEntry records a single mutation so that it can be reversed.
+type journalEntry struct {
+	kind  journalKind
+	path  string     // Path that was created, or the original path of a moved target
+	moved string     // Where the target was moved to, for staged and backed up targets
+	attrs Attributes // Previous attributes of a path whose attributes were changed
+	data  []byte     // Previous content of a file rewritten in place
+}
+
+// journal records every mutation made while applying a plan, in order.
+type journal struct {
+	entries []journalEntry
+	opts    LinkOptions
+}
+
+// newJournal creates an empty journal for a run with the given options.
+func newJournal(opts LinkOptions) *journal {
+	return &journal{opts: opts}
+}
+
+// created records a path created by the run.
+func (j *journal) created(path string) {
+	j.entries = append(j.entries, journalEntry{kind: journalCreated, path: path})
+}
+
+// staged records a target moved aside, to be deleted on commit or moved back on rollback.
+func (j *journal) staged(path string, moved string) {
+	j.entries = append(j.entries, journalEntry{kind: journalStaged, path: path, moved: moved})
+}
+
+// backedUp records a target moved into the backup directory.
+func (j *journal) backedUp(path string, moved string) {
+	j.entries = append(j.entries, journalEntry{kind: journalBackedUp, path: path, moved: moved})
+}
+
+// attributesChanged records a path whose attributes were changed from previous.
+func (j *journal) attributesChanged(path string, previous Attributes) {
+	j.entries = append(j.entries, journalEntry{kind: journalAttributes, path: path, attrs: previous})
+}
+
+// rewritten records a file whose previous content was replaced in place.
+func (j *journal) rewritten(path string, previous []byte) {
+	j.entries = append(j.entries, journalEntry{kind: journalRewritten, path: path, data: previous})
+}
+
+// stageTarget moves an existing target aside to a sibling path in the same directory,
+// so the move is a cheap rename and the target can be put back if the run fails.
+func (s *FileLinkerService) stageTarget(target string, j *journal) error {
+	staged := filepath.Join(filepath.Dir(target), fmt.Sprintf(".%s.dotfileslinker-%s", filepath.Base(target), j.opts.RunID))
+	s.logger.Verbose(fmt.Sprintf("Deleting existing target: %s", target))
+	if err := s.fs.Move(target, staged); err != nil {
+		return fmt.Errorf("failed to delete existing target: %w", err)
+	}
+	j.staged(target, staged)
+	return nil
+}
+
+// commit finalizes a successful run by deleting the targets that were staged for deletion.
+// Failures are logged rather than returned because every link is already in place.
+func (s *FileLinkerService) commit(j *journal) {
+	for _, entry := range j.entries {
+		if entry.kind != journalStaged {
+			continue
+		}
+		if err := s.fs.DeleteAll(entry.moved); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to delete staged target %s: %s", entry.moved, err))
+		}
+	}
+}
+
+// rollback reverses every mutation in the journal, newest first.
+// It continues past individual failures and returns them joined.
+func (s *FileLinkerService) rollback(j *journal) error {
+	var errs []error
+	for i := len(j.entries) - 1; i >= 0; i-- {
+		entry := j.entries[i]
+		switch entry.kind {
+		case journalCreated:
+			s.logger.Verbose(fmt.Sprintf("Rollback: removing %s", entry.path))
+			if err := s.fs.Delete(entry.path); err != nil {
+				errs = append(errs, fmt.Errorf("failed to remove %s: %w", entry.path, err))
+			}
+		case journalStaged:
+			s.logger.Verbose(fmt.Sprintf("Rollback: restoring %s", entry.path))
+			if err := s.fs.Move(entry.moved, entry.path); err != nil {
+				errs = append(errs, fmt.Errorf("failed to restore %s from %s: %w", entry.path, entry.moved, err))
+			}
+		case journalBackedUp:
+			s.logger.Verbose(fmt.Sprintf("Rollback: restoring %s from backup", entry.path))
+			if err := s.fs.Move(entry.moved, entry.path); err != nil {
+				errs = append(errs, fmt.Errorf("failed to restore %s from %s: %w", entry.path, entry.moved, err))
+				continue
+			}
+			if err := s.unrecordBackup(entry.path, j.opts); err != nil {
+				errs = append(errs, err)
+			}
+		case journalAttributes:
+			s.logger.Verbose(fmt.Sprintf("Rollback: restoring %s on %s", entry.attrs, entry.path))
+			if err := s.applyAttributes(entry.path, entry.attrs); err != nil {
+				errs = append(errs, err)
+			}
+		case journalRewritten:
+			s.logger.Verbose(fmt.Sprintf("Rollback: restoring the content of %s", entry.path))
+			if err := s.fs.UpdateFile(entry.path, entry.data); err != nil {
+				errs = append(errs, fmt.Errorf("failed to restore %s: %w", entry.path, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,208 @@
+package service
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/guitarrapc/dotfileslinker-go/internal/infrastructure"
+)
+
+func TestFileLinkerService_ApplyRollback(t *testing.T) {
+	repoRoot := "/repo"
+	userHome := "/home/user"
+	ignoreFileName := ".ignore"
+	backupDir := "/backups"
+
+	// assertUntouched verifies the home directory is back to its state before the run
+	assertUntouched := func(t *testing.T, fs *infrastructure.MockFileSystem) {
+		t.Helper()
+		if len(fs.SymLinks) != 0 {
+			t.Errorf("Links were left behind: %v", fs.SymLinks)
+		}
+		if fs.Files[filepath.Join(userHome, ".vimrc")] != "# user vimrc" {
+			t.Error("Replaced target was not restored")
+		}
+		for _, dir := range []string{filepath.Join(userHome, ".config"), filepath.Join(userHome, ".config", "nvim")} {
+			if fs.DirectoryExists(dir) {
+				t.Errorf("Created directory was left behind: %s", dir)
+			}
+		}
+		for path := range fs.Files {
+			if strings.Contains(path, ".dotfileslinker-") {
+				t.Errorf("Staged target was left behind: %s", path)
+			}
+		}
+	}
+
+	t.Run("Overwrite is rolled back", func(t *testing.T) {
+		// Repository whose last link fails after a conflicting target was replaced
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# repo bashrc")
+		fs.AddFile(filepath.Join(repoRoot, ".vimrc"), "# repo vimrc")
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+		fs.AddFile(filepath.Join(repoRoot, "HOME", ".config", "nvim", "init.vim"), "# neovim config")
+
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{
+			filepath.Join(repoRoot, ".bashrc"),
+			filepath.Join(repoRoot, ".vimrc"),
+		})
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, []string{
+			filepath.Join(repoRoot, "HOME", ".config", "nvim", "init.vim"),
+		})
+
+		fs.AddFile(filepath.Join(userHome, ".vimrc"), "# user vimrc")
+		fs.SetErrorForOperation("CreateFileSymlink:"+filepath.Join(userHome, ".config", "nvim", "init.vim"), errTest)
+		service := NewFileLinkerService(fs, NewMockLogger())
+
+		if err := service.LinkDotfiles(repoRoot, userHome, ignoreFileName, true, false); err == nil {
+			t.Fatal("Expected error from the failing link")
+		}
+		assertUntouched(t, fs)
+	})
+
+	t.Run("Backup is rolled back", func(t *testing.T) {
+		// Repository whose last link fails after a conflicting target was replaced
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# repo bashrc")
+		fs.AddFile(filepath.Join(repoRoot, ".vimrc"), "# repo vimrc")
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+		fs.AddFile(filepath.Join(repoRoot, "HOME", ".config", "nvim", "init.vim"), "# neovim config")
+
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{
+			filepath.Join(repoRoot, ".bashrc"),
+			filepath.Join(repoRoot, ".vimrc"),
+		})
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, []string{
+			filepath.Join(repoRoot, "HOME", ".config", "nvim", "init.vim"),
+		})
+
+		fs.AddFile(filepath.Join(userHome, ".vimrc"), "# user vimrc")
+		fs.SetErrorForOperation("CreateFileSymlink:"+filepath.Join(userHome, ".config", "nvim", "init.vim"), errTest)
+		service := NewFileLinkerService(fs, NewMockLogger())
+
+		err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{
+			Conflict:  ConflictBackup,
+			BackupDir: backupDir,
+			RunID:     "run1",
+		})
+		if err == nil {
+			t.Fatal("Expected error from the failing link")
+		}
+		assertUntouched(t, fs)
+		if fs.FileExists(filepath.Join(backupDir, "run1", backupIndexFileName)) {
+			t.Error("Backup index was left behind")
+		}
+		if fs.DirectoryExists(filepath.Join(backupDir, "run1")) {
+			t.Error("Backup run directory was left behind")
+		}
+	})
+
+	t.Run("Block injected in place is rolled back", func(t *testing.T) {
+		for _, conflict := range []ConflictStrategy{ConflictOverwrite, ConflictBackup} {
+			// Repository whose last link fails after a conflicting target was replaced
+			fs := infrastructure.NewMockFileSystem()
+			fs.AddDirectory(userHome)
+			fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# repo bashrc")
+			fs.AddFile(filepath.Join(repoRoot, ".vimrc"), "# repo vimrc")
+			fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+			fs.AddFile(filepath.Join(repoRoot, "HOME", ".config", "nvim", "init.vim"), "# neovim config")
+
+			fs.SetupFileEnumeration(repoRoot, ".*", false, []string{
+				filepath.Join(repoRoot, ".bashrc"),
+				filepath.Join(repoRoot, ".vimrc"),
+			})
+			fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, []string{
+				filepath.Join(repoRoot, "HOME", ".config", "nvim", "init.vim"),
+			})
+
+			fs.AddFile(filepath.Join(userHome, ".vimrc"), "# user vimrc")
+			fs.SetErrorForOperation("CreateFileSymlink:"+filepath.Join(userHome, ".config", "nvim", "init.vim"), errTest)
+			fs.AddFile(filepath.Join(repoRoot, InjectFileName), "~/.vimrc\n")
+			fs.Modes[filepath.Join(userHome, ".vimrc")] = 0600
+			service := NewFileLinkerService(fs, NewMockLogger())
+
+			err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{
+				Conflict:  conflict,
+				BackupDir: backupDir,
+				RunID:     "run1",
+			})
+			if err == nil {
+				t.Fatal("Expected error from the failing link")
+			}
+			assertUntouched(t, fs)
+			if fs.Modes[filepath.Join(userHome, ".vimrc")] != 0600 {
+				t.Errorf("Strategy %d: mode of the injected target was not kept", conflict)
+			}
+		}
+	})
+
+	t.Run("Incomplete rollback is reported", func(t *testing.T) {
+		// Repository whose last link fails after a conflicting target was replaced
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# repo bashrc")
+		fs.AddFile(filepath.Join(repoRoot, ".vimrc"), "# repo vimrc")
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+		fs.AddFile(filepath.Join(repoRoot, "HOME", ".config", "nvim", "init.vim"), "# neovim config")
+
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{
+			filepath.Join(repoRoot, ".bashrc"),
+			filepath.Join(repoRoot, ".vimrc"),
+		})
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, []string{
+			filepath.Join(repoRoot, "HOME", ".config", "nvim", "init.vim"),
+		})
+
+		fs.AddFile(filepath.Join(userHome, ".vimrc"), "# user vimrc")
+		fs.SetErrorForOperation("CreateFileSymlink:"+filepath.Join(userHome, ".config", "nvim", "init.vim"), errTest)
+		service := NewFileLinkerService(fs, NewMockLogger())
+		fs.SetErrorForOperation("Delete:"+filepath.Join(userHome, ".bashrc"), errTest)
+
+		err := service.LinkDotfiles(repoRoot, userHome, ignoreFileName, true, false)
+		if err == nil || !strings.Contains(err.Error(), "rollback incomplete") {
+			t.Fatalf("Expected incomplete rollback error, got %v", err)
+		}
+		// Everything else is still reversed
+		if fs.Files[filepath.Join(userHome, ".vimrc")] != "# user vimrc" {
+			t.Error("Replaced target was not restored")
+		}
+	})
+
+	t.Run("Successful run discards staged targets", func(t *testing.T) {
+		// Repository whose last link fails after a conflicting target was replaced
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# repo bashrc")
+		fs.AddFile(filepath.Join(repoRoot, ".vimrc"), "# repo vimrc")
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+		fs.AddFile(filepath.Join(repoRoot, "HOME", ".config", "nvim", "init.vim"), "# neovim config")
+
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{
+			filepath.Join(repoRoot, ".bashrc"),
+			filepath.Join(repoRoot, ".vimrc"),
+		})
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, []string{
+			filepath.Join(repoRoot, "HOME", ".config", "nvim", "init.vim"),
+		})
+
+		fs.AddFile(filepath.Join(userHome, ".vimrc"), "# user vimrc")
+		fs.SetErrorForOperation("CreateFileSymlink:"+filepath.Join(userHome, ".config", "nvim", "init.vim"), errTest)
+		service := NewFileLinkerService(fs, NewMockLogger())
+		delete(fs.ErrorResponses, "CreateFileSymlink:"+filepath.Join(userHome, ".config", "nvim", "init.vim"))
+
+		if err := service.LinkDotfiles(repoRoot, userHome, ignoreFileName, true, false); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for path := range fs.Files {
+			if strings.Contains(path, ".dotfileslinker-") {
+				t.Errorf("Staged target was not deleted: %s", path)
+			}
+		}
+		if fs.GetLinkTarget(filepath.Join(userHome, ".vimrc")) != filepath.Join(repoRoot, ".vimrc") {
+			t.Error("Target was not replaced")
+		}
+	})
+}
@@ -0,0 +1,320 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/guitarrapc/dotfileslinker-go/internal/util"
+)
+
+// manifestVersion is the current format version of the manifest file.
+const manifestVersion = 1
+
+// LinkKind identifies how a managed target was created.
+type LinkKind string
+
+const (
+	// LinkKindFileSymlink is a symbolic link to a file.
+	LinkKindFileSymlink LinkKind = "file-symlink"
+	// LinkKindDirectorySymlink is a symbolic link to a directory.
+	LinkKindDirectorySymlink LinkKind = "directory-symlink"
+	// LinkKindCopy is a copy of a file; its hash is recorded to detect later changes.
+	LinkKindCopy LinkKind = "copy"
+	// LinkKindHardlink is a hard link to a file.
+	LinkKindHardlink LinkKind = "hardlink"
+	// LinkKindTemplate is a file rendered from a template; its hash is recorded to detect later changes.
+	LinkKindTemplate LinkKind = "template"
+	// LinkKindEncrypted is a file decrypted from an encrypted source; its hash is recorded to detect later changes.
+	LinkKindEncrypted LinkKind = "encrypted"
+	// LinkKindInjected is a regular file that holds the source in a managed block; the hash of the block is recorded.
+	LinkKindInjected LinkKind = "injected"
+	// LinkKindIncluded is a regular file that references the source with an include directive of its format.
+	LinkKindIncluded LinkKind = "included"
+)
+
+// hashed reports whether the content of targets of this kind is hashed when they are written.
+func (k LinkKind) hashed() bool {
+	return k == LinkKindCopy || k == LinkKindTemplate || k == LinkKindEncrypted
+}
+
+// rewrittenInPlace reports whether targets of this kind are files of the user that the tool edits in place.
+func (k LinkKind) rewrittenInPlace() bool {
+	return k == LinkKindInjected || k == LinkKindIncluded
+}
+
+// Manifest records the targets created by the tool so that later runs know which ones they own.
+// It is stored as JSON and keyed by repository root.
+type Manifest struct {
+	Version      int                         `json:"version"`
+	Repositories map[string]*RepositoryState `json:"repositories"`
+}
+
+// RepositoryState records the targets created from a single repository.
+type RepositoryState struct {
+	Links       []ManifestLink `json:"links"`
+	Directories []string       `json:"directories,omitempty"` // Directories created to hold targets
+}
+
+// ManifestLink records a single managed target.
+type ManifestLink struct {
+	Target    string    `json:"target"`
+	Source    string    `json:"source"`
+	Kind      LinkKind  `json:"kind"`
+	CreatedAt time.Time `json:"createdAt"`
+	RunID     string    `json:"runId"`
+	Hash      string    `json:"hash,omitempty"`   // SHA-256 of the content when written; only set for copies, rendered templates, decrypted files and managed blocks
+	Format    string    `json:"format,omitempty"` // Format of the include directive; only set for included files
+}
+
+// SetManifestPath sets the file used to persist created links between runs.
+// An empty path disables the manifest.
+func (s *FileLinkerService) SetManifestPath(path string) {
+	s.manifestPath = path
+}
+
+// LoadManifest reads the manifest, returning an empty manifest when none exists yet.
+func (s *FileLinkerService) LoadManifest() (*Manifest, error) {
+	manifest := &Manifest{Version: manifestVersion, Repositories: make(map[string]*RepositoryState)}
+	if s.manifestPath == "" || !s.fs.FileExists(s.manifestPath) {
+		return manifest, nil
+	}
+
+	data, err := s.fs.ReadFile(s.manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest %s: %w", s.manifestPath, err)
+	}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", s.manifestPath, err)
+	}
+	if manifest.Version > manifestVersion {
+		return nil, fmt.Errorf("manifest %s has unsupported version %d", s.manifestPath, manifest.Version)
+	}
+	if manifest.Repositories == nil {
+		manifest.Repositories = make(map[string]*RepositoryState)
+	}
+	return manifest, nil
+}
+
+// saveManifest atomically writes the manifest.
+func (s *FileLinkerService) saveManifest(manifest *Manifest) error {
+	if s.manifestPath == "" {
+		return nil
+	}
+
+	manifest.Version = manifestVersion
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	if err := s.fs.EnsureDirectory(filepath.Dir(s.manifestPath)); err != nil {
+		return fmt.Errorf("failed to create manifest directory: %w", err)
+	}
+	if err := s.fs.WriteFile(s.manifestPath, append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write manifest %s: %w", s.manifestPath, err)
+	}
+	s.logger.Verbose(fmt.Sprintf("Updated manifest: %s", s.manifestPath))
+	return nil
+}
+
+// Repository returns the recorded state of a repository, or nil when nothing is recorded.
+func (m *Manifest) Repository(repoRoot string) *RepositoryState {
+	return m.Repositories[manifestKey(repoRoot)]
+}
+
+// repository returns the recorded state of a repository, creating it when missing.
+func (m *Manifest) repository(repoRoot string) *RepositoryState {
+	key := manifestKey(repoRoot)
+	state, exists := m.Repositories[key]
+	if !exists {
+		state = &RepositoryState{}
+		m.Repositories[key] = state
+	}
+	return state
+}
+
+// relocate moves the recorded state of a repository from oldRoot to newRoot, pointing the recorded sources
+// into newRoot. State already recorded for newRoot is kept, and takes precedence for targets recorded by both.
+func (m *Manifest) relocate(oldRoot string, newRoot string) {
+	oldKey := manifestKey(oldRoot)
+	old, exists := m.Repositories[oldKey]
+	if !exists {
+		return
+	}
+	delete(m.Repositories, oldKey)
+
+	state := m.repository(newRoot)
+	for _, link := range old.Links {
+		if state.Link(link.Target) != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(oldKey, link.Source); err == nil && util.IsSubPath(link.Source, oldKey) {
+			link.Source = filepath.Join(manifestKey(newRoot), rel)
+		}
+		state.upsertLink(link)
+	}
+	for _, dir := range old.Directories {
+		state.addDirectory(dir)
+	}
+}
+
+// Link returns the recorded link for a target, or nil when the target is not managed.
+func (r *RepositoryState) Link(target string) *ManifestLink {
+	for i := range r.Links {
+		if util.PathEquals(r.Links[i].Target, target) {
+			return &r.Links[i]
+		}
+	}
+	return nil
+}
+
+// findLink returns the record of a target and the repository state holding it, searching every repository.
+// When several repositories record the target, the most recently created record wins.
+func (m *Manifest) findLink(target string) (*RepositoryState, *ManifestLink) {
+	var found *RepositoryState
+	var record *ManifestLink
+	for _, state := range m.Repositories {
+		if link := state.Link(target); link != nil && (record == nil || link.CreatedAt.After(record.CreatedAt)) {
+			found, record = state, link
+		}
+	}
+	return found, record
+}
+
+// upsertLink records a link, replacing any existing record for the same target.
+func (r *RepositoryState) upsertLink(link ManifestLink) {
+	if existing := r.Link(link.Target); existing != nil {
+		*existing = link
+		return
+	}
+	r.Links = append(r.Links, link)
+	sort.Slice(r.Links, func(i, j int) bool { return r.Links[i].Target < r.Links[j].Target })
+}
+
+// removeLink forgets the record of a target.
+func (r *RepositoryState) removeLink(target string) {
+	r.Links = slices.DeleteFunc(r.Links, func(link ManifestLink) bool {
+		return util.PathEquals(link.Target, target)
+	})
+}
+
+// addDirectory records a directory created to hold targets.
+func (r *RepositoryState) addDirectory(dir string) {
+	if !slices.Contains(r.Directories, dir) {
+		r.Directories = append(r.Directories, dir)
+		sort.Strings(r.Directories)
+	}
+}
+
+// removeDirectory forgets a recorded directory.
+func (r *RepositoryState) removeDirectory(dir string) {
+	r.Directories = slices.DeleteFunc(r.Directories, func(recorded string) bool { return recorded == dir })
+}
+
+// manifestKey normalizes a repository root for use as a manifest key.
+func manifestKey(repoRoot string) string {
+	abs, err := filepath.Abs(repoRoot)
+	if err != nil {
+		return filepath.Clean(repoRoot)
+	}
+	return abs
+}
+
+// recordPlan stores the targets created or confirmed by an applied plan in the manifest.
+// Links that were already recorded keep their original creation time and run.
+func (s *FileLinkerService) recordPlan(plan *Plan) error {
+	if s.manifestPath == "" {
+		return nil
+	}
+
+	manifest, err := s.LoadManifest()
+	if err != nil {
+		return err
+	}
+
+	state := manifest.repository(plan.RepoRoot)
+	now := s.now().UTC()
+	for _, action := range plan.Actions {
+		switch action.Kind {
+		case ActionMkdir:
+			state.addDirectory(action.Target)
+		case ActionUnfold:
+			state.removeLink(action.Target)
+			state.addDirectory(action.Target)
+		case ActionLink, ActionReplace:
+			link, err := s.newManifestLink(action, plan.Options.RunID, now)
+			if err != nil {
+				return err
+			}
+			state.upsertLink(link)
+		case ActionSkip:
+			if existing := state.Link(action.Target); existing == nil || !util.PathEquals(existing.Source, action.Source) || existing.Kind != manifestLinkKind(action) {
+				link, err := s.newManifestLink(action, plan.Options.RunID, now)
+				if err != nil {
+					return err
+				}
+				state.upsertLink(link)
+			}
+		}
+	}
+
+	return s.saveManifest(manifest)
+}
+
+// newManifestLink creates the record of the target of an applied action.
+// Copies, rendered templates and decrypted files are hashed after they were written, so the record matches the content on disk.
+func (s *FileLinkerService) newManifestLink(action Action, runID string, now time.Time) (ManifestLink, error) {
+	link := ManifestLink{
+		Target:    action.Target,
+		Source:    action.Source,
+		Kind:      manifestLinkKind(action),
+		CreatedAt: now,
+		RunID:     runID,
+		Format:    action.Include,
+	}
+	if link.Kind.hashed() {
+		hash, err := s.fs.FileHash(action.Target)
+		if err != nil {
+			return link, fmt.Errorf("failed to hash %s: %w", action.Target, err)
+		}
+		link.Hash = hash
+	}
+	if link.Kind == LinkKindInjected {
+		hash, err := s.blockHash(action.Target)
+		if err != nil {
+			return link, err
+		}
+		link.Hash = hash
+	}
+	return link, nil
+}
+
+// manifestLinkKind returns the kind recorded for the target of an action.
+func manifestLinkKind(action Action) LinkKind {
+	if action.Injected {
+		return LinkKindInjected
+	}
+	if action.Include != "" {
+		return LinkKindIncluded
+	}
+	if action.Encrypted {
+		return LinkKindEncrypted
+	}
+	if action.Template {
+		return LinkKindTemplate
+	}
+	switch action.Mode {
+	case ModeCopy:
+		return LinkKindCopy
+	case ModeHardlink:
+		return LinkKindHardlink
+	}
+	if action.IsDir {
+		return LinkKindDirectorySymlink
+	}
+	return LinkKindFileSymlink
+}
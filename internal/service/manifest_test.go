@@ -0,0 +1,216 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/guitarrapc/dotfileslinker-go/internal/infrastructure"
+)
+
+func TestFileLinkerService_Manifest(t *testing.T) {
+	repoRoot := "/repo"
+	userHome := "/home/user"
+	ignoreFileName := ".ignore"
+	manifestPath := "/state/dotfileslinker/manifest.json"
+
+	t.Run("Records created links and directories", func(t *testing.T) {
+		// Repository with one root dotfile and one nested HOME file
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# bashrc")
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+		fs.AddFile(filepath.Join(repoRoot, "HOME", ".config", "nvim", "init.vim"), "# neovim config")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{filepath.Join(repoRoot, ".bashrc")})
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, []string{
+			filepath.Join(repoRoot, "HOME", ".config", "nvim", "init.vim"),
+		})
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		service.now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+		if err := service.LinkDotfiles(repoRoot, userHome, ignoreFileName, false, false); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		manifest, err := service.LoadManifest()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		state := manifest.Repository(repoRoot)
+		if state == nil {
+			t.Fatal("Repository was not recorded")
+		}
+		if len(state.Links) != 2 {
+			t.Fatalf("Expected 2 recorded links, got %+v", state.Links)
+		}
+
+		link := state.Link(filepath.Join(userHome, ".bashrc"))
+		if link == nil {
+			t.Fatal(".bashrc was not recorded")
+		}
+		if link.Source != filepath.Join(repoRoot, ".bashrc") || link.Kind != LinkKindFileSymlink || link.RunID != "20240102-030405.000000" {
+			t.Errorf("Unexpected record: %+v", link)
+		}
+		if len(state.Directories) != 2 {
+			t.Errorf("Expected 2 recorded directories, got %v", state.Directories)
+		}
+		if !fs.FileExists(manifestPath) {
+			t.Error("Manifest was not written")
+		}
+	})
+
+	t.Run("Keeps the original record of links that were already in place", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# bashrc")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{filepath.Join(repoRoot, ".bashrc")})
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		service.now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+		if err := service.LinkDotfiles(repoRoot, userHome, ignoreFileName, false, false); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		service.now = func() time.Time { return time.Date(2025, 6, 7, 8, 9, 10, 0, time.UTC) }
+		if err := service.LinkDotfiles(repoRoot, userHome, ignoreFileName, false, false); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		manifest, err := service.LoadManifest()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		link := manifest.Repository(repoRoot).Link(filepath.Join(userHome, ".bashrc"))
+		if link == nil || link.RunID != "20240102-030405.000000" {
+			t.Errorf("Expected the first run to be kept, got %+v", link)
+		}
+	})
+
+	t.Run("Dry run does not write the manifest", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# bashrc")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{filepath.Join(repoRoot, ".bashrc")})
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+
+		if err := service.LinkDotfiles(repoRoot, userHome, ignoreFileName, false, true); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.FileExists(manifestPath) {
+			t.Error("Manifest was written in dry run mode")
+		}
+	})
+
+	t.Run("Unlink removes recorded links and empty directories", func(t *testing.T) {
+		// Repository with one root dotfile and one nested HOME file
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# bashrc")
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+		fs.AddFile(filepath.Join(repoRoot, "HOME", ".config", "nvim", "init.vim"), "# neovim config")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{filepath.Join(repoRoot, ".bashrc")})
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, []string{
+			filepath.Join(repoRoot, "HOME", ".config", "nvim", "init.vim"),
+		})
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		service.now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+		if err := service.LinkDotfiles(repoRoot, userHome, ignoreFileName, false, false); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		result, err := service.UnlinkDotfiles(repoRoot, userHome, ignoreFileName, false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(result.Removed) != 2 {
+			t.Errorf("Expected 2 removed links, got %v", result.Removed)
+		}
+		if fs.DirectoryExists(filepath.Join(userHome, ".config")) {
+			t.Error("Created directory was not removed")
+		}
+		if !fs.DirectoryExists(userHome) {
+			t.Error("Home directory was removed")
+		}
+
+		manifest, err := service.LoadManifest()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		state := manifest.Repository(repoRoot)
+		if len(state.Links) != 0 || len(state.Directories) != 0 {
+			t.Errorf("Expected an empty record, got %+v", state)
+		}
+	})
+
+	t.Run("Unlink keeps created directories that are not empty", func(t *testing.T) {
+		// Repository with one root dotfile and one nested HOME file
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# bashrc")
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+		fs.AddFile(filepath.Join(repoRoot, "HOME", ".config", "nvim", "init.vim"), "# neovim config")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{filepath.Join(repoRoot, ".bashrc")})
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, []string{
+			filepath.Join(repoRoot, "HOME", ".config", "nvim", "init.vim"),
+		})
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		service.now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+		if err := service.LinkDotfiles(repoRoot, userHome, ignoreFileName, false, false); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		fs.AddFile(filepath.Join(userHome, ".config", "other.conf"), "# user file")
+
+		if _, err := service.UnlinkDotfiles(repoRoot, userHome, ignoreFileName, false); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !fs.DirectoryExists(filepath.Join(userHome, ".config")) {
+			t.Error("Directory with user content was removed")
+		}
+		if fs.DirectoryExists(filepath.Join(userHome, ".config", "nvim")) {
+			t.Error("Empty created directory was not removed")
+		}
+
+		manifest, err := service.LoadManifest()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		dirs := manifest.Repository(repoRoot).Directories
+		if len(dirs) != 1 || dirs[0] != filepath.Join(userHome, ".config") {
+			t.Errorf("Expected the kept directory to stay recorded, got %v", dirs)
+		}
+	})
+
+	t.Run("Failing to write the manifest is reported", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# bashrc")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{filepath.Join(repoRoot, ".bashrc")})
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		fs.SetErrorForOperation("WriteFile:"+manifestPath, errTest)
+
+		if err := service.LinkDotfiles(repoRoot, userHome, ignoreFileName, false, false); err == nil {
+			t.Fatal("Expected error when the manifest cannot be written")
+		}
+		if fs.GetLinkTarget(filepath.Join(userHome, ".bashrc")) == "" {
+			t.Error("Links should stay in place when only the manifest fails")
+		}
+	})
+
+	t.Run("Rejects a manifest from a newer version", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		fs.AddFile(manifestPath, `{"version": 99, "repositories": {}}`)
+
+		if _, err := service.LoadManifest(); err == nil {
+			t.Fatal("Expected error for an unsupported manifest version")
+		}
+	})
+}
@@ -0,0 +1,272 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// MappingsFileName is the name of the file in the repository root that maps more repository directories
+// to destinations, in addition to HOME and ROOT. Each line holds a directory, a destination and options:
+//
+//	XDG_CONFIG  ${XDG_CONFIG_HOME:-~/.config}
+//	LOCAL_BIN   ~/.local/bin
+//	TOOLS       /opt/tools  os=linux,darwin  recursive=n
+//
+// A line for HOME or ROOT replaces the built-in mapping of that directory.
+const MappingsFileName = "dotfiles_mappings"
+
+// directoryMapping maps a directory in the repository to a destination on the machine.
+type directoryMapping struct {
+	source      string   // Directory in the repository root, such as "HOME"
+	destination string   // Destination; may start with ~ and contain $VAR, ${VAR} and ${VAR:-default}
+	systems     []string // OS the mapping applies to, or excluded with a leading '!'; empty applies everywhere
+	recursive   bool     // Whether files in subdirectories are linked too, rather than only the files directly in the directory
+}
+
+// defaultMappings are the mappings of every repository, in processing order.
+var defaultMappings = []directoryMapping{
+	{source: "HOME", destination: "~", recursive: true},
+	{source: "ROOT", destination: "/", systems: []string{"!windows"}, recursive: true},
+}
+
+// appliesTo reports whether the mapping is processed on goos.
+func (m directoryMapping) appliesTo(goos string) bool {
+	included := true
+	for _, system := range m.systems {
+		if excluded, negated := strings.CutPrefix(system, "!"); negated {
+			if strings.EqualFold(excluded, goos) {
+				return false
+			}
+			continue
+		}
+		included = false
+		if strings.EqualFold(system, goos) {
+			return true
+		}
+	}
+	return included
+}
+
+// loadMappings returns the mappings processed on this machine: the built-in mappings, replaced or extended by the
+// mappings file of the repository. Destinations are expanded to absolute paths.
+func (s *FileLinkerService) loadMappings(repoRoot string, userHome string) ([]directoryMapping, error) {
+	mappings := append([]directoryMapping(nil), defaultMappings...)
+
+	path := filepath.Join(repoRoot, MappingsFileName)
+	if s.fs.FileExists(path) {
+		lines, err := s.fs.ReadAllLines(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		configured, err := parseMappings(lines)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", path, err)
+		}
+		for _, mapping := range configured {
+			replaced := false
+			for i := range mappings {
+				if mappings[i].source == mapping.source {
+					mappings[i], replaced = mapping, true
+				}
+			}
+			if !replaced {
+				mappings = append(mappings, mapping)
+			}
+		}
+	}
+
+	goos := s.host().OS
+	result := make([]directoryMapping, 0, len(mappings))
+	for _, mapping := range mappings {
+		if !mapping.appliesTo(goos) {
+			s.logger.Info(fmt.Sprintf("Skipping %s directory processing on %s", mapping.source, goos))
+			continue
+		}
+		destination, err := s.expandDestination(mapping.destination, userHome)
+		if err != nil {
+			return nil, fmt.Errorf("invalid destination of %s: %w", mapping.source, err)
+		}
+		mapping.destination = destination
+		result = append(result, mapping)
+	}
+	return result, nil
+}
+
+// parseMappings parses the lines of a mappings file. Blank lines and lines starting with '#' are skipped.
+func parseMappings(lines []string) ([]directoryMapping, error) {
+	var mappings []directoryMapping
+	seen := make(map[string]bool)
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected a directory and a destination", i+1)
+		}
+
+		mapping := directoryMapping{source: fields[0], destination: fields[1], recursive: true}
+		if err := validateMappingSource(mapping.source); err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		if seen[mapping.source] {
+			return nil, fmt.Errorf("line %d: %s is mapped twice", i+1, mapping.source)
+		}
+		seen[mapping.source] = true
+
+		for _, option := range fields[2:] {
+			name, value, found := strings.Cut(option, "=")
+			if !found || value == "" {
+				return nil, fmt.Errorf("line %d: expected name=value, got %q", i+1, option)
+			}
+			switch name {
+			case "os":
+				mapping.systems = strings.Split(value, ",")
+			case "recursive":
+				switch strings.ToLower(value) {
+				case "y", "yes", "true":
+					mapping.recursive = true
+				case "n", "no", "false":
+					mapping.recursive = false
+				default:
+					return nil, fmt.Errorf("line %d: invalid value %q for recursive, expected y or n", i+1, value)
+				}
+			default:
+				return nil, fmt.Errorf("line %d: unknown option %q", i+1, name)
+			}
+		}
+		mappings = append(mappings, mapping)
+	}
+	return mappings, nil
+}
+
+// validateMappingSource checks that a mapped directory is a plain directory name in the repository root
+// that is not one of the directories holding overlays.
+func validateMappingSource(source string) error {
+	switch {
+	case source == "." || source == ".." || strings.ContainsAny(source, `/\`):
+		return fmt.Errorf("directory %q must be a name in the repository root", source)
+	case strings.HasPrefix(source, "."):
+		return fmt.Errorf("directory %q must not start with '.', since dotfiles in the repository root are linked to the home directory", source)
+	case source == HostDirName || source == ProfilesDirName || strings.Contains(source, alternateSeparator):
+		return fmt.Errorf("directory %q is reserved", source)
+	}
+	return nil
+}
+
+// expandDestination expands ~ and environment variables in a destination and checks that the result is absolute.
+// ${VAR:-default} uses default when VAR is unset or empty; other unset variables are an error.
+func (s *FileLinkerService) expandDestination(destination string, userHome string) (string, error) {
+	env := make(map[string]string)
+	for _, entry := range s.environ() {
+		if name, value, found := strings.Cut(entry, "="); found && name != "" {
+			env[name] = value
+		}
+	}
+
+	expanded, err := expandVariables(destination, env, userHome)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(expanded) && !strings.HasPrefix(expanded, "/") {
+		return "", fmt.Errorf("%q does not expand to an absolute path: %q", destination, expanded)
+	}
+	return filepath.Clean(expanded), nil
+}
+
+// expandVariables expands a leading ~ and the $VAR, ${VAR} and ${VAR:-default} references of value.
+// Defaults are expanded too, so "${XDG_CONFIG_HOME:-~/.config}" works.
+func expandVariables(value string, env map[string]string, userHome string) (string, error) {
+	if value == "~" || strings.HasPrefix(value, "~/") {
+		value = userHome + value[1:]
+	}
+
+	var result strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '$' || i+1 == len(value) {
+			result.WriteByte(value[i])
+			continue
+		}
+
+		var name, fallback string
+		hasFallback := false
+		if value[i+1] == '{' {
+			end := strings.IndexByte(value[i:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated variable reference in %q", value)
+			}
+			name = value[i+2 : i+end]
+			name, fallback, hasFallback = strings.Cut(name, ":-")
+			i += end
+		} else {
+			end := i + 1
+			for end < len(value) && isVariableByte(value[end]) {
+				end++
+			}
+			name = value[i+1 : end]
+			i = end - 1
+		}
+		if name == "" {
+			return "", fmt.Errorf("empty variable reference in %q", value)
+		}
+
+		switch resolved, set := env[name]; {
+		case set && resolved != "":
+			result.WriteString(resolved)
+		case hasFallback:
+			expanded, err := expandVariables(fallback, env, userHome)
+			if err != nil {
+				return "", err
+			}
+			result.WriteString(expanded)
+		default:
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+	}
+	return result.String(), nil
+}
+
+// collectMappings collects the files of every mapped directory and its overlays, in the order of the mappings.
+func (s *FileLinkerService) collectMappings(repoRoot string, userHome string, userIgnore map[string]bool) ([]linkEntry, error) {
+	mappings, err := s.loadMappings(repoRoot, userHome)
+	if err != nil {
+		return nil, err
+	}
+	var entries []linkEntry
+	for _, mapping := range mappings {
+		mapped, err := s.collectLayers(repoRoot, mapping, userIgnore)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, mapped...)
+	}
+	return entries, nil
+}
+
+// checkDuplicateTargets returns an error naming both sources when two entries link to the same target,
+// such as HOME/.config/nvim/init.vim and XDG_CONFIG/nvim/init.vim with XDG_CONFIG mapped to ~/.config.
+// Alternates are resolved and overlays merged before, so such entries come from different mappings.
+// Targets are compared case-insensitively when goos is windows.
+func checkDuplicateTargets(entries []linkEntry, goos string) error {
+	sources := make(map[string]string)
+	for _, entry := range entries {
+		if entry.ignored {
+			continue
+		}
+		key := filepath.Clean(entry.target)
+		if goos == "windows" {
+			key = strings.ToLower(key)
+		}
+		if source, exists := sources[key]; exists {
+			return fmt.Errorf("%s and %s are both linked to %s; remove one of them or change its mapping", source, entry.source, entry.target)
+		}
+		sources[key] = entry.source
+	}
+	return nil
+}
+
+// isVariableByte reports whether c can be part of an environment variable name.
+func isVariableByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
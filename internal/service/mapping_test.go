@@ -0,0 +1,367 @@
+package service
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/guitarrapc/dotfileslinker-go/internal/infrastructure"
+)
+
+func TestParseMappings(t *testing.T) {
+	t.Run("Valid lines", func(t *testing.T) {
+		mappings, err := parseMappings([]string{
+			"# comment",
+			"",
+			"XDG_CONFIG ${XDG_CONFIG_HOME:-~/.config}",
+			"TOOLS /opt/tools os=linux,darwin recursive=n",
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := []directoryMapping{
+			{source: "XDG_CONFIG", destination: "${XDG_CONFIG_HOME:-~/.config}", recursive: true},
+			{source: "TOOLS", destination: "/opt/tools", systems: []string{"linux", "darwin"}, recursive: false},
+		}
+		if !reflect.DeepEqual(mappings, expected) {
+			t.Errorf("Expected %+v, got %+v", expected, mappings)
+		}
+	})
+
+	tests := map[string]string{
+		"missing destination": "TOOLS",
+		"nested directory":    "opt/tools /opt/tools",
+		"dot directory":       ".config ~/.config",
+		"reserved directory":  "HOST /etc",
+		"unknown option":      "TOOLS /opt/tools mode=0755",
+		"invalid recursive":   "TOOLS /opt/tools recursive=maybe",
+	}
+	for name, line := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseMappings([]string{line}); err == nil {
+				t.Errorf("Expected an error for %q", line)
+			}
+		})
+	}
+
+	t.Run("Duplicate directory", func(t *testing.T) {
+		if _, err := parseMappings([]string{"TOOLS /opt/a", "TOOLS /opt/b"}); err == nil {
+			t.Error("Expected an error for a directory mapped twice")
+		}
+	})
+}
+
+func TestExpandVariables(t *testing.T) {
+	env := map[string]string{"XDG_CONFIG_HOME": "/xdg", "EMPTY": ""}
+
+	tests := map[string]string{
+		"~":                             "/home/user",
+		"~/.local/bin":                  "/home/user/.local/bin",
+		"$XDG_CONFIG_HOME/nvim":         "/xdg/nvim",
+		"${XDG_CONFIG_HOME}":            "/xdg",
+		"${EMPTY:-~/.config}":           "/home/user/.config",
+		"${XDG_DATA_HOME:-/data}/tools": "/data/tools",
+	}
+	for value, expected := range tests {
+		t.Run(value, func(t *testing.T) {
+			expanded, err := expandVariables(value, env, "/home/user")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if expanded != expected {
+				t.Errorf("Expected %q, got %q", expected, expanded)
+			}
+		})
+	}
+
+	for _, value := range []string{"$XDG_DATA_HOME/tools", "${XDG_CONFIG_HOME", "${}"} {
+		t.Run("Error "+value, func(t *testing.T) {
+			if _, err := expandVariables(value, env, "/home/user"); err == nil {
+				t.Errorf("Expected an error for %q", value)
+			}
+		})
+	}
+}
+
+func TestFileLinkerService_Mappings(t *testing.T) {
+	repoRoot := "/repo"
+	userHome := "/home/user"
+	ignoreFileName := ".ignore"
+	mappingsPath := filepath.Join(repoRoot, MappingsFileName)
+
+	t.Run("Mapped directories are linked to their expanded destinations", func(t *testing.T) {
+		// Repository with HOME, XDG_CONFIG, LOCAL_BIN and TOOLS directories on a Linux machine
+		// whose XDG_CONFIG_HOME is /xdg
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory("/xdg")
+		layers := map[string][]string{
+			"HOME":       {".bashrc"},
+			"XDG_CONFIG": {"nvim/init.vim"},
+			"LOCAL_BIN":  {"backup"},
+			"TOOLS":      {"run.sh"},
+		}
+		for dir, files := range layers {
+			fs.AddDirectory(filepath.Join(repoRoot, dir))
+			var paths []string
+			for _, file := range files {
+				path := filepath.Join(repoRoot, dir, file)
+				fs.AddFile(path, "# "+dir)
+				paths = append(paths, path)
+			}
+			fs.SetupFileEnumeration(filepath.Join(repoRoot, dir), "*", true, paths)
+		}
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "TOOLS"), "*", false, []string{filepath.Join(repoRoot, "TOOLS", "run.sh")})
+		fs.AddFile(mappingsPath, "XDG_CONFIG ${XDG_CONFIG_HOME:-~/.config}\nLOCAL_BIN ~/.local/bin\nTOOLS /opt/tools os=linux recursive=n\n")
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.host = func() HostInfo { return HostInfo{OS: "linux"} }
+		service.environ = func() []string { return []string{"XDG_CONFIG_HOME=/xdg"} }
+
+		expected := map[string]string{
+			filepath.Join(userHome, ".bashrc"):                 filepath.Join(repoRoot, "HOME", ".bashrc"),
+			filepath.Join("/xdg", "nvim", "init.vim"):          filepath.Join(repoRoot, "XDG_CONFIG", "nvim", "init.vim"),
+			filepath.Join(userHome, ".local", "bin", "backup"): filepath.Join(repoRoot, "LOCAL_BIN", "backup"),
+			filepath.Join("/opt", "tools", "run.sh"):           filepath.Join(repoRoot, "TOOLS", "run.sh"),
+		}
+		plan, err := service.Plan(repoRoot, userHome, ignoreFileName, LinkOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		actual := make(map[string]string)
+		for _, action := range plan.Actions {
+			if action.Kind == ActionLink {
+				actual[action.Target] = action.Source
+			}
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Expected %v, got %v", expected, actual)
+		}
+	})
+
+	t.Run("Mappings for other OS are skipped", func(t *testing.T) {
+		// Repository with HOME, XDG_CONFIG, LOCAL_BIN and TOOLS directories on a Linux machine
+		// whose XDG_CONFIG_HOME is /xdg
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory("/xdg")
+		layers := map[string][]string{
+			"HOME":       {".bashrc"},
+			"XDG_CONFIG": {"nvim/init.vim"},
+			"LOCAL_BIN":  {"backup"},
+			"TOOLS":      {"run.sh"},
+		}
+		for dir, files := range layers {
+			fs.AddDirectory(filepath.Join(repoRoot, dir))
+			var paths []string
+			for _, file := range files {
+				path := filepath.Join(repoRoot, dir, file)
+				fs.AddFile(path, "# "+dir)
+				paths = append(paths, path)
+			}
+			fs.SetupFileEnumeration(filepath.Join(repoRoot, dir), "*", true, paths)
+		}
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "TOOLS"), "*", false, []string{filepath.Join(repoRoot, "TOOLS", "run.sh")})
+		fs.AddFile(mappingsPath, "TOOLS /opt/tools os=darwin,windows\nLOCAL_BIN ~/bin os=!linux\n")
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.host = func() HostInfo { return HostInfo{OS: "linux"} }
+		service.environ = func() []string { return []string{"XDG_CONFIG_HOME=/xdg"} }
+
+		plan, err := service.Plan(repoRoot, userHome, ignoreFileName, LinkOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		actual := make(map[string]string)
+		for _, action := range plan.Actions {
+			if action.Kind == ActionLink {
+				actual[action.Target] = action.Source
+			}
+		}
+		if len(actual) != 1 || actual[filepath.Join(userHome, ".bashrc")] == "" {
+			t.Errorf("Expected only HOME to be linked, got %v", actual)
+		}
+	})
+
+	t.Run("Mapping replaces the built-in HOME mapping", func(t *testing.T) {
+		// Repository with HOME, XDG_CONFIG, LOCAL_BIN and TOOLS directories on a Linux machine
+		// whose XDG_CONFIG_HOME is /xdg
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory("/xdg")
+		layers := map[string][]string{
+			"HOME":       {".bashrc"},
+			"XDG_CONFIG": {"nvim/init.vim"},
+			"LOCAL_BIN":  {"backup"},
+			"TOOLS":      {"run.sh"},
+		}
+		for dir, files := range layers {
+			fs.AddDirectory(filepath.Join(repoRoot, dir))
+			var paths []string
+			for _, file := range files {
+				path := filepath.Join(repoRoot, dir, file)
+				fs.AddFile(path, "# "+dir)
+				paths = append(paths, path)
+			}
+			fs.SetupFileEnumeration(filepath.Join(repoRoot, dir), "*", true, paths)
+		}
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "TOOLS"), "*", false, []string{filepath.Join(repoRoot, "TOOLS", "run.sh")})
+		fs.AddFile(mappingsPath, "HOME $XDG_CONFIG_HOME/home\n")
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.host = func() HostInfo { return HostInfo{OS: "linux"} }
+		service.environ = func() []string { return []string{"XDG_CONFIG_HOME=/xdg"} }
+
+		plan, err := service.Plan(repoRoot, userHome, ignoreFileName, LinkOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		actual := make(map[string]string)
+		for _, action := range plan.Actions {
+			if action.Kind == ActionLink {
+				actual[action.Target] = action.Source
+			}
+		}
+		if actual[filepath.Join("/xdg", "home", ".bashrc")] != filepath.Join(repoRoot, "HOME", ".bashrc") {
+			t.Errorf("HOME was not linked to its mapped destination: %v", actual)
+		}
+	})
+
+	t.Run("Unset variable is an error", func(t *testing.T) {
+		// Repository with HOME, XDG_CONFIG, LOCAL_BIN and TOOLS directories on a Linux machine
+		// whose XDG_CONFIG_HOME is /xdg
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory("/xdg")
+		layers := map[string][]string{
+			"HOME":       {".bashrc"},
+			"XDG_CONFIG": {"nvim/init.vim"},
+			"LOCAL_BIN":  {"backup"},
+			"TOOLS":      {"run.sh"},
+		}
+		for dir, files := range layers {
+			fs.AddDirectory(filepath.Join(repoRoot, dir))
+			var paths []string
+			for _, file := range files {
+				path := filepath.Join(repoRoot, dir, file)
+				fs.AddFile(path, "# "+dir)
+				paths = append(paths, path)
+			}
+			fs.SetupFileEnumeration(filepath.Join(repoRoot, dir), "*", true, paths)
+		}
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "TOOLS"), "*", false, []string{filepath.Join(repoRoot, "TOOLS", "run.sh")})
+		fs.AddFile(mappingsPath, "TOOLS $TOOLS_HOME\n")
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.host = func() HostInfo { return HostInfo{OS: "linux"} }
+		service.environ = func() []string { return []string{"XDG_CONFIG_HOME=/xdg"} }
+
+		_, err := service.Plan(repoRoot, userHome, ignoreFileName, LinkOptions{})
+		if err == nil || !strings.Contains(err.Error(), "TOOLS_HOME is not set") {
+			t.Fatalf("Expected an unset variable error, got %v", err)
+		}
+	})
+
+	t.Run("Relative destination is an error", func(t *testing.T) {
+		// Repository with HOME, XDG_CONFIG, LOCAL_BIN and TOOLS directories on a Linux machine
+		// whose XDG_CONFIG_HOME is /xdg
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory("/xdg")
+		layers := map[string][]string{
+			"HOME":       {".bashrc"},
+			"XDG_CONFIG": {"nvim/init.vim"},
+			"LOCAL_BIN":  {"backup"},
+			"TOOLS":      {"run.sh"},
+		}
+		for dir, files := range layers {
+			fs.AddDirectory(filepath.Join(repoRoot, dir))
+			var paths []string
+			for _, file := range files {
+				path := filepath.Join(repoRoot, dir, file)
+				fs.AddFile(path, "# "+dir)
+				paths = append(paths, path)
+			}
+			fs.SetupFileEnumeration(filepath.Join(repoRoot, dir), "*", true, paths)
+		}
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "TOOLS"), "*", false, []string{filepath.Join(repoRoot, "TOOLS", "run.sh")})
+		fs.AddFile(mappingsPath, "TOOLS tools\n")
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.host = func() HostInfo { return HostInfo{OS: "linux"} }
+		service.environ = func() []string { return []string{"XDG_CONFIG_HOME=/xdg"} }
+
+		_, err := service.Plan(repoRoot, userHome, ignoreFileName, LinkOptions{})
+		if err == nil || !strings.Contains(err.Error(), "absolute path") {
+			t.Fatalf("Expected a relative destination error, got %v", err)
+		}
+	})
+
+	t.Run("Overlapping destinations are an error", func(t *testing.T) {
+		// Repository with HOME, XDG_CONFIG, LOCAL_BIN and TOOLS directories on a Linux machine
+		// whose XDG_CONFIG_HOME is /xdg
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory("/xdg")
+		layers := map[string][]string{
+			"HOME":       {".bashrc"},
+			"XDG_CONFIG": {"nvim/init.vim"},
+			"LOCAL_BIN":  {"backup"},
+			"TOOLS":      {"run.sh"},
+		}
+		for dir, files := range layers {
+			fs.AddDirectory(filepath.Join(repoRoot, dir))
+			var paths []string
+			for _, file := range files {
+				path := filepath.Join(repoRoot, dir, file)
+				fs.AddFile(path, "# "+dir)
+				paths = append(paths, path)
+			}
+			fs.SetupFileEnumeration(filepath.Join(repoRoot, dir), "*", true, paths)
+		}
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "TOOLS"), "*", false, []string{filepath.Join(repoRoot, "TOOLS", "run.sh")})
+		fs.AddFile(mappingsPath, "XDG_CONFIG ~/.config\n")
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.host = func() HostInfo { return HostInfo{OS: "linux"} }
+		service.environ = func() []string { return []string{"XDG_CONFIG_HOME=/xdg"} }
+		home := filepath.Join(repoRoot, "HOME")
+		fs.AddFile(filepath.Join(home, ".config", "nvim", "init.vim"), "# HOME")
+		fs.SetupFileEnumeration(home, "*", true, []string{filepath.Join(home, ".bashrc"), filepath.Join(home, ".config", "nvim", "init.vim")})
+
+		_, err := service.Plan(repoRoot, userHome, ignoreFileName, LinkOptions{})
+		if err == nil || !strings.Contains(err.Error(), filepath.Join(home, ".config", "nvim", "init.vim")) ||
+			!strings.Contains(err.Error(), filepath.Join(repoRoot, "XDG_CONFIG", "nvim", "init.vim")) {
+			t.Fatalf("Expected an error naming both sources, got %v", err)
+		}
+	})
+
+	t.Run("Destinations differing in case overlap on Windows", func(t *testing.T) {
+		// Repository with HOME and XDG_CONFIG directories on a Windows machine, XDG_CONFIG mapped to ~/.Config
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		home := filepath.Join(repoRoot, "HOME")
+		xdgConfig := filepath.Join(repoRoot, "XDG_CONFIG")
+		fs.AddDirectory(home)
+		fs.AddDirectory(xdgConfig)
+		fs.AddFile(filepath.Join(home, ".config", "nvim", "init.vim"), "# HOME")
+		fs.AddFile(filepath.Join(xdgConfig, "nvim", "init.vim"), "# XDG_CONFIG")
+		fs.SetupFileEnumeration(home, "*", true, []string{filepath.Join(home, ".config", "nvim", "init.vim")})
+		fs.SetupFileEnumeration(xdgConfig, "*", true, []string{filepath.Join(xdgConfig, "nvim", "init.vim")})
+		fs.AddFile(mappingsPath, "XDG_CONFIG ~/.Config\n")
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.host = func() HostInfo { return HostInfo{OS: "windows"} }
+
+		_, err := service.Plan(repoRoot, userHome, ignoreFileName, LinkOptions{})
+		if err == nil || !strings.Contains(err.Error(), "both linked to") {
+			t.Fatalf("Expected a duplicate target error, got %v", err)
+		}
+
+		service.host = func() HostInfo { return HostInfo{OS: "linux"} }
+		if _, err := service.Plan(repoRoot, userHome, ignoreFileName, LinkOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// HostDirName is the directory in the repository root that holds the overlays of individual machines,
+// such as HOST/<hostname>/HOME and HOST/<hostname>/ROOT.
+const HostDirName = "HOST"
+
+// SetHostname overrides the hostname of the machine, which selects the host overlay and is passed to templates.
+func (s *FileLinkerService) SetHostname(hostname string) {
+	host := s.host
+	s.host = func() HostInfo {
+		info := host()
+		info.Hostname = hostname
+		return info
+	}
+}
+
+// overlayDirectory is a repository directory layered over a base directory such as HOME.
+type overlayDirectory struct {
+	dir     string // Directory relative to the repository root, such as "profiles/work/HOME"
+	profile string // Profile the directory belongs to, or empty
+}
+
+// overlayDirectories returns the repository directories layered over baseDir in order of increasing precedence:
+// the directory of the OS such as "HOME.linux", the directories of the selected profile and the profiles it
+// inherits such as "profiles/work/HOME", then the directory of the host such as "HOST/laptop/HOME".
+func (s *FileLinkerService) overlayDirectories(repoRoot string, baseDir string) ([]overlayDirectory, error) {
+	host := s.host()
+	dirs := []overlayDirectory{{dir: baseDir + "." + host.OS}}
+
+	profiles, err := s.profileChain(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	for _, profile := range profiles {
+		dirs = append(dirs, overlayDirectory{dir: filepath.Join(ProfilesDirName, profile, baseDir), profile: profile})
+	}
+
+	if hostDir := s.hostDirectory(repoRoot, host.Hostname); hostDir != "" {
+		dirs = append(dirs, overlayDirectory{dir: filepath.Join(hostDir, baseDir)})
+	}
+	return dirs, nil
+}
+
+// hostDirectory returns the directory of the host in the repository, such as "HOST/laptop", or an empty string
+// when the repository has none. A fully qualified hostname also selects the directory of its first label.
+func (s *FileLinkerService) hostDirectory(repoRoot string, hostname string) string {
+	if hostname == "" || strings.ContainsAny(hostname, `/\`) || hostname == "." || hostname == ".." {
+		return ""
+	}
+	short, _, _ := strings.Cut(hostname, ".")
+	for _, name := range []string{hostname, short} {
+		dir := filepath.Join(HostDirName, name)
+		if s.fs.DirectoryExists(filepath.Join(repoRoot, dir)) {
+			return dir
+		}
+	}
+	return ""
+}
+
+// collectLayers collects the files of the mapped directory and of its overlay directories, which all map to its destination.
+// Entries are marked with the directory they were collected from; mergeOverlays decides which entry supplies each target.
+func (s *FileLinkerService) collectLayers(repoRoot string, mapping directoryMapping, userIgnore map[string]bool) ([]linkEntry, error) {
+	baseDir := mapping.source
+	entries, err := s.collectDirectory(repoRoot, baseDir, mapping.destination, mapping.recursive, userIgnore)
+	if err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		entries[i].layer = baseDir
+	}
+
+	overlays, err := s.overlayDirectories(repoRoot, baseDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, overlay := range overlays {
+		if !s.fs.DirectoryExists(filepath.Join(repoRoot, overlay.dir)) {
+			s.logger.Verbose(fmt.Sprintf("%s directory not found", overlay.dir))
+			continue
+		}
+		overlayEntries, err := s.collectDirectory(repoRoot, overlay.dir, mapping.destination, mapping.recursive, userIgnore)
+		if err != nil {
+			return nil, err
+		}
+		for i := range overlayEntries {
+			overlayEntries[i].layer = overlay.dir
+			overlayEntries[i].overlay = true
+			overlayEntries[i].profile = overlay.profile
+		}
+		entries = append(entries, overlayEntries...)
+	}
+	return entries, nil
+}
+
+// mergeOverlays removes the entries whose target is also supplied by a later overlay entry,
+// so the file of the overlay with the highest precedence wins. Ignored overlay files override nothing.
+func (s *FileLinkerService) mergeOverlays(entries []linkEntry) []linkEntry {
+	winners := make(map[string]int)
+	for i, entry := range entries {
+		if entry.overlay && !entry.ignored {
+			winners[entry.target] = i
+		}
+	}
+
+	merged := make([]linkEntry, 0, len(entries))
+	for i, entry := range entries {
+		if winner, exists := winners[entry.target]; exists && winner != i {
+			s.logger.Verbose(fmt.Sprintf("%s overrides %s for %s", entries[winner].source, entry.source, entry.target))
+			continue
+		}
+		if !entry.ignored {
+			s.logger.Verbose(fmt.Sprintf("%s is supplied by %s", entry.target, entry.layerName()))
+		}
+		merged = append(merged, entry)
+	}
+	return merged
+}
+
+// layerName describes the repository directory the entry was collected from.
+func (e linkEntry) layerName() string {
+	if e.layer == "" {
+		return "the repository root"
+	}
+	return filepath.ToSlash(e.layer)
+}
@@ -0,0 +1,276 @@
+package service
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/guitarrapc/dotfileslinker-go/internal/infrastructure"
+)
+
+func TestFileLinkerService_Overlays(t *testing.T) {
+	repoRoot := "/repo"
+	userHome := "/home/user"
+	ignoreFileName := ".ignore"
+	bashrc := filepath.Join(userHome, ".bashrc")
+	vimrc := filepath.Join(userHome, ".vimrc")
+	gitconfig := filepath.Join(userHome, ".gitconfig")
+	hosts := "/etc/hosts"
+
+	t.Run("Overlay of the current OS wins", func(t *testing.T) {
+		// Repository with base files, Linux and macOS overlays and the overlay of the host "work",
+		// on a machine named "home" running Linux
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory("/etc")
+		fs.AddDirectory(filepath.Join(repoRoot, "HOST", "work"))
+		layers := map[string][]string{
+			"HOME":           {".bashrc", ".vimrc"},
+			"HOME.linux":     {".bashrc", ".gitconfig.tmpl"},
+			"HOME.darwin":    {".bashrc"},
+			"ROOT":           {"etc/hosts"},
+			"ROOT.linux":     {"etc/hosts"},
+			"HOST/work/HOME": {".bashrc", ".ssh/config"},
+		}
+		for dir, files := range layers {
+			fs.AddDirectory(filepath.Join(repoRoot, dir))
+			var paths []string
+			for _, file := range files {
+				path := filepath.Join(repoRoot, dir, file)
+				fs.AddFile(path, "# "+dir)
+				paths = append(paths, path)
+			}
+			fs.SetupFileEnumeration(filepath.Join(repoRoot, dir), "*", true, paths)
+		}
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.host = func() HostInfo { return HostInfo{Hostname: "home", OS: "linux"} }
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := map[string]string{
+			bashrc: filepath.Join(repoRoot, "HOME.linux", ".bashrc"),
+			vimrc:  filepath.Join(repoRoot, "HOME", ".vimrc"),
+			hosts:  filepath.Join(repoRoot, "ROOT.linux", "etc", "hosts"),
+		}
+		for target, source := range expected {
+			if fs.GetLinkTarget(target) != source {
+				t.Errorf("Expected %s -> %s, got %q", target, source, fs.GetLinkTarget(target))
+			}
+		}
+		if fs.Files[gitconfig] != "# HOME.linux" {
+			t.Errorf("Template of the overlay was not rendered: %q", fs.Files[gitconfig])
+		}
+	})
+
+	t.Run("Overlays of other systems are not linked", func(t *testing.T) {
+		// Repository with base files, Linux and macOS overlays and the overlay of the host "work",
+		// on a machine named "home" running macOS
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory("/etc")
+		fs.AddDirectory(filepath.Join(repoRoot, "HOST", "work"))
+		layers := map[string][]string{
+			"HOME":           {".bashrc", ".vimrc"},
+			"HOME.linux":     {".bashrc", ".gitconfig.tmpl"},
+			"HOME.darwin":    {".bashrc"},
+			"ROOT":           {"etc/hosts"},
+			"ROOT.linux":     {"etc/hosts"},
+			"HOST/work/HOME": {".bashrc", ".ssh/config"},
+		}
+		for dir, files := range layers {
+			fs.AddDirectory(filepath.Join(repoRoot, dir))
+			var paths []string
+			for _, file := range files {
+				path := filepath.Join(repoRoot, dir, file)
+				fs.AddFile(path, "# "+dir)
+				paths = append(paths, path)
+			}
+			fs.SetupFileEnumeration(filepath.Join(repoRoot, dir), "*", true, paths)
+		}
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.host = func() HostInfo { return HostInfo{Hostname: "home", OS: "darwin"} }
+
+		plan, err := service.Plan(repoRoot, userHome, ignoreFileName, LinkOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		sources := make(map[string]string)
+		for _, action := range plan.Actions {
+			if action.Kind == ActionLink {
+				sources[action.Target] = action.Source
+			}
+		}
+		if sources[bashrc] != filepath.Join(repoRoot, "HOME.darwin", ".bashrc") || sources[hosts] != filepath.Join(repoRoot, "ROOT", "etc", "hosts") {
+			t.Errorf("Unexpected sources: %v", sources)
+		}
+		if _, exists := sources[gitconfig]; exists {
+			t.Error("Linux overlay was linked on macOS")
+		}
+	})
+
+	t.Run("Host overlay wins over the OS overlay", func(t *testing.T) {
+		// Repository with base files, Linux and macOS overlays and the overlay of the host "work",
+		// on a machine named "home" running Linux
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory("/etc")
+		fs.AddDirectory(filepath.Join(repoRoot, "HOST", "work"))
+		layers := map[string][]string{
+			"HOME":           {".bashrc", ".vimrc"},
+			"HOME.linux":     {".bashrc", ".gitconfig.tmpl"},
+			"HOME.darwin":    {".bashrc"},
+			"ROOT":           {"etc/hosts"},
+			"ROOT.linux":     {"etc/hosts"},
+			"HOST/work/HOME": {".bashrc", ".ssh/config"},
+		}
+		for dir, files := range layers {
+			fs.AddDirectory(filepath.Join(repoRoot, dir))
+			var paths []string
+			for _, file := range files {
+				path := filepath.Join(repoRoot, dir, file)
+				fs.AddFile(path, "# "+dir)
+				paths = append(paths, path)
+			}
+			fs.SetupFileEnumeration(filepath.Join(repoRoot, dir), "*", true, paths)
+		}
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.host = func() HostInfo { return HostInfo{Hostname: "home", OS: "linux"} }
+		service.SetHostname("work.corp.example.com")
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := map[string]string{
+			bashrc: filepath.Join(repoRoot, "HOST", "work", "HOME", ".bashrc"),
+			filepath.Join(userHome, ".ssh", "config"): filepath.Join(repoRoot, "HOST", "work", "HOME", ".ssh", "config"),
+			vimrc: filepath.Join(repoRoot, "HOME", ".vimrc"),
+		}
+		for target, source := range expected {
+			if fs.GetLinkTarget(target) != source {
+				t.Errorf("Expected %s -> %s, got %q", target, source, fs.GetLinkTarget(target))
+			}
+		}
+	})
+
+	t.Run("Other hosts are not linked", func(t *testing.T) {
+		// Repository with base files, Linux and macOS overlays and the overlay of the host "work",
+		// on a machine named "home" running Linux
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory("/etc")
+		fs.AddDirectory(filepath.Join(repoRoot, "HOST", "work"))
+		layers := map[string][]string{
+			"HOME":           {".bashrc", ".vimrc"},
+			"HOME.linux":     {".bashrc", ".gitconfig.tmpl"},
+			"HOME.darwin":    {".bashrc"},
+			"ROOT":           {"etc/hosts"},
+			"ROOT.linux":     {"etc/hosts"},
+			"HOST/work/HOME": {".bashrc", ".ssh/config"},
+		}
+		for dir, files := range layers {
+			fs.AddDirectory(filepath.Join(repoRoot, dir))
+			var paths []string
+			for _, file := range files {
+				path := filepath.Join(repoRoot, dir, file)
+				fs.AddFile(path, "# "+dir)
+				paths = append(paths, path)
+			}
+			fs.SetupFileEnumeration(filepath.Join(repoRoot, dir), "*", true, paths)
+		}
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.host = func() HostInfo { return HostInfo{Hostname: "home", OS: "linux"} }
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.FileExists(filepath.Join(userHome, ".ssh", "config")) || fs.GetLinkTarget(filepath.Join(userHome, ".ssh", "config")) != "" {
+			t.Error("Overlay of another host was linked")
+		}
+	})
+
+	t.Run("Ignored overlay file does not override", func(t *testing.T) {
+		// Repository with base files, Linux and macOS overlays and the overlay of the host "work",
+		// on a machine named "home" running Linux
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory("/etc")
+		fs.AddDirectory(filepath.Join(repoRoot, "HOST", "work"))
+		layers := map[string][]string{
+			"HOME":           {".bashrc", ".vimrc"},
+			"HOME.linux":     {".bashrc", ".gitconfig.tmpl"},
+			"HOME.darwin":    {".bashrc"},
+			"ROOT":           {"etc/hosts"},
+			"ROOT.linux":     {"etc/hosts"},
+			"HOST/work/HOME": {".bashrc", ".ssh/config"},
+		}
+		for dir, files := range layers {
+			fs.AddDirectory(filepath.Join(repoRoot, dir))
+			var paths []string
+			for _, file := range files {
+				path := filepath.Join(repoRoot, dir, file)
+				fs.AddFile(path, "# "+dir)
+				paths = append(paths, path)
+			}
+			fs.SetupFileEnumeration(filepath.Join(repoRoot, dir), "*", true, paths)
+		}
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.host = func() HostInfo { return HostInfo{Hostname: "home", OS: "linux"} }
+		entries := []linkEntry{
+			{source: filepath.Join(repoRoot, "HOME", ".bashrc"), target: bashrc},
+			{source: filepath.Join(repoRoot, "HOME.linux", ".bashrc"), target: bashrc, layer: "HOME.linux", overlay: true, ignored: true},
+		}
+
+		merged := service.mergeOverlays(entries)
+		if len(merged) != 2 || merged[0].source != entries[0].source {
+			t.Errorf("Base entry was overridden: %+v", merged)
+		}
+	})
+
+	t.Run("ROOT overlays are skipped on Windows", func(t *testing.T) {
+		// Repository with base files, Linux and macOS overlays and the overlay of the host "work",
+		// on a machine named "home" running Windows
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory("/etc")
+		fs.AddDirectory(filepath.Join(repoRoot, "HOST", "work"))
+		layers := map[string][]string{
+			"HOME":           {".bashrc", ".vimrc"},
+			"HOME.linux":     {".bashrc", ".gitconfig.tmpl"},
+			"HOME.darwin":    {".bashrc"},
+			"ROOT":           {"etc/hosts"},
+			"ROOT.linux":     {"etc/hosts"},
+			"HOST/work/HOME": {".bashrc", ".ssh/config"},
+		}
+		for dir, files := range layers {
+			fs.AddDirectory(filepath.Join(repoRoot, dir))
+			var paths []string
+			for _, file := range files {
+				path := filepath.Join(repoRoot, dir, file)
+				fs.AddFile(path, "# "+dir)
+				paths = append(paths, path)
+			}
+			fs.SetupFileEnumeration(filepath.Join(repoRoot, dir), "*", true, paths)
+		}
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.host = func() HostInfo { return HostInfo{Hostname: "home", OS: "windows"} }
+
+		entries, err := service.collectMappings(repoRoot, userHome, nil)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.layer, "ROOT") {
+				t.Errorf("Expected no ROOT entries, got %+v", entry)
+			}
+		}
+	})
+}
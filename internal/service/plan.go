@@ -0,0 +1,351 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/guitarrapc/dotfileslinker-go/internal/util"
+)
+
+// ActionKind identifies what an Action does.
+type ActionKind int
+
+const (
+	// ActionMkdir creates a missing parent directory of a target.
+	ActionMkdir ActionKind = iota
+	// ActionLink creates a link where nothing exists yet.
+	ActionLink
+	// ActionReplace removes or backs up an existing target and creates a link in its place.
+	ActionReplace
+	// ActionSkip leaves a target that is already linked correctly.
+	ActionSkip
+	// ActionIgnore leaves a source that matched an ignore pattern.
+	ActionIgnore
+	// ActionUnfold replaces a directory symlink into the repository by a real directory,
+	// so the files inside it can be linked one by one.
+	ActionUnfold
+	// ActionSetAttributes applies the mode or owner declared in the attributes file to a target or its directory.
+	ActionSetAttributes
+)
+
+// String returns the display name of the action kind.
+func (k ActionKind) String() string {
+	switch k {
+	case ActionMkdir:
+		return "mkdir"
+	case ActionLink:
+		return "link"
+	case ActionReplace:
+		return "replace"
+	case ActionSkip:
+		return "skip"
+	case ActionIgnore:
+		return "ignore"
+	case ActionUnfold:
+		return "unfold"
+	case ActionSetAttributes:
+		return "attributes"
+	default:
+		return "unknown"
+	}
+}
+
+// Action is a single step of a Plan.
+type Action struct {
+	Kind       ActionKind // What the action does
+	Source     string     // Path in the repository; empty for mkdir
+	Target     string     // Path that is created, replaced or left alone
+	IsDir      bool       // Whether the source is a directory
+	Mode       LinkMode   // How the source is deployed
+	Relative   bool       // Whether a symbolic link points to the source by a relative path
+	Template   bool       // Whether the source is a template whose rendered content is written to the target
+	Encrypted  bool       // Whether the source is encrypted and its decrypted content is written to the target
+	Injected   bool       // Whether the target keeps the source in a managed block instead of being replaced
+	Include    string     // Format of the include directive that references the source from the target, or empty
+	Profile    string     // Profile that supplied the source, or empty when it does not come from a profile
+	Content    string     // Content written to the target of a template, encrypted source, injected or included file
+	Attributes Attributes // Attributes applied by an ActionSetAttributes
+	Reason     string     // Why the action was chosen
+}
+
+// generated reports whether the action writes content generated from the source rather than the source itself.
+func (a Action) generated() bool {
+	return a.Template || a.Encrypted || a.Injected || a.Include != ""
+}
+
+// Plan is the ordered list of actions that links a repository.
+// It is produced by FileLinkerService.Plan without touching the file system and executed by FileLinkerService.Apply.
+type Plan struct {
+	RepoRoot string      // The root directory of the dotfiles repository
+	UserHome string      // The user's home directory path
+	Options  LinkOptions // Options the plan was created with
+	Actions  []Action    // Actions in execution order
+}
+
+// Count returns the number of actions of the given kind.
+func (p *Plan) Count(kind ActionKind) int {
+	count := 0
+	for _, action := range p.Actions {
+		if action.Kind == kind {
+			count++
+		}
+	}
+	return count
+}
+
+// Plan decides which actions are needed to link the repository without modifying the file system.
+// repoRoot: The root directory of the dotfiles repository.
+// userHome: The user's home directory path.
+// ignoreFileName: The name of the ignore file containing patterns to exclude.
+// opts: Options controlling conflict handling; a conflict with ConflictFail is returned as an error.
+func (s *FileLinkerService) Plan(repoRoot string, userHome string, ignoreFileName string, opts LinkOptions) (*Plan, error) {
+	if opts.RunID == "" {
+		opts.RunID = s.newRunID()
+	}
+
+	s.logger.Info(fmt.Sprintf("Starting to link dotfiles from %s to %s", repoRoot, userHome))
+	s.logger.Info(fmt.Sprintf("Using ignore file: %s", ignoreFileName))
+
+	ignorePath := filepath.Join(repoRoot, ignoreFileName)
+	userIgnore := s.loadIgnoreList(ignorePath)
+	s.logger.Verbose(fmt.Sprintf("Loaded %d user-defined ignore patterns from %s", len(userIgnore), ignorePath))
+	s.logger.Verbose(fmt.Sprintf("Using %d default ignore patterns", len(defaultIgnorePatterns)))
+
+	rules, err := s.loadAttributes(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := s.collectAll(repoRoot, userHome, userIgnore)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := s.LoadManifest()
+	if err != nil {
+		return nil, err
+	}
+	state := manifest.Repository(repoRoot)
+
+	entries, unfold := s.foldEntries(entries, foldPolicyFor(opts))
+
+	plan := &Plan{RepoRoot: repoRoot, UserHome: userHome, Options: opts}
+	renderer := s.newTemplateRenderer(repoRoot, userHome)
+	decrypter := s.newDecrypter()
+	plannedDirs := make(map[string]bool)
+	unfolded := make(map[string]bool)
+	for _, action := range unfold {
+		plan.Actions = append(plan.Actions, action)
+		plannedDirs[action.Target] = true
+		unfolded[action.Target] = true
+	}
+	for _, entry := range entries {
+		if entry.ignored {
+			reason := "matched ignore pattern"
+			if entry.alternate {
+				reason = "another alternate matches better"
+			}
+			plan.Actions = append(plan.Actions, Action{Kind: ActionIgnore, Source: entry.source, Target: entry.target, Reason: reason})
+			continue
+		}
+
+		if entry.rendered, err = s.generate(entry, renderer, decrypter); err != nil {
+			return nil, err
+		}
+
+		action, err := s.planTarget(entry, opts, state)
+		if err != nil {
+			return nil, err
+		}
+
+		if action.Kind != ActionSkip {
+			plan.Actions = append(plan.Actions, s.planDirectories(filepath.Dir(entry.target), plannedDirs, unfolded)...)
+		}
+		plan.Actions = append(plan.Actions, action)
+	}
+
+	attributes, err := s.planAttributes(plan, rules)
+	if err != nil {
+		return nil, err
+	}
+	plan.Actions = append(plan.Actions, attributes...)
+
+	return plan, nil
+}
+
+// planTarget decides how a single entry is linked.
+// state is the manifest record of the repository, or nil when nothing is recorded.
+func (s *FileLinkerService) planTarget(entry linkEntry, opts LinkOptions, state *RepositoryState) (Action, error) {
+	action := Action{Source: entry.source, Target: entry.target, IsDir: s.fs.DirectoryExists(entry.source), Mode: opts.Mode, Relative: opts.Relative, Profile: entry.profile}
+	if entry.template || entry.encrypted {
+		action.Template = entry.template
+		action.Encrypted = entry.encrypted
+		action.Content = entry.rendered
+	}
+	if entry.injected {
+		body, err := s.injectedBody(entry)
+		if err != nil {
+			return action, err
+		}
+		action.Injected = true
+		action.Content = body
+	}
+	action.Include = entry.include
+	if entry.unfolded {
+		// The target only appears to exist through the directory symlink that is replaced first
+		action.Kind = ActionLink
+		action.Reason = "directory is unfolded"
+		switch {
+		case action.Injected:
+			action.Content = injectBlock("", action.Content)
+		case action.Include != "":
+			action.Content = addInclude("", includeFormats[action.Include], action.Source)
+		}
+		return action, nil
+	}
+	if action.Injected {
+		return s.planInjected(action, opts, state)
+	}
+	if action.Include != "" {
+		return s.planIncluded(action, opts)
+	}
+	if action.generated() {
+		return s.planGenerated(action, opts, state)
+	}
+
+	switch opts.Mode {
+	case ModeCopy:
+		return s.planCopy(action, opts, state)
+	case ModeHardlink:
+		return s.planHardlink(action, opts)
+	}
+
+	fileExists := s.fs.FileExists(entry.target)
+	dirExists := s.fs.DirectoryExists(entry.target)
+	currentLinkTarget := s.fs.GetLinkTarget(entry.target)
+	// A dangling symlink is neither a file nor a directory but still occupies the target path
+	exists := fileExists || dirExists || currentLinkTarget != ""
+
+	if !exists {
+		action.Kind = ActionLink
+		action.Reason = "target does not exist"
+		return action, nil
+	}
+
+	// If the target is a symlink and points to the same file, do nothing.
+	// Relative and absolute links to the source are equivalent, whichever form was requested.
+	if currentLinkTarget != "" && util.PathEquals(util.ResolveLinkTarget(entry.target, currentLinkTarget), entry.source) {
+		action.Kind = ActionSkip
+		action.Reason = "already linked"
+		return action, nil
+	}
+
+	return s.planConflict(action, s.describeExisting(entry.target), opts)
+}
+
+// describeExisting describes what occupies a target path, for conflict messages.
+func (s *FileLinkerService) describeExisting(target string) string {
+	if linkTarget := s.fs.GetLinkTarget(target); linkTarget != "" {
+		return fmt.Sprintf("symlink to %s", linkTarget)
+	}
+	if s.fs.DirectoryExists(target) {
+		return "directory"
+	}
+	return "file"
+}
+
+// planConflict decides what happens to an existing target that is in the way, according to the conflict strategy.
+// existing describes the target, such as "file" or "symlink to /path".
+func (s *FileLinkerService) planConflict(action Action, existing string, opts LinkOptions) (Action, error) {
+	switch opts.Conflict {
+	case ConflictBackup:
+		action.Kind = ActionReplace
+		action.Reason = fmt.Sprintf("existing %s is backed up", existing)
+	case ConflictOverwrite:
+		action.Kind = ActionReplace
+		action.Reason = fmt.Sprintf("existing %s is deleted", existing)
+	default:
+		s.logger.Verbose(fmt.Sprintf("Target %s exists and overwrite=false, aborting", action.Target))
+		return action, fmt.Errorf("'%s' already exists (%s); use --force=y to overwrite or --backup to back it up", action.Target, existing)
+	}
+	return action, nil
+}
+
+// planDirectories returns mkdir actions for dir and its missing parents, outermost first.
+// Directories already planned are recorded in planned and not returned again.
+// Directories below an unfolded directory are missing even though they appear to exist through its link.
+func (s *FileLinkerService) planDirectories(dir string, planned map[string]bool, unfolded map[string]bool) []Action {
+	var missing []string
+	for d := dir; !planned[d] && (!s.fs.DirectoryExists(d) || ancestorIn(d, unfolded) != ""); d = filepath.Dir(d) {
+		missing = append(missing, d)
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+
+	actions := make([]Action, 0, len(missing))
+	for i := len(missing) - 1; i >= 0; i-- {
+		planned[missing[i]] = true
+		actions = append(actions, Action{Kind: ActionMkdir, Target: missing[i], IsDir: true, Reason: "parent directory does not exist"})
+	}
+	return actions
+}
+
+// PrintPlan logs every action of the plan as a dry run.
+func (s *FileLinkerService) PrintPlan(plan *Plan) {
+	for _, action := range plan.Actions {
+		switch action.Kind {
+		case ActionMkdir:
+			s.logger.Verbose(fmt.Sprintf("[DRY-RUN] Would create directory: %s", action.Target))
+		case ActionIgnore:
+			s.logger.Verbose(fmt.Sprintf("[DRY-RUN] Would ignore %s (%s)", action.Source, action.Reason))
+		case ActionUnfold:
+			s.logger.Success(fmt.Sprintf("[DRY-RUN] Would unfold %s into a directory (%s)", action.Target, action.Reason))
+		case ActionSetAttributes:
+			s.logger.Success(fmt.Sprintf("[DRY-RUN] Would set %s on %s (%s)", action.Attributes, action.Target, action.Reason))
+		case ActionSkip:
+			s.logger.Success(fmt.Sprintf("[DRY-RUN] Would skip already linked: %s -> %s%s", action.Target, action.Source, profileSuffix(action)))
+		case ActionReplace:
+			s.logger.Success(fmt.Sprintf("[DRY-RUN] Would replace %s (%s) with %s -> %s%s", action.Target, action.Reason, linkKind(action), action.Source, profileSuffix(action)))
+		case ActionLink:
+			s.logger.Success(fmt.Sprintf("[DRY-RUN] Would create %s: %s -> %s%s", linkKind(action), action.Target, action.Source, profileSuffix(action)))
+		}
+	}
+
+	s.logger.Success(fmt.Sprintf("Plan: %d to link, %d to replace, %d already linked, %d directories to create, %d ignored",
+		plan.Count(ActionLink), plan.Count(ActionReplace), plan.Count(ActionSkip), plan.Count(ActionMkdir), plan.Count(ActionIgnore)))
+}
+
+// profileSuffix names the profile that supplied the source of an action, for the dry-run output.
+func profileSuffix(action Action) string {
+	if action.Profile == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (profile %s)", action.Profile)
+}
+
+// linkKind describes what an action creates, such as "file symlink" or "copy".
+func linkKind(action Action) string {
+	if action.Injected {
+		return "managed block"
+	}
+	if action.Include != "" {
+		return action.Include + " include"
+	}
+	if action.Encrypted {
+		return "decrypted file"
+	}
+	if action.Template {
+		return "rendered template"
+	}
+	switch action.Mode {
+	case ModeCopy:
+		return "copy"
+	case ModeHardlink:
+		return "hard link"
+	}
+	if action.IsDir {
+		return "directory symlink"
+	}
+	return "file symlink"
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/guitarrapc/dotfileslinker-go/internal/infrastructure"
+)
+
+func TestFileLinkerService_Plan(t *testing.T) {
+	repoRoot := "/repo"
+	userHome := "/home/user"
+	ignoreFileName := ".ignore"
+
+	t.Run("Plan contains typed actions and does not modify the file system", func(t *testing.T) {
+		// Repository with root dotfiles, an ignored file and a nested HOME file
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# bashrc")
+		fs.AddFile(filepath.Join(repoRoot, ".vimrc"), "# vimrc")
+		fs.AddFile(filepath.Join(repoRoot, ".DS_Store"), "binary")
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+		fs.AddFile(filepath.Join(repoRoot, "HOME", ".config", "nvim", "init.vim"), "# neovim config")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{
+			filepath.Join(repoRoot, ".bashrc"),
+			filepath.Join(repoRoot, ".vimrc"),
+			filepath.Join(repoRoot, ".DS_Store"),
+		})
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, []string{
+			filepath.Join(repoRoot, "HOME", ".config", "nvim", "init.vim"),
+		})
+		service := NewFileLinkerService(fs, NewMockLogger())
+
+		fs.SymLinks[filepath.Join(userHome, ".bashrc")] = filepath.Join(repoRoot, ".bashrc")
+		fs.AddFile(filepath.Join(userHome, ".vimrc"), "# user vimrc")
+
+		plan, err := service.Plan(repoRoot, userHome, ignoreFileName, LinkOptions{Conflict: ConflictOverwrite})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := []struct {
+			kind   ActionKind
+			target string
+		}{
+			{ActionSkip, filepath.Join(userHome, ".bashrc")},
+			{ActionReplace, filepath.Join(userHome, ".vimrc")},
+			{ActionIgnore, filepath.Join(userHome, ".DS_Store")},
+			{ActionMkdir, filepath.Join(userHome, ".config")},
+			{ActionMkdir, filepath.Join(userHome, ".config", "nvim")},
+			{ActionLink, filepath.Join(userHome, ".config", "nvim", "init.vim")},
+		}
+		if len(plan.Actions) != len(expected) {
+			t.Fatalf("Expected %d actions, got %d: %+v", len(expected), len(plan.Actions), plan.Actions)
+		}
+		for i, want := range expected {
+			got := plan.Actions[i]
+			if got.Kind != want.kind || got.Target != want.target {
+				t.Errorf("Action %d: expected %s %s, got %s %s", i, want.kind, want.target, got.Kind, got.Target)
+			}
+			if got.Reason == "" {
+				t.Errorf("Action %d has no reason", i)
+			}
+		}
+
+		for _, op := range fs.OperationLog {
+			for _, mutating := range []string{"Delete:", "CreateFileSymlink:", "CreateDirectorySymlink:", "EnsureDirectory:", "Move:"} {
+				if strings.HasPrefix(op, mutating) {
+					t.Errorf("Plan performed a mutating operation: %s", op)
+				}
+			}
+		}
+	})
+
+	t.Run("Conflict without overwrite is an error", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(filepath.Join(repoRoot, ".vimrc"), "# vimrc")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{filepath.Join(repoRoot, ".vimrc")})
+		service := NewFileLinkerService(fs, NewMockLogger())
+
+		fs.AddFile(filepath.Join(userHome, ".vimrc"), "# user vimrc")
+
+		if _, err := service.Plan(repoRoot, userHome, ignoreFileName, LinkOptions{}); err == nil {
+			t.Fatal("Expected error for a conflicting target")
+		}
+	})
+
+	t.Run("Apply executes the plan", func(t *testing.T) {
+		// Repository with root dotfiles, an ignored file and a nested HOME file
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# bashrc")
+		fs.AddFile(filepath.Join(repoRoot, ".vimrc"), "# vimrc")
+		fs.AddFile(filepath.Join(repoRoot, ".DS_Store"), "binary")
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+		fs.AddFile(filepath.Join(repoRoot, "HOME", ".config", "nvim", "init.vim"), "# neovim config")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{
+			filepath.Join(repoRoot, ".bashrc"),
+			filepath.Join(repoRoot, ".vimrc"),
+			filepath.Join(repoRoot, ".DS_Store"),
+		})
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, []string{
+			filepath.Join(repoRoot, "HOME", ".config", "nvim", "init.vim"),
+		})
+		service := NewFileLinkerService(fs, NewMockLogger())
+
+		fs.AddFile(filepath.Join(userHome, ".vimrc"), "# user vimrc")
+
+		plan, err := service.Plan(repoRoot, userHome, ignoreFileName, LinkOptions{Conflict: ConflictOverwrite})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := service.Apply(plan); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		for _, rel := range []string{".bashrc", ".vimrc"} {
+			if fs.GetLinkTarget(filepath.Join(userHome, rel)) != filepath.Join(repoRoot, rel) {
+				t.Errorf("Link not created for %s", rel)
+			}
+		}
+		if !fs.DirectoryExists(filepath.Join(userHome, ".config", "nvim")) {
+			t.Error("Parent directory was not created")
+		}
+		if fs.GetLinkTarget(filepath.Join(userHome, ".DS_Store")) != "" {
+			t.Error("Ignored file was linked")
+		}
+	})
+
+	t.Run("Dry run prints the plan", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		logger := NewMockLogger()
+		service := NewFileLinkerService(fs, logger)
+
+		// Repository with a nested HOME file whose parent directories are missing
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+		fs.AddFile(filepath.Join(repoRoot, "HOME", ".config", "nvim", "init.vim"), "# neovim config")
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, []string{
+			filepath.Join(repoRoot, "HOME", ".config", "nvim", "init.vim"),
+		})
+
+		if err := service.LinkDotfiles(repoRoot, userHome, ignoreFileName, false, true); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		found := false
+		for _, msg := range logger.VerboseLogs {
+			if strings.Contains(msg, "[DRY-RUN] Would create directory") && strings.Contains(msg, ".config") {
+				found = true
+			}
+		}
+		if !found {
+			t.Error("Mkdir action was not printed")
+		}
+		if len(fs.SymLinks) != 0 {
+			t.Error("Links were created in dry run mode")
+		}
+	})
+}
+
+func TestActionKind_String(t *testing.T) {
+	tests := map[ActionKind]string{
+		ActionMkdir:         "mkdir",
+		ActionLink:          "link",
+		ActionReplace:       "replace",
+		ActionSkip:          "skip",
+		ActionIgnore:        "ignore",
+		ActionUnfold:        "unfold",
+		ActionSetAttributes: "attributes",
+		ActionKind(99):      "unknown",
+	}
+	for kind, expected := range tests {
+		if kind.String() != expected {
+			t.Errorf("ActionKind(%d).String() = %q; want %q", int(kind), kind.String(), expected)
+		}
+	}
+}
+
+func TestFileLinkerService_RelativeLinks(t *testing.T) {
+	repoRoot := "/home/user/dotfiles"
+	userHome := "/home/user"
+	ignoreFileName := ".ignore"
+
+	t.Run("Links point to the source relative to their directory", func(t *testing.T) {
+		// Repository inside the home directory with a root dotfile and a nested HOME file
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# bashrc")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{filepath.Join(repoRoot, ".bashrc")})
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+		fs.AddFile(filepath.Join(repoRoot, "HOME", ".config", "nvim", "init.vim"), "# neovim config")
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, []string{
+			filepath.Join(repoRoot, "HOME", ".config", "nvim", "init.vim"),
+		})
+		service := NewFileLinkerService(fs, NewMockLogger())
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{Relative: true}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := map[string]string{
+			filepath.Join(userHome, ".bashrc"):                     filepath.Join("dotfiles", ".bashrc"),
+			filepath.Join(userHome, ".config", "nvim", "init.vim"): filepath.Join("..", "..", "dotfiles", "HOME", ".config", "nvim", "init.vim"),
+		}
+		for target, want := range expected {
+			if got := fs.GetLinkTarget(target); got != want {
+				t.Errorf("Link %s points to %q; want %q", target, got, want)
+			}
+		}
+	})
+
+	t.Run("Relative and absolute links are equivalent", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			existing string
+			opts     LinkOptions
+		}{
+			{"Absolute link with relative requested", filepath.Join(repoRoot, ".bashrc"), LinkOptions{Relative: true}},
+			{"Relative link with absolute requested", filepath.Join("dotfiles", ".bashrc"), LinkOptions{}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				fs := infrastructure.NewMockFileSystem()
+				fs.AddDirectory(userHome)
+				fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# bashrc")
+				fs.SetupFileEnumeration(repoRoot, ".*", false, []string{filepath.Join(repoRoot, ".bashrc")})
+				service := NewFileLinkerService(fs, NewMockLogger())
+				fs.SymLinks[filepath.Join(userHome, ".bashrc")] = tt.existing
+
+				plan, err := service.Plan(repoRoot, userHome, ignoreFileName, tt.opts)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				for _, action := range plan.Actions {
+					if action.Target == filepath.Join(userHome, ".bashrc") && action.Kind != ActionSkip {
+						t.Errorf("Expected equivalent link to be skipped, got %s", action.Kind)
+					}
+				}
+			})
+		}
+	})
+}
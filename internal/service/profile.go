@@ -0,0 +1,89 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ProfilesDirName is the directory in the repository root that holds named profiles,
+// such as profiles/work/HOME and profiles/work/ROOT.
+const ProfilesDirName = "profiles"
+
+// ProfileInheritsFileName is the file in a profile directory that names the profiles it inherits from,
+// one per line. The files of a profile take precedence over the files of the profiles it inherits.
+const ProfileInheritsFileName = "inherits"
+
+// SetProfile selects the profile whose directories are layered over HOME and ROOT. An empty name selects none.
+func (s *FileLinkerService) SetProfile(name string) {
+	s.profile = name
+}
+
+// profileChain returns the selected profile and the profiles it inherits from, in order of increasing precedence:
+// inherited profiles come before the profiles that inherit them, and each profile appears once.
+func (s *FileLinkerService) profileChain(repoRoot string) ([]string, error) {
+	if s.profile == "" {
+		return nil, nil
+	}
+	var chain []string
+	resolved := make(map[string]bool)
+	if err := s.resolveProfile(repoRoot, s.profile, nil, resolved, &chain); err != nil {
+		return nil, err
+	}
+	return chain, nil
+}
+
+// resolveProfile appends the profiles name inherits from and then name itself to chain.
+// path holds the profiles being resolved, to report inheritance cycles.
+func (s *FileLinkerService) resolveProfile(repoRoot string, name string, path []string, resolved map[string]bool, chain *[]string) error {
+	for i, visiting := range path {
+		if visiting == name {
+			return fmt.Errorf("profile %s inherits from itself: %s", name, strings.Join(append(path[i:], name), " -> "))
+		}
+	}
+	if resolved[name] {
+		return nil
+	}
+	if name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid profile name %q", name)
+	}
+	dir := filepath.Join(repoRoot, ProfilesDirName, name)
+	if !s.fs.DirectoryExists(dir) {
+		return fmt.Errorf("profile %s does not exist: %s", name, dir)
+	}
+
+	parents, err := s.loadProfileInherits(dir)
+	if err != nil {
+		return err
+	}
+	for _, parent := range parents {
+		if err := s.resolveProfile(repoRoot, parent, append(path, name), resolved, chain); err != nil {
+			return err
+		}
+	}
+	resolved[name] = true
+	*chain = append(*chain, name)
+	return nil
+}
+
+// loadProfileInherits reads the names of the profiles the profile in dir inherits from.
+// A missing file inherits nothing; blank lines and lines starting with '#' are skipped.
+func (s *FileLinkerService) loadProfileInherits(dir string) ([]string, error) {
+	path := filepath.Join(dir, ProfileInheritsFileName)
+	if !s.fs.FileExists(path) {
+		return nil, nil
+	}
+	lines, err := s.fs.ReadAllLines(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	var parents []string
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parents = append(parents, line)
+	}
+	return parents, nil
+}
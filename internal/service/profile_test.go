@@ -0,0 +1,215 @@
+package service
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/guitarrapc/dotfileslinker-go/internal/infrastructure"
+)
+
+func TestFileLinkerService_Profiles(t *testing.T) {
+	repoRoot := "/repo"
+	userHome := "/home/user"
+	ignoreFileName := ".ignore"
+	gitconfig := filepath.Join(userHome, ".gitconfig")
+	vimrc := filepath.Join(userHome, ".vimrc")
+	bashrc := filepath.Join(userHome, ".bashrc")
+
+	t.Run("Profile overrides the profiles it inherits", func(t *testing.T) {
+		// Repository where the work profile inherits from the common profile
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		layers := map[string][]string{
+			"HOME":                   {".bashrc", ".gitconfig"},
+			"profiles/common/HOME":   {".gitconfig", ".vimrc"},
+			"profiles/work/HOME":     {".gitconfig"},
+			"profiles/personal/HOME": {".bashrc"},
+		}
+		for dir, files := range layers {
+			fs.AddDirectory(filepath.Join(repoRoot, dir))
+			fs.AddDirectory(filepath.Dir(filepath.Join(repoRoot, dir)))
+			var paths []string
+			for _, file := range files {
+				path := filepath.Join(repoRoot, dir, file)
+				fs.AddFile(path, "# "+dir)
+				paths = append(paths, path)
+			}
+			fs.SetupFileEnumeration(filepath.Join(repoRoot, dir), "*", true, paths)
+		}
+		fs.AddFile(filepath.Join(repoRoot, "profiles", "work", ProfileInheritsFileName), "# shared settings\ncommon\n")
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.host = func() HostInfo { return HostInfo{OS: "linux"} }
+		service.SetProfile("work")
+
+		plan, err := service.Plan(repoRoot, userHome, ignoreFileName, LinkOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		sources, profiles := make(map[string]string), make(map[string]string)
+		for _, action := range plan.Actions {
+			if action.Kind == ActionLink {
+				sources[action.Target] = action.Source
+				profiles[action.Target] = action.Profile
+			}
+		}
+		expected := map[string]string{
+			gitconfig: filepath.Join(repoRoot, "profiles", "work", "HOME", ".gitconfig"),
+			vimrc:     filepath.Join(repoRoot, "profiles", "common", "HOME", ".vimrc"),
+			bashrc:    filepath.Join(repoRoot, "HOME", ".bashrc"),
+		}
+		if !reflect.DeepEqual(sources, expected) {
+			t.Errorf("Expected %v, got %v", expected, sources)
+		}
+		if profiles[gitconfig] != "work" || profiles[vimrc] != "common" || profiles[bashrc] != "" {
+			t.Errorf("Unexpected profiles %v", profiles)
+		}
+	})
+
+	t.Run("Without a profile only the base directories are linked", func(t *testing.T) {
+		// Repository where the work profile inherits from the common profile
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		layers := map[string][]string{
+			"HOME":                   {".bashrc", ".gitconfig"},
+			"profiles/common/HOME":   {".gitconfig", ".vimrc"},
+			"profiles/work/HOME":     {".gitconfig"},
+			"profiles/personal/HOME": {".bashrc"},
+		}
+		for dir, files := range layers {
+			fs.AddDirectory(filepath.Join(repoRoot, dir))
+			fs.AddDirectory(filepath.Dir(filepath.Join(repoRoot, dir)))
+			var paths []string
+			for _, file := range files {
+				path := filepath.Join(repoRoot, dir, file)
+				fs.AddFile(path, "# "+dir)
+				paths = append(paths, path)
+			}
+			fs.SetupFileEnumeration(filepath.Join(repoRoot, dir), "*", true, paths)
+		}
+		fs.AddFile(filepath.Join(repoRoot, "profiles", "work", ProfileInheritsFileName), "# shared settings\ncommon\n")
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.host = func() HostInfo { return HostInfo{OS: "linux"} }
+
+		plan, err := service.Plan(repoRoot, userHome, ignoreFileName, LinkOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		sources := make(map[string]string)
+		for _, action := range plan.Actions {
+			if action.Kind == ActionLink {
+				sources[action.Target] = action.Source
+			}
+		}
+		if len(sources) != 2 || sources[gitconfig] != filepath.Join(repoRoot, "HOME", ".gitconfig") {
+			t.Errorf("Unexpected sources %v", sources)
+		}
+	})
+
+	t.Run("Inherited profiles are resolved once, parents first", func(t *testing.T) {
+		// Repository where the work profile inherits from the common profile
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		layers := map[string][]string{
+			"HOME":                   {".bashrc", ".gitconfig"},
+			"profiles/common/HOME":   {".gitconfig", ".vimrc"},
+			"profiles/work/HOME":     {".gitconfig"},
+			"profiles/personal/HOME": {".bashrc"},
+		}
+		for dir, files := range layers {
+			fs.AddDirectory(filepath.Join(repoRoot, dir))
+			fs.AddDirectory(filepath.Dir(filepath.Join(repoRoot, dir)))
+			var paths []string
+			for _, file := range files {
+				path := filepath.Join(repoRoot, dir, file)
+				fs.AddFile(path, "# "+dir)
+				paths = append(paths, path)
+			}
+			fs.SetupFileEnumeration(filepath.Join(repoRoot, dir), "*", true, paths)
+		}
+		fs.AddFile(filepath.Join(repoRoot, "profiles", "work", ProfileInheritsFileName), "# shared settings\ncommon\n")
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.host = func() HostInfo { return HostInfo{OS: "linux"} }
+		fs.AddFile(filepath.Join(repoRoot, "profiles", "personal", ProfileInheritsFileName), "common\nwork\n")
+		service.SetProfile("personal")
+
+		chain, err := service.profileChain(repoRoot)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(chain, []string{"common", "work", "personal"}) {
+			t.Errorf("Unexpected chain %v", chain)
+		}
+	})
+
+	t.Run("Inheritance cycle is an error", func(t *testing.T) {
+		// Repository where the work profile inherits from the common profile
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		layers := map[string][]string{
+			"HOME":                   {".bashrc", ".gitconfig"},
+			"profiles/common/HOME":   {".gitconfig", ".vimrc"},
+			"profiles/work/HOME":     {".gitconfig"},
+			"profiles/personal/HOME": {".bashrc"},
+		}
+		for dir, files := range layers {
+			fs.AddDirectory(filepath.Join(repoRoot, dir))
+			fs.AddDirectory(filepath.Dir(filepath.Join(repoRoot, dir)))
+			var paths []string
+			for _, file := range files {
+				path := filepath.Join(repoRoot, dir, file)
+				fs.AddFile(path, "# "+dir)
+				paths = append(paths, path)
+			}
+			fs.SetupFileEnumeration(filepath.Join(repoRoot, dir), "*", true, paths)
+		}
+		fs.AddFile(filepath.Join(repoRoot, "profiles", "work", ProfileInheritsFileName), "# shared settings\ncommon\n")
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.host = func() HostInfo { return HostInfo{OS: "linux"} }
+		fs.AddFile(filepath.Join(repoRoot, "profiles", "common", ProfileInheritsFileName), "work\n")
+		service.SetProfile("work")
+
+		_, err := service.Plan(repoRoot, userHome, ignoreFileName, LinkOptions{})
+		if err == nil || !strings.Contains(err.Error(), "work -> common -> work") {
+			t.Fatalf("Expected a cycle error, got %v", err)
+		}
+	})
+
+	t.Run("Missing profile is an error", func(t *testing.T) {
+		// Repository where the work profile inherits from the common profile
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		layers := map[string][]string{
+			"HOME":                   {".bashrc", ".gitconfig"},
+			"profiles/common/HOME":   {".gitconfig", ".vimrc"},
+			"profiles/work/HOME":     {".gitconfig"},
+			"profiles/personal/HOME": {".bashrc"},
+		}
+		for dir, files := range layers {
+			fs.AddDirectory(filepath.Join(repoRoot, dir))
+			fs.AddDirectory(filepath.Dir(filepath.Join(repoRoot, dir)))
+			var paths []string
+			for _, file := range files {
+				path := filepath.Join(repoRoot, dir, file)
+				fs.AddFile(path, "# "+dir)
+				paths = append(paths, path)
+			}
+			fs.SetupFileEnumeration(filepath.Join(repoRoot, dir), "*", true, paths)
+		}
+		fs.AddFile(filepath.Join(repoRoot, "profiles", "work", ProfileInheritsFileName), "# shared settings\ncommon\n")
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.host = func() HostInfo { return HostInfo{OS: "linux"} }
+		service.SetProfile("server")
+
+		_, err := service.Plan(repoRoot, userHome, ignoreFileName, LinkOptions{})
+		if err == nil || !strings.Contains(err.Error(), "profile server does not exist") {
+			t.Fatalf("Expected a missing profile error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"github.com/guitarrapc/dotfileslinker-go/internal/util"
+)
+
+// StaleLink is a symbolic link into the repository whose source no longer exists.
+type StaleLink struct {
+	Target     string // Path of the symbolic link
+	LinkTarget string // Raw target of the symbolic link
+	Source     string // Path in the repository the link resolves to
+}
+
+// PruneResult reports what Prune removed.
+type PruneResult struct {
+	Removed     []string // Stale links removed (or that would be removed in dry-run mode)
+	Directories []string // Empty directories created by the tool that were removed
+}
+
+// FindStaleLinks finds symbolic links that point into repoRoot but whose source no longer exists.
+// It scans userHome, the mapped destinations (see pruneScanRoots), and every link recorded in the manifest.
+// Links inside the repository itself are never reported.
+func (s *FileLinkerService) FindStaleLinks(repoRoot string, userHome string, ignoreFileName string) ([]StaleLink, error) {
+	candidates := make(map[string]bool)
+
+	for _, root := range s.pruneScanRoots(repoRoot, userHome, ignoreFileName) {
+		if !s.fs.DirectoryExists(root) {
+			continue
+		}
+		s.logger.Verbose(fmt.Sprintf("Scanning for stale links: %s", root))
+		links, err := s.fs.EnumerateSymlinks(root)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", root, err)
+		}
+		for _, link := range links {
+			candidates[link] = true
+		}
+	}
+
+	manifest, err := s.LoadManifest()
+	if err != nil {
+		return nil, err
+	}
+	if state := manifest.Repository(repoRoot); state != nil {
+		for _, link := range state.Links {
+			candidates[link.Target] = true
+		}
+	}
+
+	var stale []StaleLink
+	for target := range candidates {
+		if util.IsSubPath(target, repoRoot) {
+			continue
+		}
+
+		linkTarget := s.fs.GetLinkTarget(target)
+		if linkTarget == "" {
+			continue
+		}
+		source := util.ResolveLinkTarget(target, linkTarget)
+		if !util.IsSubPath(source, repoRoot) {
+			continue
+		}
+		if s.fs.FileExists(source) || s.fs.DirectoryExists(source) || s.fs.GetLinkTarget(source) != "" {
+			continue
+		}
+
+		stale = append(stale, StaleLink{Target: target, LinkTarget: linkTarget, Source: source})
+	}
+
+	sort.Slice(stale, func(i, j int) bool { return stale[i].Target < stale[j].Target })
+	return stale, nil
+}
+
+// pruneScanRoots returns the directories to scan for stale links, without duplicates or nested roots.
+// The destination of each mapping with files is scanned, except a file system root such as the "/" of ROOT:
+// there only the directories below it that files are linked into are scanned, and links directly in the root
+// are found through the manifest.
+func (s *FileLinkerService) pruneScanRoots(repoRoot string, userHome string, ignoreFileName string) []string {
+	roots := []string{userHome}
+
+	mappings, err := s.loadMappings(repoRoot, userHome)
+	if err != nil {
+		s.logger.Verbose(fmt.Sprintf("Skipping mapped destinations: %s", err))
+		return roots
+	}
+	userIgnore := s.loadIgnoreList(filepath.Join(repoRoot, ignoreFileName))
+	for _, mapping := range mappings {
+		entries, err := s.collectLayers(repoRoot, mapping, userIgnore)
+		if err != nil {
+			s.logger.Verbose(fmt.Sprintf("Skipping %s destinations: %s", mapping.source, err))
+			continue
+		}
+		if len(entries) > 0 && !isFileSystemRoot(mapping.destination) {
+			roots = append(roots, mapping.destination)
+			continue
+		}
+		for _, entry := range entries {
+			if dir := filepath.Dir(entry.target); !isFileSystemRoot(dir) {
+				roots = append(roots, dir)
+			}
+		}
+	}
+
+	sort.Slice(roots, func(i, j int) bool { return len(roots[i]) < len(roots[j]) })
+	var result []string
+	for _, root := range roots {
+		nested := false
+		for _, kept := range result {
+			if util.IsSubPath(root, kept) {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			result = append(result, root)
+		}
+	}
+	return result
+}
+
+// Prune removes the given stale links, then the empty parent directories the tool created for them.
+// Links that changed since they were found are left alone.
+func (s *FileLinkerService) Prune(repoRoot string, stale []StaleLink, dryRun bool) (*PruneResult, error) {
+	manifest, err := s.LoadManifest()
+	if err != nil {
+		return nil, err
+	}
+	state := manifest.Repository(repoRoot)
+
+	result := &PruneResult{}
+	for _, link := range stale {
+		if s.fs.GetLinkTarget(link.Target) != link.LinkTarget {
+			s.logger.Verbose(fmt.Sprintf("Skipping %s: link changed since it was found", link.Target))
+			continue
+		}
+
+		if dryRun {
+			s.logger.Success(fmt.Sprintf("[DRY-RUN] Would remove stale symlink: %s -> %s", link.Target, link.LinkTarget))
+			result.Removed = append(result.Removed, link.Target)
+			continue
+		}
+
+		s.logger.Success(fmt.Sprintf("Removing stale symlink: %s -> %s", link.Target, link.LinkTarget))
+		if err := s.fs.Delete(link.Target); err != nil {
+			if saveErr := s.saveManifest(manifest); saveErr != nil {
+				s.logger.Error(saveErr.Error())
+			}
+			return result, fmt.Errorf("failed to remove stale symlink %s: %w", link.Target, err)
+		}
+		result.Removed = append(result.Removed, link.Target)
+
+		if state != nil {
+			state.removeLink(link.Target)
+			result.Directories = append(result.Directories, s.removeCreatedParents(state, filepath.Dir(link.Target))...)
+		}
+	}
+
+	if !dryRun && state != nil {
+		if err := s.saveManifest(manifest); err != nil {
+			return result, err
+		}
+	}
+
+	verb := "Removed"
+	if dryRun {
+		verb = "Would remove"
+	}
+	s.logger.Success(fmt.Sprintf("%s %d stale links and %d empty directories", verb, len(result.Removed), len(result.Directories)))
+	return result, nil
+}
+
+// removeCreatedParents deletes dir and its parents while they are empty and recorded as created by the tool.
+// It returns the directories that were removed.
+func (s *FileLinkerService) removeCreatedParents(state *RepositoryState, dir string) []string {
+	var removed []string
+	for slices.Contains(state.Directories, dir) {
+		if err := s.fs.Delete(dir); err != nil {
+			s.logger.Verbose(fmt.Sprintf("Keeping directory %s: %s", dir, err))
+			break
+		}
+		s.logger.Verbose(fmt.Sprintf("Removed empty directory: %s", dir))
+		state.removeDirectory(dir)
+		removed = append(removed, dir)
+		dir = filepath.Dir(dir)
+	}
+	return removed
+}
+
+// isFileSystemRoot reports whether path is the root of a file system, such as "/" or "C:\\".
+func isFileSystemRoot(path string) bool {
+	return filepath.Dir(path) == path
+}
@@ -0,0 +1,264 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/guitarrapc/dotfileslinker-go/internal/infrastructure"
+)
+
+func TestFileLinkerService_Prune(t *testing.T) {
+	repoRoot := "/repo"
+	userHome := "/home/user"
+	ignoreFileName := ".ignore"
+	manifestPath := "/state/dotfileslinker/manifest.json"
+
+	t.Run("Finds only dangling links into the repository", func(t *testing.T) {
+		// Repository that still contains .bashrc, with links for .bashrc and a removed HOME file
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# bashrc")
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+
+		fs.SymLinks[filepath.Join(userHome, ".bashrc")] = filepath.Join(repoRoot, ".bashrc")
+		fs.SymLinks[filepath.Join(userHome, ".config", "foo", "bar")] = filepath.Join(repoRoot, "HOME", ".config", "foo", "bar")
+		fs.AddDirectory(filepath.Join(userHome, ".config", "foo"))
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		// Dangling link to somewhere else
+		fs.SymLinks[filepath.Join(userHome, ".other")] = "/opt/removed"
+		// Dangling relative link into the repository
+		fs.SymLinks[filepath.Join(userHome, ".vimrc")] = "../../repo/.vimrc"
+		// Dangling link inside the repository itself
+		fs.SymLinks[filepath.Join(repoRoot, "HOME", ".broken")] = filepath.Join(repoRoot, "missing")
+
+		stale, err := service.FindStaleLinks(repoRoot, userHome, ignoreFileName)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if len(stale) != 2 {
+			t.Fatalf("Expected 2 stale links, got %+v", stale)
+		}
+		if stale[0].Target != filepath.Join(userHome, ".config", "foo", "bar") {
+			t.Errorf("Unexpected stale link: %+v", stale[0])
+		}
+		if stale[1].Target != filepath.Join(userHome, ".vimrc") || stale[1].Source != filepath.Join(repoRoot, ".vimrc") {
+			t.Errorf("Relative link was not resolved: %+v", stale[1])
+		}
+	})
+
+	t.Run("Finds links recorded in the manifest outside the scanned roots", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		target := "/etc/removed.conf"
+		fs.SymLinks[target] = filepath.Join(repoRoot, "ROOT", "etc", "removed.conf")
+
+		manifest, _ := service.LoadManifest()
+		manifest.repository(repoRoot).upsertLink(ManifestLink{Target: target, Source: fs.SymLinks[target], Kind: LinkKindFileSymlink})
+		if err := service.saveManifest(manifest); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		stale, err := service.FindStaleLinks(repoRoot, userHome, ignoreFileName)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		found := false
+		for _, link := range stale {
+			if link.Target == target {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Recorded link was not found: %+v", stale)
+		}
+	})
+
+	t.Run("Removes stale links and the empty directories created for them", func(t *testing.T) {
+		// Repository that still contains .bashrc, with links for .bashrc and a removed HOME file
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# bashrc")
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+
+		fs.SymLinks[filepath.Join(userHome, ".bashrc")] = filepath.Join(repoRoot, ".bashrc")
+		fs.SymLinks[filepath.Join(userHome, ".config", "foo", "bar")] = filepath.Join(repoRoot, "HOME", ".config", "foo", "bar")
+		fs.AddDirectory(filepath.Join(userHome, ".config", "foo"))
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		manifest, _ := service.LoadManifest()
+		state := manifest.repository(repoRoot)
+		state.addDirectory(filepath.Join(userHome, ".config"))
+		state.addDirectory(filepath.Join(userHome, ".config", "foo"))
+		state.upsertLink(ManifestLink{Target: filepath.Join(userHome, ".config", "foo", "bar"), Source: filepath.Join(repoRoot, "HOME", ".config", "foo", "bar")})
+		if err := service.saveManifest(manifest); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		stale, err := service.FindStaleLinks(repoRoot, userHome, ignoreFileName)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		result, err := service.Prune(repoRoot, stale, false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if len(result.Removed) != 1 || len(result.Directories) != 2 {
+			t.Errorf("Unexpected result: %+v", result)
+		}
+		if fs.GetLinkTarget(filepath.Join(userHome, ".config", "foo", "bar")) != "" {
+			t.Error("Stale link was not removed")
+		}
+		if fs.DirectoryExists(filepath.Join(userHome, ".config")) {
+			t.Error("Created directory was not removed")
+		}
+		if fs.GetLinkTarget(filepath.Join(userHome, ".bashrc")) == "" {
+			t.Error("Valid link was removed")
+		}
+
+		manifest, _ = service.LoadManifest()
+		state = manifest.Repository(repoRoot)
+		if len(state.Links) != 0 || len(state.Directories) != 0 {
+			t.Errorf("Expected an empty record, got %+v", state)
+		}
+	})
+
+	t.Run("Keeps directories that were not created by the tool", func(t *testing.T) {
+		// Repository that still contains .bashrc, with links for .bashrc and a removed HOME file
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# bashrc")
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+
+		fs.SymLinks[filepath.Join(userHome, ".bashrc")] = filepath.Join(repoRoot, ".bashrc")
+		fs.SymLinks[filepath.Join(userHome, ".config", "foo", "bar")] = filepath.Join(repoRoot, "HOME", ".config", "foo", "bar")
+		fs.AddDirectory(filepath.Join(userHome, ".config", "foo"))
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+
+		stale, err := service.FindStaleLinks(repoRoot, userHome, ignoreFileName)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := service.Prune(repoRoot, stale, false); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if !fs.DirectoryExists(filepath.Join(userHome, ".config", "foo")) {
+			t.Error("Directory not created by the tool was removed")
+		}
+	})
+
+	t.Run("Dry run does not remove anything", func(t *testing.T) {
+		// Repository that still contains .bashrc, with links for .bashrc and a removed HOME file
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# bashrc")
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+
+		fs.SymLinks[filepath.Join(userHome, ".bashrc")] = filepath.Join(repoRoot, ".bashrc")
+		fs.SymLinks[filepath.Join(userHome, ".config", "foo", "bar")] = filepath.Join(repoRoot, "HOME", ".config", "foo", "bar")
+		fs.AddDirectory(filepath.Join(userHome, ".config", "foo"))
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+
+		stale, err := service.FindStaleLinks(repoRoot, userHome, ignoreFileName)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		result, err := service.Prune(repoRoot, stale, true)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if len(result.Removed) != 1 {
+			t.Errorf("Expected 1 link to be reported, got %v", result.Removed)
+		}
+		if fs.GetLinkTarget(filepath.Join(userHome, ".config", "foo", "bar")) == "" {
+			t.Error("Stale link was removed in dry run mode")
+		}
+		if fs.FileExists(manifestPath) {
+			t.Error("Manifest was written in dry run mode")
+		}
+	})
+
+	t.Run("Skips links that changed since they were found", func(t *testing.T) {
+		// Repository that still contains .bashrc, with links for .bashrc and a removed HOME file
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# bashrc")
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+
+		fs.SymLinks[filepath.Join(userHome, ".bashrc")] = filepath.Join(repoRoot, ".bashrc")
+		fs.SymLinks[filepath.Join(userHome, ".config", "foo", "bar")] = filepath.Join(repoRoot, "HOME", ".config", "foo", "bar")
+		fs.AddDirectory(filepath.Join(userHome, ".config", "foo"))
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+
+		stale, err := service.FindStaleLinks(repoRoot, userHome, ignoreFileName)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		target := filepath.Join(userHome, ".config", "foo", "bar")
+		fs.SymLinks[target] = "/opt/elsewhere"
+
+		result, err := service.Prune(repoRoot, stale, false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(result.Removed) != 0 || fs.GetLinkTarget(target) == "" {
+			t.Error("Changed link was removed")
+		}
+	})
+
+	t.Run("File system root is not scanned for top-level ROOT files", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		rootDir := filepath.Join(repoRoot, "ROOT")
+		fs.AddFile(filepath.Join(rootDir, "foo"), "# foo")
+		fs.AddFile(filepath.Join(rootDir, "etc", "app.conf"), "# app")
+		fs.SetupFileEnumeration(rootDir, "*", true, []string{filepath.Join(rootDir, "foo"), filepath.Join(rootDir, "etc", "app.conf")})
+		fs.AddDirectory("/")
+		fs.AddDirectory("/etc")
+		fs.SetErrorForOperation("EnumerateSymlinks:/", errTest)
+		fs.SymLinks["/etc/removed.conf"] = filepath.Join(rootDir, "etc", "removed.conf")
+
+		stale, err := service.FindStaleLinks(repoRoot, userHome, ignoreFileName)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		found := false
+		for _, link := range stale {
+			if link.Target == "/etc/removed.conf" {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Directory below the root was not scanned: %+v", stale)
+		}
+	})
+
+	t.Run("Scan error is returned", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		fs.SetErrorForOperation("EnumerateSymlinks:"+userHome, errTest)
+
+		if _, err := service.FindStaleLinks(repoRoot, userHome, ignoreFileName); err == nil {
+			t.Fatal("Expected error when scanning fails")
+		}
+	})
+}
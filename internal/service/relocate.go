@@ -0,0 +1,183 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/guitarrapc/dotfileslinker-go/internal/util"
+)
+
+// RelocateResult reports what Relocate changed.
+type RelocateResult struct {
+	Relinked []string // Links and include directives rewritten to point into the new repository root (or that would be in dry-run mode)
+	Missing  []string // Links and include directives into the old root whose source does not exist under the new root; left alone
+}
+
+// Relocate repairs the links into a repository that was moved from oldRoot to newRoot.
+// Every symbolic link that resolves below oldRoot is rewritten to the same relative path below newRoot,
+// keeping relative links relative. The links are found the same way FindStaleLinks finds them:
+// by scanning userHome, the directories ROOT/ files of the new repository are linked into,
+// and the links recorded in the manifest for the old root. Include directives recorded for the old root
+// hold the absolute path of their source, so they are rewritten in the files that include them.
+// The manifest record of the old root moves to the new one.
+// Links whose source is missing under the new root are reported and left alone, so prune can remove them later.
+// If rewriting a link fails, the links rewritten so far are restored.
+// oldRoot: The directory the repository was moved away from.
+// newRoot: The directory the repository is now in.
+// userHome: The user's home directory path.
+// ignoreFileName: The name of the ignore file containing patterns to exclude.
+// dryRun: If true, only shows what would be done without changing any link.
+func (s *FileLinkerService) Relocate(oldRoot string, newRoot string, userHome string, ignoreFileName string, dryRun bool) (*RelocateResult, error) {
+	oldRoot, newRoot = filepath.Clean(oldRoot), filepath.Clean(newRoot)
+	if util.PathEquals(oldRoot, newRoot) {
+		return nil, fmt.Errorf("old and new repository roots are the same: %s", newRoot)
+	}
+	if !s.fs.DirectoryExists(newRoot) {
+		return nil, fmt.Errorf("new repository root %s does not exist", newRoot)
+	}
+
+	candidates := make(map[string]bool)
+	for _, root := range s.pruneScanRoots(newRoot, userHome, ignoreFileName) {
+		if !s.fs.DirectoryExists(root) {
+			continue
+		}
+		s.logger.Verbose(fmt.Sprintf("Scanning for links into %s: %s", oldRoot, root))
+		links, err := s.fs.EnumerateSymlinks(root)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", root, err)
+		}
+		for _, link := range links {
+			candidates[link] = true
+		}
+	}
+
+	manifest, err := s.LoadManifest()
+	if err != nil {
+		return nil, err
+	}
+	if state := manifest.Repository(oldRoot); state != nil {
+		for _, link := range state.Links {
+			candidates[link.Target] = true
+		}
+	}
+
+	targets := make([]string, 0, len(candidates))
+	for target := range candidates {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	result := &RelocateResult{}
+	plan := &Plan{RepoRoot: newRoot, UserHome: userHome, Options: LinkOptions{Conflict: ConflictOverwrite, DryRun: dryRun, RunID: s.newRunID()}}
+	for _, target := range targets {
+		if util.IsSubPath(target, oldRoot) || util.IsSubPath(target, newRoot) {
+			continue
+		}
+		linkTarget := s.fs.GetLinkTarget(target)
+		if linkTarget == "" {
+			continue
+		}
+		source := util.ResolveLinkTarget(target, linkTarget)
+		if !util.IsSubPath(source, oldRoot) {
+			continue
+		}
+
+		rel, err := filepath.Rel(oldRoot, source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to relocate %s: %w", target, err)
+		}
+		newSource := filepath.Join(newRoot, rel)
+		isDir := s.fs.DirectoryExists(newSource)
+		if !isDir && !s.fs.FileExists(newSource) && s.fs.GetLinkTarget(newSource) == "" {
+			s.logger.Error(fmt.Sprintf("Not relocating %s: %s does not exist", target, newSource))
+			result.Missing = append(result.Missing, target)
+			continue
+		}
+
+		plan.Actions = append(plan.Actions, Action{
+			Kind:     ActionReplace,
+			Source:   newSource,
+			Target:   target,
+			IsDir:    isDir,
+			Relative: !filepath.IsAbs(linkTarget),
+			Reason:   fmt.Sprintf("points into the old repository root %s", oldRoot),
+		})
+		result.Relinked = append(result.Relinked, target)
+	}
+
+	if state := manifest.Repository(oldRoot); state != nil {
+		for _, record := range state.Links {
+			if record.Kind != LinkKindIncluded || !util.IsSubPath(record.Source, oldRoot) {
+				continue
+			}
+			action, ok, err := s.relocateInclude(record, oldRoot, newRoot)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case !ok:
+				continue
+			case !s.fs.FileExists(action.Source):
+				s.logger.Error(fmt.Sprintf("Not relocating the include directive of %s: %s does not exist", action.Target, action.Source))
+				result.Missing = append(result.Missing, action.Target)
+				continue
+			}
+			plan.Actions = append(plan.Actions, action)
+			result.Relinked = append(result.Relinked, action.Target)
+		}
+	}
+
+	if dryRun {
+		for _, action := range plan.Actions {
+			if action.Include != "" {
+				s.logger.Success(fmt.Sprintf("[DRY-RUN] Would rewrite the %s include of %s -> %s", action.Include, action.Target, action.Source))
+				continue
+			}
+			s.logger.Success(fmt.Sprintf("[DRY-RUN] Would relink %s -> %s", action.Target, s.symlinkValue(action)))
+		}
+		s.logger.Success(fmt.Sprintf("Would relink %d links, %d sources missing", len(result.Relinked), len(result.Missing)))
+		return result, nil
+	}
+
+	if err := s.Apply(plan); err != nil {
+		return nil, err
+	}
+	manifest.relocate(oldRoot, newRoot)
+	if err := s.saveManifest(manifest); err != nil {
+		return result, fmt.Errorf("links were relocated but the manifest could not be updated: %w", err)
+	}
+	s.logger.Success(fmt.Sprintf("Relinked %d links, %d sources missing", len(result.Relinked), len(result.Missing)))
+	return result, nil
+}
+
+// relocateInclude plans rewriting the include directive of an included target from its source below oldRoot
+// to the same relative path below newRoot. It reports false when the target no longer includes the old source.
+func (s *FileLinkerService) relocateInclude(record ManifestLink, oldRoot string, newRoot string) (Action, bool, error) {
+	format, known := includeFormats[record.Format]
+	if !known || s.fs.GetLinkTarget(record.Target) != "" || !s.fs.FileExists(record.Target) {
+		return Action{}, false, nil
+	}
+	content, err := s.fs.ReadFile(record.Target)
+	if err != nil {
+		return Action{}, false, fmt.Errorf("failed to read including file %s: %w", record.Target, err)
+	}
+	if !hasInclude(string(content), format, record.Source) {
+		s.logger.Verbose(fmt.Sprintf("Skipping %s: include directive no longer exists", record.Target))
+		return Action{}, false, nil
+	}
+
+	rel, err := filepath.Rel(oldRoot, record.Source)
+	if err != nil {
+		return Action{}, false, fmt.Errorf("failed to relocate %s: %w", record.Target, err)
+	}
+	newSource := filepath.Join(newRoot, rel)
+	return Action{
+		Kind:    ActionReplace,
+		Source:  newSource,
+		Target:  record.Target,
+		Include: record.Format,
+		Content: addInclude(removeInclude(string(content), format, record.Source), format, newSource),
+		Reason:  fmt.Sprintf("include directive points into the old repository root %s", oldRoot),
+	}, true, nil
+}
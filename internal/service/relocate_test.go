@@ -0,0 +1,266 @@
+package service
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/guitarrapc/dotfileslinker-go/internal/infrastructure"
+)
+
+func TestFileLinkerService_Relocate(t *testing.T) {
+	oldRoot := "/home/user/dotfiles"
+	newRoot := "/home/user/src/dotfiles"
+	userHome := "/home/user"
+	ignoreFileName := ".ignore"
+	manifestPath := "/state/dotfileslinker/manifest.json"
+	bashrc := filepath.Join(userHome, ".bashrc")
+	nvim := filepath.Join(userHome, ".config", "nvim")
+	vimrc := filepath.Join(userHome, ".vimrc")
+
+	t.Run("Links into the old root are rewritten", func(t *testing.T) {
+		// Repository that was moved from oldRoot to newRoot, leaving absolute, directory and relative links behind
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(filepath.Join(userHome, ".config"))
+		fs.AddFile(filepath.Join(newRoot, ".bashrc"), "# bashrc")
+		fs.AddFile(filepath.Join(newRoot, ".vimrc"), "\" vimrc")
+		fs.AddDirectory(filepath.Join(newRoot, "HOME", ".config", "nvim"))
+
+		fs.SymLinks[bashrc] = filepath.Join(oldRoot, ".bashrc")
+		fs.SymLinks[nvim] = filepath.Join(oldRoot, "HOME", ".config", "nvim")
+		fs.SymLinks[vimrc] = "dotfiles/.vimrc"
+		fs.SymLinks[filepath.Join(userHome, ".other")] = "/opt/other"
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+
+		result, err := service.Relocate(oldRoot, newRoot, userHome, ignoreFileName, false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := map[string]string{
+			bashrc: filepath.Join(newRoot, ".bashrc"),
+			nvim:   filepath.Join(newRoot, "HOME", ".config", "nvim"),
+			vimrc:  filepath.Join("src", "dotfiles", ".vimrc"),
+		}
+		for target, linkTarget := range expected {
+			if fs.GetLinkTarget(target) != linkTarget {
+				t.Errorf("Expected %s -> %s, got %q", target, linkTarget, fs.GetLinkTarget(target))
+			}
+		}
+		if fs.GetLinkTarget(filepath.Join(userHome, ".other")) != "/opt/other" {
+			t.Error("Link outside the repository was changed")
+		}
+		if len(result.Relinked) != 3 || len(result.Missing) != 0 {
+			t.Errorf("Unexpected result: %+v", result)
+		}
+	})
+
+	t.Run("Dry run changes nothing", func(t *testing.T) {
+		// Repository that was moved from oldRoot to newRoot, leaving absolute, directory and relative links behind
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(filepath.Join(userHome, ".config"))
+		fs.AddFile(filepath.Join(newRoot, ".bashrc"), "# bashrc")
+		fs.AddFile(filepath.Join(newRoot, ".vimrc"), "\" vimrc")
+		fs.AddDirectory(filepath.Join(newRoot, "HOME", ".config", "nvim"))
+
+		fs.SymLinks[bashrc] = filepath.Join(oldRoot, ".bashrc")
+		fs.SymLinks[nvim] = filepath.Join(oldRoot, "HOME", ".config", "nvim")
+		fs.SymLinks[vimrc] = "dotfiles/.vimrc"
+		fs.SymLinks[filepath.Join(userHome, ".other")] = "/opt/other"
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+
+		result, err := service.Relocate(oldRoot, newRoot, userHome, ignoreFileName, true)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(result.Relinked) != 3 {
+			t.Errorf("Unexpected result: %+v", result)
+		}
+		if fs.GetLinkTarget(bashrc) != filepath.Join(oldRoot, ".bashrc") {
+			t.Error("Link was rewritten during a dry run")
+		}
+	})
+
+	t.Run("Links whose source is missing are left alone", func(t *testing.T) {
+		// Repository that was moved from oldRoot to newRoot, leaving absolute, directory and relative links behind
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(filepath.Join(userHome, ".config"))
+		fs.AddFile(filepath.Join(newRoot, ".bashrc"), "# bashrc")
+		fs.AddFile(filepath.Join(newRoot, ".vimrc"), "\" vimrc")
+		fs.AddDirectory(filepath.Join(newRoot, "HOME", ".config", "nvim"))
+
+		fs.SymLinks[bashrc] = filepath.Join(oldRoot, ".bashrc")
+		fs.SymLinks[nvim] = filepath.Join(oldRoot, "HOME", ".config", "nvim")
+		fs.SymLinks[vimrc] = "dotfiles/.vimrc"
+		fs.SymLinks[filepath.Join(userHome, ".other")] = "/opt/other"
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		removed := filepath.Join(userHome, ".zshrc")
+		fs.SymLinks[removed] = filepath.Join(oldRoot, ".zshrc")
+
+		result, err := service.Relocate(oldRoot, newRoot, userHome, ignoreFileName, false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(result.Missing) != 1 || result.Missing[0] != removed {
+			t.Errorf("Expected %s to be reported missing, got %+v", removed, result)
+		}
+		if fs.GetLinkTarget(removed) != filepath.Join(oldRoot, ".zshrc") {
+			t.Error("Link with a missing source was changed")
+		}
+	})
+
+	t.Run("Manifest record moves to the new root", func(t *testing.T) {
+		// Repository that was moved from oldRoot to newRoot, leaving absolute, directory and relative links behind
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(filepath.Join(userHome, ".config"))
+		fs.AddFile(filepath.Join(newRoot, ".bashrc"), "# bashrc")
+		fs.AddFile(filepath.Join(newRoot, ".vimrc"), "\" vimrc")
+		fs.AddDirectory(filepath.Join(newRoot, "HOME", ".config", "nvim"))
+
+		fs.SymLinks[bashrc] = filepath.Join(oldRoot, ".bashrc")
+		fs.SymLinks[nvim] = filepath.Join(oldRoot, "HOME", ".config", "nvim")
+		fs.SymLinks[vimrc] = "dotfiles/.vimrc"
+		fs.SymLinks[filepath.Join(userHome, ".other")] = "/opt/other"
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		target := "/etc/profile.d/custom.sh"
+		fs.AddFile(filepath.Join(newRoot, "ROOT", "etc", "profile.d", "custom.sh"), "# custom")
+		fs.SymLinks[target] = filepath.Join(oldRoot, "ROOT", "etc", "profile.d", "custom.sh")
+		manifest, _ := service.LoadManifest()
+		state := manifest.repository(oldRoot)
+		state.upsertLink(ManifestLink{Target: target, Source: fs.SymLinks[target], Kind: LinkKindFileSymlink})
+		state.addDirectory("/etc/profile.d")
+		if err := service.saveManifest(manifest); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if _, err := service.Relocate(oldRoot, newRoot, userHome, ignoreFileName, false); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if fs.GetLinkTarget(target) != filepath.Join(newRoot, "ROOT", "etc", "profile.d", "custom.sh") {
+			t.Errorf("Recorded link outside the scanned roots was not rewritten: %q", fs.GetLinkTarget(target))
+		}
+		manifest, _ = service.LoadManifest()
+		if manifest.Repository(oldRoot) != nil {
+			t.Error("Old root is still recorded")
+		}
+		moved := manifest.Repository(newRoot)
+		if moved == nil || moved.Link(target) == nil || moved.Link(target).Source != fs.GetLinkTarget(target) || len(moved.Directories) != 1 {
+			t.Errorf("Record was not moved to the new root: %+v", moved)
+		}
+	})
+
+	t.Run("Include directives into the old root are rewritten", func(t *testing.T) {
+		// Repository that was moved from oldRoot to newRoot, leaving absolute, directory and relative links behind
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(filepath.Join(userHome, ".config"))
+		fs.AddFile(filepath.Join(newRoot, ".bashrc"), "# bashrc")
+		fs.AddFile(filepath.Join(newRoot, ".vimrc"), "\" vimrc")
+		fs.AddDirectory(filepath.Join(newRoot, "HOME", ".config", "nvim"))
+
+		fs.SymLinks[bashrc] = filepath.Join(oldRoot, ".bashrc")
+		fs.SymLinks[nvim] = filepath.Join(oldRoot, "HOME", ".config", "nvim")
+		fs.SymLinks[vimrc] = "dotfiles/.vimrc"
+		fs.SymLinks[filepath.Join(userHome, ".other")] = "/opt/other"
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		gitconfig := filepath.Join(userHome, ".gitconfig")
+		tmuxConf := filepath.Join(userHome, ".tmux.conf")
+		local := "[credential]\n\thelper = store\n"
+		fs.AddFile(filepath.Join(newRoot, ".gitconfig"), "[alias]\n\tst = status\n")
+		fs.AddFile(gitconfig, local+"[include]\n\tpath = "+filepath.Join(oldRoot, ".gitconfig")+"\n")
+		fs.AddFile(tmuxConf, "source-file "+filepath.Join(oldRoot, ".tmux.conf")+"\n")
+		manifest, _ := service.LoadManifest()
+		state := manifest.repository(oldRoot)
+		state.upsertLink(ManifestLink{Target: gitconfig, Source: filepath.Join(oldRoot, ".gitconfig"), Kind: LinkKindIncluded, Format: "git"})
+		state.upsertLink(ManifestLink{Target: tmuxConf, Source: filepath.Join(oldRoot, ".tmux.conf"), Kind: LinkKindIncluded, Format: "tmux"})
+		if err := service.saveManifest(manifest); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		result, err := service.Relocate(oldRoot, newRoot, userHome, ignoreFileName, false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if expected := local + "[include]\n\tpath = " + filepath.Join(newRoot, ".gitconfig") + "\n"; fs.Files[gitconfig] != expected {
+			t.Errorf("Include directive was not rewritten: %q", fs.Files[gitconfig])
+		}
+		if fs.Files[tmuxConf] != "source-file "+filepath.Join(oldRoot, ".tmux.conf")+"\n" {
+			t.Errorf("Include directive with a missing source was changed: %q", fs.Files[tmuxConf])
+		}
+		if len(result.Relinked) != 4 || len(result.Missing) != 1 || result.Missing[0] != tmuxConf {
+			t.Errorf("Unexpected result: %+v", result)
+		}
+
+		unlinked, err := service.UnlinkDotfiles(newRoot, userHome, ignoreFileName, false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.Files[gitconfig] != local || !slices.Contains(unlinked.Removed, gitconfig) {
+			t.Errorf("Relocated include directive was not removed by unlink: %q", fs.Files[gitconfig])
+		}
+	})
+
+	t.Run("Failed rewrite restores every link", func(t *testing.T) {
+		// Repository that was moved from oldRoot to newRoot, leaving absolute, directory and relative links behind
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(filepath.Join(userHome, ".config"))
+		fs.AddFile(filepath.Join(newRoot, ".bashrc"), "# bashrc")
+		fs.AddFile(filepath.Join(newRoot, ".vimrc"), "\" vimrc")
+		fs.AddDirectory(filepath.Join(newRoot, "HOME", ".config", "nvim"))
+
+		fs.SymLinks[bashrc] = filepath.Join(oldRoot, ".bashrc")
+		fs.SymLinks[nvim] = filepath.Join(oldRoot, "HOME", ".config", "nvim")
+		fs.SymLinks[vimrc] = "dotfiles/.vimrc"
+		fs.SymLinks[filepath.Join(userHome, ".other")] = "/opt/other"
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		fs.SetErrorForOperation("CreateFileSymlink:"+vimrc, errTest)
+
+		if _, err := service.Relocate(oldRoot, newRoot, userHome, ignoreFileName, false); err == nil {
+			t.Fatal("Expected error")
+		}
+		if fs.GetLinkTarget(bashrc) != filepath.Join(oldRoot, ".bashrc") || fs.GetLinkTarget(vimrc) != "dotfiles/.vimrc" {
+			t.Errorf("Links were not restored: %v", fs.SymLinks)
+		}
+	})
+
+	t.Run("Missing new root is an error", func(t *testing.T) {
+		// Repository that was moved from oldRoot to newRoot, leaving absolute, directory and relative links behind
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddDirectory(filepath.Join(userHome, ".config"))
+		fs.AddFile(filepath.Join(newRoot, ".bashrc"), "# bashrc")
+		fs.AddFile(filepath.Join(newRoot, ".vimrc"), "\" vimrc")
+		fs.AddDirectory(filepath.Join(newRoot, "HOME", ".config", "nvim"))
+
+		fs.SymLinks[bashrc] = filepath.Join(oldRoot, ".bashrc")
+		fs.SymLinks[nvim] = filepath.Join(oldRoot, "HOME", ".config", "nvim")
+		fs.SymLinks[vimrc] = "dotfiles/.vimrc"
+		fs.SymLinks[filepath.Join(userHome, ".other")] = "/opt/other"
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+
+		if _, err := service.Relocate(oldRoot, "/nowhere", userHome, ignoreFileName, false); err == nil {
+			t.Fatal("Expected error")
+		}
+	})
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/guitarrapc/dotfileslinker-go/internal/util"
+)
+
+// LinkState classifies the current state of a target that LinkDotfiles would link.
+type LinkState int
+
+const (
+	// LinkStateLinked means the target is a symbolic link to the expected source,
+	// or an unchanged copy or hard link of it.
+	LinkStateLinked LinkState = iota
+	// LinkStateMissing means nothing exists at the target path.
+	LinkStateMissing
+	// LinkStateConflict means a regular file or directory occupies the target path.
+	LinkStateConflict
+	// LinkStateWrongTarget means the target is a symbolic link to a different existing path.
+	LinkStateWrongTarget
+	// LinkStateDangling means the target is a symbolic link whose destination does not exist.
+	LinkStateDangling
+	// LinkStateModified means the target is a copy or rendered template that was edited after it was written.
+	LinkStateModified
+	// LinkStateOutdated means the target is a copy whose source changed in the repository,
+	// or a rendered template whose output changed.
+	LinkStateOutdated
+	// LinkStateDiverged means the target is a copy or rendered template that changed both locally and in the repository.
+	LinkStateDiverged
+)
+
+// String returns the display name of the state.
+func (st LinkState) String() string {
+	switch st {
+	case LinkStateLinked:
+		return "linked"
+	case LinkStateMissing:
+		return "missing"
+	case LinkStateConflict:
+		return "conflict"
+	case LinkStateWrongTarget:
+		return "wrong-target"
+	case LinkStateDangling:
+		return "dangling"
+	case LinkStateModified:
+		return "modified"
+	case LinkStateOutdated:
+		return "outdated"
+	case LinkStateDiverged:
+		return "diverged"
+	default:
+		return "unknown"
+	}
+}
+
+// LinkStatus describes the state of a single planned link.
+type LinkStatus struct {
+	Source     string    // Path of the file in the repository
+	Target     string    // Path the file is linked to
+	State      LinkState // Classification of the target
+	LinkTarget string    // Current destination of the target when it is a symbolic link
+}
+
+// Status classifies every target that LinkDotfiles would link without modifying the file system.
+// Unlike a dry run, it does not stop at the first conflict.
+// repoRoot: The root directory of the dotfiles repository.
+// userHome: The user's home directory path.
+// ignoreFileName: The name of the ignore file containing patterns to exclude.
+func (s *FileLinkerService) Status(repoRoot string, userHome string, ignoreFileName string) ([]LinkStatus, error) {
+	ignorePath := filepath.Join(repoRoot, ignoreFileName)
+	userIgnore := s.loadIgnoreList(ignorePath)
+
+	entries, err := s.collectAll(repoRoot, userHome, userIgnore)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := s.LoadManifest()
+	if err != nil {
+		return nil, err
+	}
+	state := manifest.Repository(repoRoot)
+	entries, _ = s.foldEntries(entries, foldExisting)
+	renderer := s.newTemplateRenderer(repoRoot, userHome)
+	decrypter := s.newDecrypter()
+
+	statuses := make([]LinkStatus, 0, len(entries))
+	for _, entry := range entries {
+		if entry.ignored {
+			continue
+		}
+
+		if entry.rendered, err = s.generate(entry, renderer, decrypter); err != nil {
+			return nil, err
+		}
+		if entry.injected {
+			body, err := s.injectedBody(entry)
+			if err != nil {
+				return nil, err
+			}
+			status := s.classifyInjected(entry, body, state)
+			s.logger.Verbose(fmt.Sprintf("%s: %s -> %s", status.State, status.Target, status.Source))
+			statuses = append(statuses, status)
+			continue
+		}
+		if entry.include != "" {
+			status := s.classifyIncluded(entry)
+			s.logger.Verbose(fmt.Sprintf("%s: %s -> %s", status.State, status.Target, status.Source))
+			statuses = append(statuses, status)
+			continue
+		}
+		if entry.template || entry.encrypted {
+			status := s.classifyGenerated(entry, state)
+			s.logger.Verbose(fmt.Sprintf("%s: %s -> %s", status.State, status.Target, status.Source))
+			statuses = append(statuses, status)
+			continue
+		}
+
+		status := s.classifyTarget(entry)
+		if state != nil && status.State == LinkStateConflict {
+			if record := state.Link(entry.target); record != nil {
+				switch record.Kind {
+				case LinkKindCopy:
+					status.State = s.classifyCopy(record)
+				case LinkKindHardlink:
+					if same, err := s.fs.SameFile(entry.source, entry.target); err == nil && same {
+						status.State = LinkStateLinked
+					}
+				}
+			}
+		}
+		s.logger.Verbose(fmt.Sprintf("%s: %s -> %s", status.State, status.Target, status.Source))
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// classifyTarget determines the state of the target of a single entry.
+func (s *FileLinkerService) classifyTarget(entry linkEntry) LinkStatus {
+	status := LinkStatus{Source: entry.source, Target: entry.target}
+
+	linkTarget := s.fs.GetLinkTarget(entry.target)
+	if linkTarget == "" {
+		if s.fs.FileExists(entry.target) || s.fs.DirectoryExists(entry.target) {
+			status.State = LinkStateConflict
+		} else {
+			status.State = LinkStateMissing
+		}
+		return status
+	}
+
+	status.LinkTarget = linkTarget
+	resolved := util.ResolveLinkTarget(entry.target, linkTarget)
+	switch {
+	case util.PathEquals(resolved, entry.source):
+		status.State = LinkStateLinked
+	case !s.fs.FileExists(resolved) && !s.fs.DirectoryExists(resolved):
+		status.State = LinkStateDangling
+	default:
+		status.State = LinkStateWrongTarget
+	}
+	return status
+}
+
+// classifyCopy determines the state of a target that was deployed as a copy.
+// A copy that cannot be compared is reported as a conflict.
+func (s *FileLinkerService) classifyCopy(record *ManifestLink) LinkState {
+	drift, err := s.copyDrift(record)
+	if err != nil {
+		s.logger.Verbose(fmt.Sprintf("Cannot compare copy %s: %s", record.Target, err))
+		return LinkStateConflict
+	}
+	return driftState(drift)
+}
+
+// driftState returns the state reported for a copy or rendered file with the given drift.
+func driftState(drift CopyDrift) LinkState {
+	switch drift {
+	case CopyChangedInRepo:
+		return LinkStateOutdated
+	case CopyChangedLocally:
+		return LinkStateModified
+	case CopyChangedInBoth:
+		return LinkStateDiverged
+	default:
+		return LinkStateLinked
+	}
+}
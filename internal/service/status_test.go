@@ -0,0 +1,87 @@
+package service
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/guitarrapc/dotfileslinker-go/internal/infrastructure"
+)
+
+func TestFileLinkerService_Status(t *testing.T) {
+	repoRoot := "/repo"
+	userHome := "/home/user"
+	ignoreFileName := ".ignore"
+
+	fs := infrastructure.NewMockFileSystem()
+	logger := NewMockLogger()
+	service := NewFileLinkerService(fs, logger)
+
+	sources := []string{".linked", ".missing", ".conflict", ".wrong", ".dangling", ".relative"}
+	var enumerated []string
+	for _, name := range sources {
+		path := filepath.Join(repoRoot, name)
+		fs.AddFile(path, "# "+name)
+		enumerated = append(enumerated, path)
+	}
+	fs.SetupFileEnumeration(repoRoot, ".*", false, enumerated)
+
+	fs.SymLinks[filepath.Join(userHome, ".linked")] = filepath.Join(repoRoot, ".linked")
+	fs.AddFile(filepath.Join(userHome, ".conflict"), "# user file")
+	fs.AddFile("/opt/other", "# other file")
+	fs.SymLinks[filepath.Join(userHome, ".wrong")] = "/opt/other"
+	fs.SymLinks[filepath.Join(userHome, ".dangling")] = "/old/repo/.dangling"
+	fs.SymLinks[filepath.Join(userHome, ".relative")] = filepath.Join("..", "..", "repo", ".relative")
+
+	statuses, err := service.Status(repoRoot, userHome, ignoreFileName)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]LinkState{
+		".linked":   LinkStateLinked,
+		".missing":  LinkStateMissing,
+		".conflict": LinkStateConflict,
+		".wrong":    LinkStateWrongTarget,
+		".dangling": LinkStateDangling,
+		".relative": LinkStateLinked,
+	}
+
+	if len(statuses) != len(expected) {
+		t.Fatalf("Expected %d statuses, got %d", len(expected), len(statuses))
+	}
+	for _, status := range statuses {
+		name := filepath.Base(status.Target)
+		if status.State != expected[name] {
+			t.Errorf("%s: expected state %s, got %s", name, expected[name], status.State)
+		}
+	}
+
+	// Status must never modify the file system
+	for _, op := range fs.OperationLog {
+		for _, mutating := range []string{"Delete:", "CreateFileSymlink:", "CreateDirectorySymlink:", "EnsureDirectory:"} {
+			if strings.HasPrefix(op, mutating) {
+				t.Errorf("Status performed a mutating operation: %s", op)
+			}
+		}
+	}
+}
+
+func TestLinkState_String(t *testing.T) {
+	tests := map[LinkState]string{
+		LinkStateLinked:      "linked",
+		LinkStateMissing:     "missing",
+		LinkStateConflict:    "conflict",
+		LinkStateWrongTarget: "wrong-target",
+		LinkStateDangling:    "dangling",
+		LinkStateModified:    "modified",
+		LinkStateOutdated:    "outdated",
+		LinkStateDiverged:    "diverged",
+		LinkState(99):        "unknown",
+	}
+	for state, expected := range tests {
+		if state.String() != expected {
+			t.Errorf("LinkState(%d).String() = %q; want %q", int(state), state.String(), expected)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/guitarrapc/dotfileslinker-go/internal/util"
+)
+
+// targetPattern matches target paths. It is written relative to the home directory ("~/.ssh/*")
+// or as an absolute path ("/etc/sudoers.d/*"), with the wildcards of the ignore file.
+type targetPattern struct {
+	home     bool     // Whether the pattern is relative to the home directory rather than absolute
+	segments []string // Path segments of the pattern; "**" matches any number of segments
+}
+
+// parseTargetPattern parses a pattern that starts with "~/" or "/".
+func parseTargetPattern(pattern string) (targetPattern, error) {
+	slashed := filepath.ToSlash(pattern)
+	result := targetPattern{}
+	switch {
+	case strings.HasPrefix(slashed, "~/"):
+		result.home = true
+		slashed = strings.TrimPrefix(slashed, "~/")
+	case filepath.IsAbs(pattern) || strings.HasPrefix(slashed, "/"):
+		slashed = strings.TrimPrefix(slashed, "/")
+	default:
+		return result, fmt.Errorf("pattern %q must start with ~/ or /", pattern)
+	}
+	result.segments = strings.Split(strings.TrimSuffix(slashed, "/"), "/")
+	return result, nil
+}
+
+// matches reports whether the pattern matches path.
+func (p targetPattern) matches(path string, userHome string) bool {
+	if p.home {
+		if !util.IsSubPath(path, userHome) {
+			return false
+		}
+		rel, err := filepath.Rel(userHome, path)
+		if err != nil || rel == "." {
+			return false
+		}
+		path = rel
+	}
+	path = strings.TrimPrefix(filepath.ToSlash(path), "/")
+	return matchSegments(p.segments, strings.Split(path, "/"))
+}
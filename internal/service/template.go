@@ -0,0 +1,255 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+)
+
+// templateSuffix marks sources that are rendered with text/template instead of linked.
+// The rendered file is written to the target path without the suffix.
+const templateSuffix = ".tmpl"
+
+// TemplateDataFileName is the name of the JSON file in the repository root that defines template variables.
+// It is meant to stay untracked, so every machine can define its own values.
+const TemplateDataFileName = "dotfiles_data.json"
+
+// HostInfo describes the machine templates are rendered on.
+type HostInfo struct {
+	Hostname string // Name of the machine
+	OS       string // Operating system, as reported by runtime.GOOS
+	Arch     string // Architecture, as reported by runtime.GOARCH
+	Username string // Name of the current user
+}
+
+// currentHostInfo returns the description of the machine the process runs on.
+// Values that cannot be determined are left empty.
+func currentHostInfo() HostInfo {
+	info := HostInfo{OS: runtime.GOOS, Arch: runtime.GOARCH}
+	if hostname, err := os.Hostname(); err == nil {
+		info.Hostname = hostname
+	}
+	if current, err := user.Current(); err == nil {
+		info.Username = current.Username
+	}
+	return info
+}
+
+// TemplateData is the data templates are executed with, as in {{ .Hostname }} or {{ .Vars.email }}.
+type TemplateData struct {
+	Hostname string            // Name of the machine
+	OS       string            // Operating system, such as "linux", "darwin" or "windows"
+	Arch     string            // Architecture, such as "amd64" or "arm64"
+	Username string            // Name of the current user
+	Home     string            // The user's home directory
+	Env      map[string]string // Environment variables
+	Vars     map[string]any    // Variables defined in the data file
+}
+
+// loadTemplateData collects the data templates of the repository are executed with.
+// A missing data file leaves Vars empty; a data file that is not a JSON object is an error.
+func (s *FileLinkerService) loadTemplateData(repoRoot string, userHome string) (*TemplateData, error) {
+	host := s.host()
+	data := &TemplateData{
+		Hostname: host.Hostname,
+		OS:       host.OS,
+		Arch:     host.Arch,
+		Username: host.Username,
+		Home:     userHome,
+		Env:      make(map[string]string),
+		Vars:     make(map[string]any),
+	}
+	for _, variable := range s.environ() {
+		if name, value, found := strings.Cut(variable, "="); found && name != "" {
+			data.Env[name] = value
+		}
+	}
+
+	dataPath := filepath.Join(repoRoot, TemplateDataFileName)
+	if !s.fs.FileExists(dataPath) {
+		s.logger.Verbose(fmt.Sprintf("No template data file: %s", dataPath))
+		return data, nil
+	}
+	content, err := s.fs.ReadFile(dataPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template data %s: %w", dataPath, err)
+	}
+	if err := json.Unmarshal(content, &data.Vars); err != nil {
+		return nil, fmt.Errorf("failed to parse template data %s: %w", dataPath, err)
+	}
+	s.logger.Verbose(fmt.Sprintf("Loaded %d template variables from %s", len(data.Vars), dataPath))
+	return data, nil
+}
+
+// templateRenderer renders the templates of a repository.
+// The data is loaded on first use, so a broken data file only matters when there are templates.
+type templateRenderer struct {
+	s        *FileLinkerService
+	repoRoot string
+	userHome string
+	data     *TemplateData
+}
+
+// newTemplateRenderer creates a renderer for the templates of a repository.
+func (s *FileLinkerService) newTemplateRenderer(repoRoot string, userHome string) *templateRenderer {
+	return &templateRenderer{s: s, repoRoot: repoRoot, userHome: userHome}
+}
+
+// render executes the template at source. Referencing an undefined variable is an error.
+func (r *templateRenderer) render(source string) (string, error) {
+	content, err := r.s.fs.ReadFile(source)
+	if err != nil {
+		return "", fmt.Errorf("failed to read template %s: %w", source, err)
+	}
+	return r.renderContent(source, string(content))
+}
+
+// renderContent executes content as the template of source, such as the plaintext of an encrypted template.
+func (r *templateRenderer) renderContent(source string, content string) (string, error) {
+	if r.data == nil {
+		data, err := r.s.loadTemplateData(r.repoRoot, r.userHome)
+		if err != nil {
+			return "", err
+		}
+		r.data = data
+	}
+
+	tmpl, err := template.New(filepath.Base(source)).Option("missingkey=error").Parse(content)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template %s: %w", source, err)
+	}
+	var rendered strings.Builder
+	if err := tmpl.Execute(&rendered, r.data); err != nil {
+		return "", fmt.Errorf("failed to render template %s: %w", source, err)
+	}
+	return rendered.String(), nil
+}
+
+// markTemplates marks the entries whose source is a template and removes the suffix from their target.
+func (s *FileLinkerService) markTemplates(entries []linkEntry) {
+	for i := range entries {
+		name := filepath.Base(entries[i].target)
+		if !strings.HasSuffix(name, templateSuffix) || name == templateSuffix || s.fs.DirectoryExists(entries[i].source) {
+			continue
+		}
+		entries[i].template = true
+		entries[i].target = strings.TrimSuffix(entries[i].target, templateSuffix)
+	}
+}
+
+// generate returns the content written to the target of a template or encrypted entry, and nothing for other entries.
+// An encrypted template such as ".netrc.tmpl.age" is decrypted first and its plaintext rendered.
+func (s *FileLinkerService) generate(entry linkEntry, renderer *templateRenderer, decrypter *decrypter) (string, error) {
+	switch {
+	case entry.encrypted:
+		plaintext, err := decrypter.decrypt(entry.source)
+		if err != nil || !entry.template {
+			return plaintext, err
+		}
+		return renderer.renderContent(entry.source, plaintext)
+	case entry.template:
+		return renderer.render(entry.source)
+	default:
+		return "", nil
+	}
+}
+
+// generatedNouns returns how the written file and the content it is generated from are called in messages.
+func generatedNouns(encrypted bool) (string, string) {
+	if encrypted {
+		return "decrypted file", "decrypted source"
+	}
+	return "rendered file", "rendered template"
+}
+
+// planGenerated decides how a rendered template or decrypted source is written to its target.
+// The generated content is compared with the file on disk and with the hash recorded when it was last written:
+// content that changed is rewritten, while a file edited locally is a conflict, like an edited copy.
+func (s *FileLinkerService) planGenerated(action Action, opts LinkOptions, state *RepositoryState) (Action, error) {
+	file, origin := generatedNouns(action.Encrypted)
+	isRegularFile := s.fs.GetLinkTarget(action.Target) == "" && s.fs.FileExists(action.Target)
+	if !isRegularFile {
+		if s.fs.GetLinkTarget(action.Target) == "" && !s.fs.DirectoryExists(action.Target) {
+			action.Kind = ActionLink
+			action.Reason = "target does not exist"
+			return action, nil
+		}
+		return s.planConflict(action, s.describeExisting(action.Target), opts)
+	}
+
+	renderedHash := contentHash(action.Content)
+	targetHash, err := s.fs.FileHash(action.Target)
+	if err != nil {
+		return action, fmt.Errorf("failed to hash %s: %w", action.Target, err)
+	}
+	if targetHash == renderedHash {
+		action.Kind = ActionSkip
+		action.Reason = file + " is up to date"
+		return action, nil
+	}
+
+	var record *ManifestLink
+	if state != nil {
+		record = state.Link(action.Target)
+	}
+	if record == nil || record.Kind != manifestLinkKind(action) || record.Hash == "" {
+		return s.planConflict(action, "file that differs from the "+origin, opts)
+	}
+
+	drift := classifyDrift(record.Hash, renderedHash, targetHash)
+	if drift == CopyChangedInRepo {
+		action.Kind = ActionReplace
+		action.Reason = "rendered output changed"
+		if action.Encrypted {
+			action.Reason = "encrypted source changed"
+		}
+		return action, nil
+	}
+	s.logger.Verbose(fmt.Sprintf("%s: %s %s", action.Target, file, drift))
+	return s.planConflict(action, fmt.Sprintf("%s %s", file, drift), opts)
+}
+
+// classifyGenerated determines the state of the target of a template or encrypted entry
+// by comparing the generated content with the disk.
+func (s *FileLinkerService) classifyGenerated(entry linkEntry, state *RepositoryState) LinkStatus {
+	status := s.classifyTarget(entry)
+	if status.State != LinkStateConflict || s.fs.DirectoryExists(entry.target) {
+		return status
+	}
+
+	renderedHash := contentHash(entry.rendered)
+	targetHash, err := s.fs.FileHash(entry.target)
+	if err != nil {
+		file, _ := generatedNouns(entry.encrypted)
+		s.logger.Verbose(fmt.Sprintf("Cannot compare %s %s: %s", file, entry.target, err))
+		return status
+	}
+	if targetHash == renderedHash {
+		status.State = LinkStateLinked
+		return status
+	}
+
+	if state != nil {
+		kind := LinkKindTemplate
+		if entry.encrypted {
+			kind = LinkKindEncrypted
+		}
+		if record := state.Link(entry.target); record != nil && record.Kind == kind && record.Hash != "" {
+			status.State = driftState(classifyDrift(record.Hash, renderedHash, targetHash))
+		}
+	}
+	return status
+}
+
+// contentHash returns the hex-encoded SHA-256 hash of content, in the same form as FileSystem.FileHash.
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
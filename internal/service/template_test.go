@@ -0,0 +1,369 @@
+package service
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/guitarrapc/dotfileslinker-go/internal/infrastructure"
+)
+
+func TestFileLinkerService_Templates(t *testing.T) {
+	repoRoot := "/repo"
+	userHome := "/home/user"
+	ignoreFileName := ".ignore"
+	manifestPath := "/state/dotfileslinker/manifest.json"
+	source := filepath.Join(repoRoot, ".gitconfig.tmpl")
+	target := filepath.Join(userHome, ".gitconfig")
+	dataPath := filepath.Join(repoRoot, TemplateDataFileName)
+
+	expected := "[user]\n\temail = me@example.com\n# alice@workstation linux/amd64 /home/user vim\n"
+
+	t.Run("Template is rendered without its suffix", func(t *testing.T) {
+		// Repository with a single template and machine-specific data
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "[user]\n\temail = {{ .Vars.email }}\n# {{ .Username }}@{{ .Hostname }} {{ .OS }}/{{ .Arch }} {{ .Home }} {{ .Env.EDITOR }}\n")
+		fs.AddFile(dataPath, `{"email": "me@example.com"}`)
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		service.host = func() HostInfo {
+			return HostInfo{Hostname: "workstation", OS: "linux", Arch: "amd64", Username: "alice"}
+		}
+		service.environ = func() []string { return []string{"EDITOR=vim", "=C:=ignored"} }
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if fs.Files[target] != expected {
+			t.Errorf("Rendered file has unexpected content %q", fs.Files[target])
+		}
+		if fs.GetLinkTarget(target) != "" {
+			t.Error("A symlink was created for a template")
+		}
+		if fs.FileExists(filepath.Join(userHome, ".gitconfig.tmpl")) {
+			t.Error("Template was deployed with its suffix")
+		}
+
+		manifest, _ := service.LoadManifest()
+		record := manifest.Repository(repoRoot).Link(target)
+		if record == nil || record.Kind != LinkKindTemplate || record.Hash != contentHash(expected) {
+			t.Errorf("Rendered file was not recorded with its hash: %+v", record)
+		}
+		if statuses, err := service.Status(repoRoot, userHome, ignoreFileName); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		} else if len(statuses) != 1 || statuses[0].State != LinkStateLinked {
+			t.Errorf("Expected linked, got %+v", statuses)
+		}
+	})
+
+	t.Run("Rendered file that is up to date is skipped", func(t *testing.T) {
+		// Repository with a single template and machine-specific data
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "[user]\n\temail = {{ .Vars.email }}\n# {{ .Username }}@{{ .Hostname }} {{ .OS }}/{{ .Arch }} {{ .Home }} {{ .Env.EDITOR }}\n")
+		fs.AddFile(dataPath, `{"email": "me@example.com"}`)
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		service.host = func() HostInfo {
+			return HostInfo{Hostname: "workstation", OS: "linux", Arch: "amd64", Username: "alice"}
+		}
+		service.environ = func() []string { return []string{"EDITOR=vim", "=C:=ignored"} }
+		fs.AddFile(target, expected)
+
+		plan, err := service.Plan(repoRoot, userHome, ignoreFileName, LinkOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if plan.Actions[0].Kind != ActionSkip {
+			t.Errorf("Expected skip, got %+v", plan.Actions[0])
+		}
+	})
+
+	t.Run("Changed output is shown and rewritten", func(t *testing.T) {
+		// Repository with a single template and machine-specific data
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "[user]\n\temail = {{ .Vars.email }}\n# {{ .Username }}@{{ .Hostname }} {{ .OS }}/{{ .Arch }} {{ .Home }} {{ .Env.EDITOR }}\n")
+		fs.AddFile(dataPath, `{"email": "me@example.com"}`)
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		service.host = func() HostInfo {
+			return HostInfo{Hostname: "workstation", OS: "linux", Arch: "amd64", Username: "alice"}
+		}
+		service.environ = func() []string { return []string{"EDITOR=vim", "=C:=ignored"} }
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		fs.AddFile(dataPath, `{"email": "work@example.com"}`)
+
+		if statuses, err := service.Status(repoRoot, userHome, ignoreFileName); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		} else if len(statuses) != 1 || statuses[0].State != LinkStateOutdated {
+			t.Errorf("Expected outdated, got %+v", statuses)
+		}
+		plan, err := service.Plan(repoRoot, userHome, ignoreFileName, LinkOptions{DryRun: true})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if plan.Actions[0].Kind != ActionReplace || plan.Actions[0].Reason != "rendered output changed" {
+			t.Errorf("Unexpected action: %+v", plan.Actions[0])
+		}
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.Contains(fs.Files[target], "work@example.com") {
+			t.Errorf("Rendered file was not rewritten, got %q", fs.Files[target])
+		}
+	})
+
+	t.Run("Rendered file edited locally is a conflict", func(t *testing.T) {
+		// Repository with a single template and machine-specific data
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "[user]\n\temail = {{ .Vars.email }}\n# {{ .Username }}@{{ .Hostname }} {{ .OS }}/{{ .Arch }} {{ .Home }} {{ .Env.EDITOR }}\n")
+		fs.AddFile(dataPath, `{"email": "me@example.com"}`)
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		service.host = func() HostInfo {
+			return HostInfo{Hostname: "workstation", OS: "linux", Arch: "amd64", Username: "alice"}
+		}
+		service.environ = func() []string { return []string{"EDITOR=vim", "=C:=ignored"} }
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		fs.AddFile(target, "# edited")
+
+		if statuses, err := service.Status(repoRoot, userHome, ignoreFileName); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		} else if len(statuses) != 1 || statuses[0].State != LinkStateModified {
+			t.Errorf("Expected modified, got %+v", statuses)
+		}
+		err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{})
+		if err == nil || !strings.Contains(err.Error(), "rendered file changed locally") {
+			t.Fatalf("Expected a local change conflict, got %v", err)
+		}
+		if fs.Files[target] != "# edited" {
+			t.Error("Local change was overwritten")
+		}
+	})
+
+	t.Run("Unmanaged file with other content is a conflict", func(t *testing.T) {
+		// Repository with a single template and machine-specific data
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "[user]\n\temail = {{ .Vars.email }}\n# {{ .Username }}@{{ .Hostname }} {{ .OS }}/{{ .Arch }} {{ .Home }} {{ .Env.EDITOR }}\n")
+		fs.AddFile(dataPath, `{"email": "me@example.com"}`)
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		service.host = func() HostInfo {
+			return HostInfo{Hostname: "workstation", OS: "linux", Arch: "amd64", Username: "alice"}
+		}
+		service.environ = func() []string { return []string{"EDITOR=vim", "=C:=ignored"} }
+		fs.AddFile(target, "# hand written")
+
+		if statuses, err := service.Status(repoRoot, userHome, ignoreFileName); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		} else if len(statuses) != 1 || statuses[0].State != LinkStateConflict {
+			t.Errorf("Expected conflict, got %+v", statuses)
+		}
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err == nil {
+			t.Fatal("Expected a conflict error")
+		}
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{Conflict: ConflictOverwrite}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.Files[target] != expected {
+			t.Errorf("File was not replaced by the rendered template, got %q", fs.Files[target])
+		}
+	})
+
+	t.Run("Undefined variable is an error", func(t *testing.T) {
+		// Repository with a single template and machine-specific data
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "[user]\n\temail = {{ .Vars.email }}\n# {{ .Username }}@{{ .Hostname }} {{ .OS }}/{{ .Arch }} {{ .Home }} {{ .Env.EDITOR }}\n")
+		fs.AddFile(dataPath, `{"email": "me@example.com"}`)
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		service.host = func() HostInfo {
+			return HostInfo{Hostname: "workstation", OS: "linux", Arch: "amd64", Username: "alice"}
+		}
+		service.environ = func() []string { return []string{"EDITOR=vim", "=C:=ignored"} }
+		fs.AddFile(dataPath, `{}`)
+
+		err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{})
+		if err == nil || !strings.Contains(err.Error(), source) {
+			t.Fatalf("Expected a render error naming the template, got %v", err)
+		}
+		if fs.FileExists(target) {
+			t.Error("Target was written despite the render error")
+		}
+	})
+
+	t.Run("Invalid data file is an error", func(t *testing.T) {
+		// Repository with a single template and machine-specific data
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "[user]\n\temail = {{ .Vars.email }}\n# {{ .Username }}@{{ .Hostname }} {{ .OS }}/{{ .Arch }} {{ .Home }} {{ .Env.EDITOR }}\n")
+		fs.AddFile(dataPath, `{"email": "me@example.com"}`)
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		service.host = func() HostInfo {
+			return HostInfo{Hostname: "workstation", OS: "linux", Arch: "amd64", Username: "alice"}
+		}
+		service.environ = func() []string { return []string{"EDITOR=vim", "=C:=ignored"} }
+		fs.AddFile(dataPath, `["not", "an", "object"]`)
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err == nil || !strings.Contains(err.Error(), TemplateDataFileName) {
+			t.Fatalf("Expected a data file error, got %v", err)
+		}
+	})
+
+	t.Run("Data file is optional", func(t *testing.T) {
+		// Repository with a single template and machine-specific data
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "[user]\n\temail = {{ .Vars.email }}\n# {{ .Username }}@{{ .Hostname }} {{ .OS }}/{{ .Arch }} {{ .Home }} {{ .Env.EDITOR }}\n")
+		fs.AddFile(dataPath, `{"email": "me@example.com"}`)
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		service.host = func() HostInfo {
+			return HostInfo{Hostname: "workstation", OS: "linux", Arch: "amd64", Username: "alice"}
+		}
+		service.environ = func() []string { return []string{"EDITOR=vim", "=C:=ignored"} }
+		fs.AddFile(source, "{{ .OS }}")
+		delete(fs.Files, dataPath)
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.Files[target] != "linux" {
+			t.Errorf("Unexpected content %q", fs.Files[target])
+		}
+	})
+
+	t.Run("Unlink removes unchanged rendered files and keeps edited ones", func(t *testing.T) {
+		// Repository with a single template and machine-specific data
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "[user]\n\temail = {{ .Vars.email }}\n# {{ .Username }}@{{ .Hostname }} {{ .OS }}/{{ .Arch }} {{ .Home }} {{ .Env.EDITOR }}\n")
+		fs.AddFile(dataPath, `{"email": "me@example.com"}`)
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		service.host = func() HostInfo {
+			return HostInfo{Hostname: "workstation", OS: "linux", Arch: "amd64", Username: "alice"}
+		}
+		service.environ = func() []string { return []string{"EDITOR=vim", "=C:=ignored"} }
+		other := filepath.Join(repoRoot, ".npmrc.tmpl")
+		fs.AddFile(other, "email={{ .Vars.email }}")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source, other})
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		fs.AddFile(filepath.Join(userHome, ".npmrc"), "# edited")
+
+		result, err := service.UnlinkDotfiles(repoRoot, userHome, ignoreFileName, false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.FileExists(target) {
+			t.Error("Unchanged rendered file was not removed")
+		}
+		if !fs.FileExists(filepath.Join(userHome, ".npmrc")) {
+			t.Error("Edited rendered file was removed")
+		}
+		if len(result.Removed) != 1 || len(result.Modified) != 1 {
+			t.Errorf("Unexpected result: %+v", result)
+		}
+	})
+
+	t.Run("Restore replaces the unchanged rendered file with the original", func(t *testing.T) {
+		// Repository with a single template and machine-specific data
+		backupDir := "/state/dotfileslinker/backups"
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "[user]\n\temail = {{ .Vars.email }}\n# {{ .Username }}@{{ .Hostname }} {{ .OS }}/{{ .Arch }} {{ .Home }} {{ .Env.EDITOR }}\n")
+		fs.AddFile(dataPath, `{"email": "me@example.com"}`)
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		service.host = func() HostInfo {
+			return HostInfo{Hostname: "workstation", OS: "linux", Arch: "amd64", Username: "alice"}
+		}
+		service.environ = func() []string { return []string{"EDITOR=vim", "=C:=ignored"} }
+		fs.AddFile(target, "# hand written")
+
+		opts := LinkOptions{Conflict: ConflictBackup, BackupDir: backupDir, RunID: "run1"}
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, opts); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.Files[target] != expected {
+			t.Fatalf("Template was not rendered over the backed up file: %q", fs.Files[target])
+		}
+
+		result, err := service.Restore(repoRoot, backupDir, "run1", false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(result.Restored) != 1 || fs.Files[target] != "# hand written" {
+			t.Errorf("Original file was not restored over the rendered file: %+v, %q", result, fs.Files[target])
+		}
+	})
+
+	t.Run("Directories with templates are not folded", func(t *testing.T) {
+		// Repository with a single template and machine-specific data
+		fs := infrastructure.NewMockFileSystem()
+		fs.AddDirectory(userHome)
+		fs.AddFile(source, "[user]\n\temail = {{ .Vars.email }}\n# {{ .Username }}@{{ .Hostname }} {{ .OS }}/{{ .Arch }} {{ .Home }} {{ .Env.EDITOR }}\n")
+		fs.AddFile(dataPath, `{"email": "me@example.com"}`)
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{source})
+
+		service := NewFileLinkerService(fs, NewMockLogger())
+		service.SetManifestPath(manifestPath)
+		service.host = func() HostInfo {
+			return HostInfo{Hostname: "workstation", OS: "linux", Arch: "amd64", Username: "alice"}
+		}
+		service.environ = func() []string { return []string{"EDITOR=vim", "=C:=ignored"} }
+		dir := filepath.Join(repoRoot, "HOME", ".config", "git")
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+		fs.AddFile(filepath.Join(dir, "config.tmpl"), "{{ .Hostname }}")
+		fs.AddFile(filepath.Join(dir, "ignore"), "*.swp")
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, []string{
+			filepath.Join(dir, "config.tmpl"),
+			filepath.Join(dir, "ignore"),
+		})
+
+		if err := service.LinkDotfilesWithOptions(repoRoot, userHome, ignoreFileName, LinkOptions{Fold: true}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fs.Files[filepath.Join(userHome, ".config", "git", "config")] != "workstation" {
+			t.Error("Template in HOME was not rendered")
+		}
+		if fs.GetLinkTarget(filepath.Join(userHome, ".config", "git", "ignore")) != filepath.Join(dir, "ignore") {
+			t.Error("File next to the template was not linked")
+		}
+	})
+}
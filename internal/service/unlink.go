@@ -0,0 +1,233 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"github.com/guitarrapc/dotfileslinker-go/internal/util"
+)
+
+// UnlinkResult summarizes the targets visited by UnlinkDotfiles.
+type UnlinkResult struct {
+	Removed      []string // Links into the repository that were removed (or would be in dry-run mode)
+	NotLinked    []string // Targets that do not exist or are regular files or directories
+	ForeignLinks []string // Symbolic links that point outside the repository
+	Modified     []string // Copies, rendered templates and hard links that no longer match their source and are kept
+}
+
+// UnlinkDotfiles removes the links LinkDotfiles created from the repository.
+// When the manifest records links for the repository, those targets are visited and the directories
+// created for them are removed once empty; otherwise the targets LinkDotfiles would create are visited.
+// Only targets that are symbolic links resolving into repoRoot are deleted;
+// regular files, directories and links pointing elsewhere are left untouched.
+// repoRoot: The root directory of the dotfiles repository.
+// userHome: The user's home directory path.
+// ignoreFileName: The name of the ignore file containing patterns to exclude.
+// dryRun: If true, only shows what would be done without actually removing links.
+func (s *FileLinkerService) UnlinkDotfiles(repoRoot string, userHome string, ignoreFileName string, dryRun bool) (*UnlinkResult, error) {
+	if dryRun {
+		s.logger.Info("DRY RUN MODE: No links will be actually removed")
+	}
+
+	s.logger.Info(fmt.Sprintf("Starting to unlink dotfiles of %s from %s", repoRoot, userHome))
+
+	manifest, err := s.LoadManifest()
+	if err != nil {
+		return nil, err
+	}
+	state := manifest.Repository(repoRoot)
+
+	var entries []linkEntry
+	if state != nil && len(state.Links) > 0 {
+		s.logger.Verbose(fmt.Sprintf("Using %d links recorded in the manifest", len(state.Links)))
+		for _, link := range state.Links {
+			entries = append(entries, linkEntry{source: link.Source, target: link.Target})
+		}
+	} else {
+		ignorePath := filepath.Join(repoRoot, ignoreFileName)
+		userIgnore := s.loadIgnoreList(ignorePath)
+		if entries, err = s.collectAll(repoRoot, userHome, userIgnore); err != nil {
+			return nil, err
+		}
+		entries, _ = s.foldEntries(entries, foldExisting)
+	}
+
+	result := &UnlinkResult{}
+	for _, entry := range entries {
+		if entry.ignored {
+			continue
+		}
+
+		if state != nil {
+			if record := state.Link(entry.target); record != nil && (record.Kind.hashed() || record.Kind == LinkKindHardlink || record.Kind == LinkKindInjected || record.Kind == LinkKindIncluded) {
+				unlink := s.unlinkCopy
+				switch record.Kind {
+				case LinkKindHardlink:
+					unlink = s.unlinkHardlink
+				case LinkKindInjected:
+					unlink = s.unlinkInjected
+				case LinkKindIncluded:
+					unlink = s.unlinkIncluded
+				}
+				if err := unlink(record, state, result, dryRun); err != nil {
+					if saveErr := s.saveManifest(manifest); saveErr != nil {
+						s.logger.Error(saveErr.Error())
+					}
+					return result, err
+				}
+				continue
+			}
+		}
+
+		linkTarget := s.fs.GetLinkTarget(entry.target)
+		if linkTarget == "" {
+			s.logger.Verbose(fmt.Sprintf("Skipping %s: not a symbolic link", entry.target))
+			result.NotLinked = append(result.NotLinked, entry.target)
+			if state != nil && !dryRun {
+				state.removeLink(entry.target)
+			}
+			continue
+		}
+
+		resolved := util.ResolveLinkTarget(entry.target, linkTarget)
+		if !util.IsSubPath(resolved, repoRoot) {
+			s.logger.Verbose(fmt.Sprintf("Skipping %s: links outside the repository (%s)", entry.target, linkTarget))
+			result.ForeignLinks = append(result.ForeignLinks, entry.target)
+			if state != nil && !dryRun {
+				state.removeLink(entry.target)
+			}
+			continue
+		}
+
+		if dryRun {
+			s.logger.Success(fmt.Sprintf("[DRY-RUN] Would remove symlink: %s -> %s", entry.target, linkTarget))
+		} else {
+			s.logger.Success(fmt.Sprintf("Removing symlink: %s -> %s", entry.target, linkTarget))
+			if err := s.fs.Delete(entry.target); err != nil {
+				if saveErr := s.saveManifest(manifest); saveErr != nil {
+					s.logger.Error(saveErr.Error())
+				}
+				return result, fmt.Errorf("failed to remove symlink %s: %w", entry.target, err)
+			}
+			if state != nil {
+				state.removeLink(entry.target)
+			}
+		}
+		result.Removed = append(result.Removed, entry.target)
+	}
+
+	if state != nil && !dryRun {
+		s.removeCreatedDirectories(state)
+		if err := s.saveManifest(manifest); err != nil {
+			return result, err
+		}
+	}
+
+	verb := "Removed"
+	if dryRun {
+		verb = "Would remove"
+	}
+	s.logger.Success(fmt.Sprintf("%s %d links, skipped %d targets that are not links and %d links outside the repository",
+		verb, len(result.Removed), len(result.NotLinked), len(result.ForeignLinks)))
+	if len(result.Modified) > 0 {
+		s.logger.Error(fmt.Sprintf("Kept %d copies, rendered templates or hard links that no longer match their source", len(result.Modified)))
+	}
+
+	return result, nil
+}
+
+// unlinkCopy removes a copy, rendered template or decrypted file recorded in the manifest unless it was edited after it was written.
+func (s *FileLinkerService) unlinkCopy(record *ManifestLink, state *RepositoryState, result *UnlinkResult, dryRun bool) error {
+	target := record.Target
+	noun := "copy"
+	switch record.Kind {
+	case LinkKindTemplate:
+		noun = "rendered file"
+	case LinkKindEncrypted:
+		noun = "decrypted file"
+	}
+	if s.fs.GetLinkTarget(target) != "" || !s.fs.FileExists(target) {
+		s.logger.Verbose(fmt.Sprintf("Skipping %s: %s no longer exists", target, noun))
+		result.NotLinked = append(result.NotLinked, target)
+		if !dryRun {
+			state.removeLink(target)
+		}
+		return nil
+	}
+
+	hash, err := s.fs.FileHash(target)
+	if err != nil {
+		return fmt.Errorf("failed to hash %s %s: %w", noun, target, err)
+	}
+	if hash != record.Hash {
+		s.logger.Error(fmt.Sprintf("Keeping %s: %s was changed locally", target, noun))
+		result.Modified = append(result.Modified, target)
+		return nil
+	}
+
+	if dryRun {
+		s.logger.Success(fmt.Sprintf("[DRY-RUN] Would remove %s: %s", noun, target))
+	} else {
+		s.logger.Success(fmt.Sprintf("Removing %s: %s", noun, target))
+		if err := s.fs.Delete(target); err != nil {
+			return fmt.Errorf("failed to remove %s %s: %w", noun, target, err)
+		}
+		state.removeLink(target)
+	}
+	result.Removed = append(result.Removed, target)
+	return nil
+}
+
+// unlinkHardlink removes a hard link recorded in the manifest while it is still the same file as its source.
+// A target that is no longer linked to the source holds the only copy of its content, so it is kept.
+func (s *FileLinkerService) unlinkHardlink(record *ManifestLink, state *RepositoryState, result *UnlinkResult, dryRun bool) error {
+	target := record.Target
+	if s.fs.GetLinkTarget(target) != "" || !s.fs.FileExists(target) {
+		s.logger.Verbose(fmt.Sprintf("Skipping %s: hard link no longer exists", target))
+		result.NotLinked = append(result.NotLinked, target)
+		if !dryRun {
+			state.removeLink(target)
+		}
+		return nil
+	}
+
+	if same, err := s.fs.SameFile(record.Source, target); err != nil || !same {
+		s.logger.Error(fmt.Sprintf("Keeping %s: no longer hard linked to %s", target, record.Source))
+		result.Modified = append(result.Modified, target)
+		return nil
+	}
+
+	if dryRun {
+		s.logger.Success(fmt.Sprintf("[DRY-RUN] Would remove hard link: %s", target))
+	} else {
+		s.logger.Success(fmt.Sprintf("Removing hard link: %s", target))
+		if err := s.fs.Delete(target); err != nil {
+			return fmt.Errorf("failed to remove hard link %s: %w", target, err)
+		}
+		state.removeLink(target)
+	}
+	result.Removed = append(result.Removed, target)
+	return nil
+}
+
+// removeCreatedDirectories deletes the recorded directories that are empty, deepest first,
+// and forgets them. Directories that still have content are kept and stay recorded.
+func (s *FileLinkerService) removeCreatedDirectories(state *RepositoryState) {
+	dirs := slices.Clone(state.Directories)
+	sort.Slice(dirs, func(i, j int) bool { return len(dirs[i]) > len(dirs[j]) })
+
+	for _, dir := range dirs {
+		if !s.fs.DirectoryExists(dir) {
+			state.removeDirectory(dir)
+			continue
+		}
+		if err := s.fs.Delete(dir); err != nil {
+			s.logger.Verbose(fmt.Sprintf("Keeping directory %s: %s", dir, err))
+			continue
+		}
+		s.logger.Verbose(fmt.Sprintf("Removed empty directory: %s", dir))
+		state.removeDirectory(dir)
+	}
+}
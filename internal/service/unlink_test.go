@@ -0,0 +1,147 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/guitarrapc/dotfileslinker-go/internal/infrastructure"
+)
+
+func TestFileLinkerService_UnlinkDotfiles(t *testing.T) {
+	repoRoot := "/repo"
+	userHome := "/home/user"
+	ignoreFileName := ".ignore"
+
+	t.Run("Removes only links into the repository", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		logger := NewMockLogger()
+		service := NewFileLinkerService(fs, logger)
+
+		// Repository with two root dotfiles and one HOME file
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# bashrc")
+		fs.AddFile(filepath.Join(repoRoot, ".vimrc"), "# vimrc")
+		fs.AddDirectory(filepath.Join(repoRoot, "HOME"))
+		fs.AddFile(filepath.Join(repoRoot, "HOME", ".config", "nvim", "init.vim"), "# neovim config")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{
+			filepath.Join(repoRoot, ".bashrc"),
+			filepath.Join(repoRoot, ".vimrc"),
+		})
+		fs.SetupFileEnumeration(filepath.Join(repoRoot, "HOME"), "*", true, []string{
+			filepath.Join(repoRoot, "HOME", ".config", "nvim", "init.vim"),
+		})
+
+		// Link owned by the repository
+		fs.SymLinks[filepath.Join(userHome, ".bashrc")] = filepath.Join(repoRoot, ".bashrc")
+		fs.SymLinks[filepath.Join(userHome, ".config", "nvim", "init.vim")] = filepath.Join(repoRoot, "HOME", ".config", "nvim", "init.vim")
+		// Regular file that happens to share the name of a repository file
+		fs.AddFile(filepath.Join(userHome, ".vimrc"), "# user vimrc")
+
+		result, err := service.UnlinkDotfiles(repoRoot, userHome, ignoreFileName, false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if len(result.Removed) != 2 {
+			t.Errorf("Expected 2 removed links, got %v", result.Removed)
+		}
+		if fs.GetLinkTarget(filepath.Join(userHome, ".bashrc")) != "" {
+			t.Error("Repository link was not removed")
+		}
+		if !fs.FileExists(filepath.Join(userHome, ".vimrc")) {
+			t.Error("Regular file was removed")
+		}
+		if len(result.NotLinked) != 1 || result.NotLinked[0] != filepath.Join(userHome, ".vimrc") {
+			t.Errorf("Expected regular file to be reported as not linked, got %v", result.NotLinked)
+		}
+	})
+
+	t.Run("Leaves foreign symlinks alone", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		logger := NewMockLogger()
+		service := NewFileLinkerService(fs, logger)
+
+		// Repository with a single root dotfile
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# bashrc")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{filepath.Join(repoRoot, ".bashrc")})
+
+		foreign := filepath.Join(userHome, ".bashrc")
+		fs.SymLinks[foreign] = "/opt/shared/bashrc"
+
+		result, err := service.UnlinkDotfiles(repoRoot, userHome, ignoreFileName, false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if fs.GetLinkTarget(foreign) != "/opt/shared/bashrc" {
+			t.Error("Foreign symlink was removed")
+		}
+		if len(result.ForeignLinks) != 1 {
+			t.Errorf("Expected 1 foreign link, got %v", result.ForeignLinks)
+		}
+	})
+
+	t.Run("Resolves relative links", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		logger := NewMockLogger()
+		service := NewFileLinkerService(fs, logger)
+
+		// Repository with a single root dotfile
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# bashrc")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{filepath.Join(repoRoot, ".bashrc")})
+
+		target := filepath.Join(userHome, ".bashrc")
+		fs.SymLinks[target] = filepath.Join("..", "..", "repo", ".bashrc")
+
+		result, err := service.UnlinkDotfiles(repoRoot, userHome, ignoreFileName, false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if len(result.Removed) != 1 || fs.GetLinkTarget(target) != "" {
+			t.Errorf("Relative link into the repository was not removed: %v", result.Removed)
+		}
+	})
+
+	t.Run("Dry run keeps links", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		logger := NewMockLogger()
+		service := NewFileLinkerService(fs, logger)
+
+		// Repository with a single root dotfile
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# bashrc")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{filepath.Join(repoRoot, ".bashrc")})
+
+		target := filepath.Join(userHome, ".bashrc")
+		fs.SymLinks[target] = filepath.Join(repoRoot, ".bashrc")
+
+		result, err := service.UnlinkDotfiles(repoRoot, userHome, ignoreFileName, true)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if fs.GetLinkTarget(target) == "" {
+			t.Error("Link was removed in dry run mode")
+		}
+		if len(result.Removed) != 1 {
+			t.Errorf("Expected link to be reported for removal, got %v", result.Removed)
+		}
+	})
+
+	t.Run("Delete failure is reported", func(t *testing.T) {
+		fs := infrastructure.NewMockFileSystem()
+		logger := NewMockLogger()
+		service := NewFileLinkerService(fs, logger)
+
+		// Repository with a single root dotfile
+		fs.AddFile(filepath.Join(repoRoot, ".bashrc"), "# bashrc")
+		fs.SetupFileEnumeration(repoRoot, ".*", false, []string{filepath.Join(repoRoot, ".bashrc")})
+
+		target := filepath.Join(userHome, ".bashrc")
+		fs.SymLinks[target] = filepath.Join(repoRoot, ".bashrc")
+		fs.SetErrorForOperation("Delete:"+target, errTest)
+
+		if _, err := service.UnlinkDotfiles(repoRoot, userHome, ignoreFileName, false); err == nil {
+			t.Fatal("Expected error when the link cannot be removed")
+		}
+	})
+}
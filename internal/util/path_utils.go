@@ -33,3 +33,37 @@ func PathEquals(a, b string) bool {
 	// On other platforms, perform case-sensitive comparison
 	return cleanA == cleanB
 }
+
+// IsSubPath reports whether path is located inside root or is root itself.
+// Both paths are resolved to absolute paths and compared with the same
+// platform-specific case rules as PathEquals.
+func IsSubPath(path, root string) bool {
+	absPath, errPath := filepath.Abs(path)
+	absRoot, errRoot := filepath.Abs(root)
+
+	if errPath != nil || errRoot != nil {
+		return false
+	}
+
+	// On Windows, perform case-insensitive comparison
+	if runtime.GOOS == "windows" {
+		absPath = strings.ToLower(absPath)
+		absRoot = strings.ToLower(absRoot)
+	}
+
+	rel, err := filepath.Rel(absRoot, absPath)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// ResolveLinkTarget returns the path a symbolic link at linkPath points to.
+// Relative link targets are interpreted relative to the directory containing the link,
+// matching how the operating system resolves them.
+func ResolveLinkTarget(linkPath, target string) string {
+	if target == "" || filepath.IsAbs(target) {
+		return target
+	}
+	return filepath.Join(filepath.Dir(linkPath), target)
+}
@@ -103,3 +103,57 @@ func mustGetwd() string {
 	}
 	return dir
 }
+
+func TestIsSubPath(t *testing.T) {
+	root := filepath.Join(os.TempDir(), "repo")
+
+	tests := []struct {
+		name     string
+		path     string
+		expected bool
+	}{
+		{name: "Root itself", path: root, expected: true},
+		{name: "Direct child", path: filepath.Join(root, ".bashrc"), expected: true},
+		{name: "Nested child", path: filepath.Join(root, "HOME", ".config", "nvim", "init.vim"), expected: true},
+		{name: "Sibling with shared prefix", path: root + "-other", expected: false},
+		{name: "Parent directory", path: os.TempDir(), expected: false},
+		{name: "Escaping with dot-dot", path: filepath.Join(root, "..", "other"), expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := IsSubPath(tt.path, root)
+			if result != tt.expected {
+				t.Errorf("IsSubPath(%q, %q) = %v; want %v", tt.path, root, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestResolveLinkTarget(t *testing.T) {
+	linkPath := filepath.Join(os.TempDir(), "home", ".config", "nvim")
+	absTarget := filepath.Join(os.TempDir(), "repo", "HOME", ".config", "nvim")
+
+	tests := []struct {
+		name     string
+		target   string
+		expected string
+	}{
+		{name: "Empty target", target: "", expected: ""},
+		{name: "Absolute target", target: absTarget, expected: absTarget},
+		{
+			name:     "Relative target",
+			target:   filepath.Join("..", "..", "repo", "HOME", ".config", "nvim"),
+			expected: absTarget,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ResolveLinkTarget(linkPath, tt.target)
+			if result != tt.expected {
+				t.Errorf("ResolveLinkTarget(%q, %q) = %q; want %q", linkPath, tt.target, result, tt.expected)
+			}
+		})
+	}
+}